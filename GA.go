@@ -1,59 +1,22 @@
 package main
 
 import (
-	"encoding/csv"
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"math"
 	"math/rand"
+	"mexs/common"
 	"mexs/exchange"
-	"os"
-	"path/filepath"
+	"mexs/results"
 	"sort"
 	"strconv"
-	"time"
-	"mexs/bots"
 )
 
-type tradesCSV struct {
-	// Trade ID
-	ID int
-	// Trading day
-	TD int
-	// Time step
-	TS int
-	// Price
-	P float64
-	// Seller ID
-	SID int
-	// Bid ID
-	BID int
-	// Ask price
-	AP float64
-	// Bid price
-	BP float64
-}
-
-type tradeLPs struct {
-	// trader id
-	TID int
-	// time step
-	TS int
-	// trading day
-	TD int
-	// trade price
-	TP float64
-	// seller limit price
-	Slp float64
-	// buyer limit price
-	Blp float64
-}
-
 type schedData struct {
-	SID int
-	EqP float64
-	EqQ int
+	SID      int
+	EqP      float64
+	EqQ      int
 	bSurplus float64
 	sSurplus float64
 }
@@ -76,71 +39,118 @@ type GA struct {
 	Sps map[int][]float64
 	// buyer limit prices in schedule s
 	Bps map[int][]float64
+	// rng drives selection and mutation, it is seeded from the run seed in Config
+	rng *rand.Rand
+	// rngSrc counts the draws of rng so its state can be checkpointed
+	rngSrc *common.CountingSource
+	// Sink receives the results of the GA and of every market it runs, results.Default when nil
+	Sink results.ResultSink
+	// Elite is the market of the best individual of the last generation that was run
+	Elite exchange.MarketResult
+	// CheckpointEvery is the number of generations between checkpoints, 0 writes none.
+	// With checkpoints the GA tables are written with each checkpoint so they never hold
+	// generations a resumed run does again
+	CheckpointEvery int
+	// CheckpointDir is the folder the checkpoints are written to
+	CheckpointDir string
+	// unsaved are the rows of the GA tables waiting for the next checkpoint
+	unsaved []gaRows
 }
 
+// gaRows are rows of one of the GA tables
+type gaRows struct {
+	table   string
+	columns []string
+	rows    [][]string
+}
+
+// initialMutationRate is the mutation rate of the first generation, it decays as the GA runs
+const initialMutationRate = 0.25
+
 func (g *GA) Start() {
 	// This function will be the heart of the GA
-	rand.Seed(time.Now().UTC().UnixNano())
-	// calculate equilibrium and other stats for schedules
-	g.Sps, g.Bps = getLimits(g.Config)
-	var errorEQ error
-	g.EqSched, errorEQ = calculateAllEQ(g.Config.Schedule, g.Config.SandDs)
-	if errorEQ != nil {
-		log.Panic("Experiment can not be run with non intersecting supply and demand curves")
-	}
+	g.setup()
 
-	g.MutationRate = 0.25
+	g.MutationRate = initialMutationRate
 
 	log.WithFields(log.Fields{
-		"EID":         g.Config.EID,
-		"Individuals": g.N,
-		"Gens":        g.Gens,
-		"Fitness FN": g.Config.FitnessFN,
+		"EID":             g.Config.EID,
+		"Individuals":     g.N,
+		"Gens":            g.Gens,
+		"Fitness FN":      g.Config.FitnessFN,
 		"Chromozone Init": g.Config.CInit,
-		"EqSchde": g.EqSched,
-		"Mutation rate": g.MutationRate,
+		"EqSchde":         g.EqSched,
+		"Mutation rate":   g.MutationRate,
 	}).Warn("STARTING GA")
 
-	// create folder that will contain logs
-	err := os.MkdirAll("../mexs/logs/"+g.Config.EID+"/", 0755)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Error": err.Error(),
-		}).Error("Log Folder for this experiment could not be made")
-	}
-
 	// START BY initializing the genomes
 	cs := make([]exchange.AuctionParameters, g.N)
 	for i := 0; i < g.N; i++ {
 
-		cs[i] = InitializeChromozones(g.Config.CInit)
+		cs[i] = InitializeChromozones(g.Config.CInit, g.Config.Genes, g.Config.GA, g.rng)
 	}
 	g.currentGenes = cs
 
+	g.evolve(0)
+}
+
+// Resume continues the GA from a checkpoint, the generations left give the same results
+// as if the run had never stopped
+func (g *GA) Resume(cp Checkpoint) {
+	g.setup()
+	g.rngSrc.Skip(cp.RNGDraws)
+	g.MutationRate = cp.MutationRate
+	g.currentGenes = cp.Population
+	g.N = len(cp.Population)
+	g.Elite = cp.EliteMarket
+	g.dropGens(cp.Gen)
+
+	log.WithFields(log.Fields{
+		"EID":           g.Config.EID,
+		"Individuals":   g.N,
+		"Gens":          g.Gens,
+		"Gen":           cp.Gen,
+		"Elite score":   cp.EliteScore,
+		"Mutation rate": g.MutationRate,
+	}).Warn("RESUMING GA")
+
+	g.evolve(cp.Gen)
+}
+
+// setup seeds the GA and works out the equilibrium of the schedules
+func (g *GA) setup() {
+	g.rngSrc = common.NewCountingSource(g.Config.Seed, "ga", 0)
+	g.rng = rand.New(g.rngSrc)
+	// calculate equilibrium and other stats for schedules
+	g.Sps, g.Bps = getLimits(g.Config)
+	var errorEQ error
+	g.EqSched, errorEQ = calculateAllEQ(g.Config.Schedule, g.Config.SandDs)
+	if errorEQ != nil {
+		log.Panic("Experiment can not be run with non intersecting supply and demand curves: ", errorEQ)
+	}
+}
+
+// evolve runs the generations from gen on
+func (g *GA) evolve(gen int) {
 	// If fitness function is based on alpha then the smaller the better
 	low := false
 	if g.Config.FitnessFN == "ALPHA" {
 		low = true
 	}
 
-	for i := 0; i < g.Gens; i++ {
+	for i := gen; i < g.Gens; i++ {
+		g.CurrentGen = i
 		log.Warn("GEN:", i)
-
-		err := os.MkdirAll("../mexs/logs/"+g.Config.EID+"/GEN_"+strconv.Itoa(i)+"/", 0755)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"Error": err.Error(),
-			}).Error("Log Folder for this generation could not be made")
-		}
 		// Runs the current generation of markets
-		g.MakeGen(g.currentGenes, strconv.Itoa(i))
+		markets := g.MakeGen(g.currentGenes, strconv.Itoa(i))
 		// Calculate score of each individual in the generation
-		scores := g.FitnessFunction(g.Config.FitnessFN, strconv.Itoa(i))
+		scores := g.FitnessFunction(g.Config.FitnessFN, markets)
 		// Store the score of each individual in the generation
 		g.chromozonesToCSV(i, g.currentGenes, scores)
 		// Find best individual
 		best, score, index := g.elitism(low, scores)
 		g.logElite(best, score, index, strconv.Itoa(i))
+		g.Elite = markets[index]
 		log.WithFields(log.Fields{
 			"gens": best,
 		}).Debug("Best Individual score: ", score)
@@ -150,25 +160,67 @@ func (g *GA) Start() {
 		g.currentGenes[index] = best
 		// decrease the mutation rate by 2 every 50 generations
 		g.decayMutationRate(50, i, 2)
+
+		if g.CheckpointEvery > 0 && (i+1)%g.CheckpointEvery == 0 {
+			g.flush()
+			g.checkpoint(i+1, scores, best, score)
+		}
+	}
+	g.flush()
+	g.CurrentGen = g.Gens
+}
+
+// save writes rows to a GA table, with checkpoints they wait for the next one
+func (g *GA) save(table string, columns []string, rows [][]string) {
+	if g.CheckpointEvery <= 0 {
+		results.Save(g.sink(), g.Config.EID, table, columns, rows)
+		return
+	}
+	g.unsaved = append(g.unsaved, gaRows{table: table, columns: columns, rows: rows})
+}
+
+// flush writes the rows of the GA tables kept by save
+func (g *GA) flush() {
+	for _, r := range g.unsaved {
+		results.Save(g.sink(), g.Config.EID, r.table, r.columns, r.rows)
+	}
+	g.unsaved = nil
+}
+
+// dropGens deletes the markets of the generations from gen on, a GA that stopped after its
+// last checkpoint may have run some of them
+func (g *GA) dropGens(gen int) {
+	remover, ok := g.sink().(results.Remover)
+	if !ok {
+		return
+	}
+	for i := gen; i < g.Gens; i++ {
+		if err := remover.Remove(g.Config.EID + "/GEN_" + strconv.Itoa(i)); err != nil {
+			log.WithFields(log.Fields{
+				"EID":   g.Config.EID,
+				"Gen":   i,
+				"error": err.Error(),
+			}).Error("Results of the generation could not be removed")
+		}
 	}
 }
 
 func (g *GA) createNewGen(scores []float64, low bool) {
 	for i := 0; i < g.N; i++ {
-		g.currentGenes[i] = g.getChildGenes(scores,low)
+		g.currentGenes[i] = g.getChildGenes(scores, low)
 	}
 }
 
 // scores :- scores[i] is the score of the ith individual
 // IF low == true then it means lower scores are better
 func (g *GA) getChildGenes(scores []float64, low bool) exchange.AuctionParameters {
-	contenders := []int{rand.Intn(g.N), rand.Intn(g.N), rand.Intn(g.N)}
+	contenders := []int{g.rng.Intn(g.N), g.rng.Intn(g.N), g.rng.Intn(g.N)}
 	// ix1 -> MOM
 	ix1 := 0
 	// ix2 -> DAD
 	ix2 := 0
 	maxSc := scores[contenders[ix1]]
-	if low{
+	if low {
 		for i := 1; i < len(contenders); i++ {
 			if scores[contenders[i]] < maxSc {
 				maxSc = scores[contenders[i]]
@@ -189,111 +241,59 @@ func (g *GA) getChildGenes(scores []float64, low bool) exchange.AuctionParameter
 	mom := g.currentGenes[contenders[ix1]]
 	dad := g.currentGenes[contenders[ix2]]
 
-	var kp float64
-	var minI float64
-	var win int
-	var delta float64
-	var maxS float64
-	var dom int
-	// KPricing mutation is in range of [-0.05, 0.05] with limits [0,1]
-	kp = mutateFloatSimple(mom.KPricing, dad.KPricing, 0.0, 1.0, g.MutationRate, 0.5, 0.05, -0.05)
-
-	// MinIncrement mutation is in range of [-0.5, 0.5] with limit [0, 20]
-	minI = mom.MinIncrement
-
-	// WindowSizeEE mutation is in range of [-1, +1] with limit [1, 20]
-	win = mutateIntBy1(mom.WindowSizeEE, dad.WindowSizeEE, 1, 20, 50, g.MutationRate)
-
-	// DeltaEE mutation is in range of [-1.0, +1] with limit [0, 100]
-	delta = mutateFloatSimple(mom.DeltaEE, dad.DeltaEE, 0.0, 200.0, g.MutationRate, 0.5, 1.0, -1.0)
-
-	// MaxShift mutation is in range of [-0.02, 0.02] with limit [0.05, 10]
-	maxS = mutateFloatSimple(mom.MaxShift, dad.MaxShift, 0.05, 10, g.MutationRate, 0.5, 0.2, -0.2)
-
-	// Dominance mutation is in range of [-1, 1] with limit [0, 10]
-	dom = mutateIntBy1(mom.Dominance, dad.Dominance, 0, 10, 50, g.MutationRate)
-
-	// BidAsk ratio mutation always mom gene  range [ -0.05, 0.05] with limit [0.1, 0.9]
-	bar := mutateFloatSimple(mom.BidAskRatio, mom.BidAskRatio, 0.1, 0.9, g.MutationRate, 1.0, 0.05, 0.05 )
+	genes := g.Config.Genes
 	return exchange.AuctionParameters{
-		BidAskRatio:  bar,
-		KPricing:     kp,
-		MinIncrement: minI,
-		WindowSizeEE: win,
-		DeltaEE:      delta,
-		MaxShift:     maxS,
-		Dominance:    dom,
-		OrderQueuing: 1,
+		KPricing:      genes.KPricing.mutateFloat(g.rng, mom.KPricing, dad.KPricing, g.MutationRate),
+		MinIncrement:  genes.MinIncrement.mutateFloat(g.rng, mom.MinIncrement, dad.MinIncrement, g.MutationRate),
+		WindowSizeEE:  genes.WindowSizeEE.mutateInt(g.rng, mom.WindowSizeEE, dad.WindowSizeEE, g.MutationRate),
+		DeltaEE:       genes.DeltaEE.mutateFloat(g.rng, mom.DeltaEE, dad.DeltaEE, g.MutationRate),
+		MaxShift:      genes.MaxShift.mutateFloat(g.rng, mom.MaxShift, dad.MaxShift, g.MutationRate),
+		Dominance:     genes.Dominance.mutateInt(g.rng, mom.Dominance, dad.Dominance, g.MutationRate),
+		PricingRule:   genes.PricingRule.mutateChoice(g.rng, mom.PricingRule, dad.PricingRule, g.MutationRate),
+		PricingWindow: genes.PricingWindow.mutateInt(g.rng, mom.PricingWindow, dad.PricingWindow, g.MutationRate),
+		BidAskRatio:   genes.BidAskRatio.mutateFloat(g.rng, mom.BidAskRatio, dad.BidAskRatio, g.MutationRate),
+		OrderQueuing:  mom.OrderQueuing,
 	}
 }
 
-
-func mutateIntBy1(mom, dad, lbound,ubound, prob int, mRate float64) int {
-	mutation := 0
-	if mRate > rand.Float64() {
-		mutation = 1
-		if rand.Float64() <= 0.5 {
-			mutation = -1
+// MakeGen runs the market of every individual of a generation, markets[i] is the result of cs[i].
+// Markets are run by Config.Workers workers, each market has its own agents and random
+// sources so the results are the same as running them one after another
+func (g *GA) MakeGen(cs []exchange.AuctionParameters, gen string) []exchange.MarketResult {
+	jobs := make([]MarketJob, g.N)
+	for i := 0; i < g.N; i++ {
+		// every individual runs with its own seed so its market can be replayed alone
+		jobs[i] = MarketJob{
+			EID:      g.Config.EID + "/GEN_" + gen + "/IND_" + strconv.Itoa(i),
+			Params:   cs[i],
+			Seed:     common.DeriveSeed(g.Config.Seed, "GEN_"+gen, i),
+			SkipLogs: g.Config.SkipMarketLogs,
 		}
+		recordSeed(g.sink(), jobs[i].EID, jobs[i].Seed)
 	}
 
-	v := dad + mutation
-	if val := rand.Intn(100); val < prob {
-		v = mom + mutation
-	}
-	if v < lbound {
-		return lbound
-	} else if v > ubound {
-		return ubound
-	}
-
-	return v
-}
-
-//centered around 0
-func mutateFloatSimple(mom, dad, lbound, ubound, mRate, prob, maxM, minM float64) (float64){
-	mutation := 0.0
-	if mRate > rand.Float64() {
-		mutation = rand.Float64() * (maxM- minM) + minM
-	}
-
-	v := dad +mutation
-	if rand.Float64() < prob {
-		 v = mom + mutation
-	}
-	if v < lbound {
-		return lbound
-	} else if v > ubound {
-		return ubound
-	}
-
-	return v
-}
-
-
-func (g *GA) MakeGen(cs []exchange.AuctionParameters, gen string) {
-	for i := 0; i < g.N; i++ {
-		ex := &exchange.Exchange{}
-		ex.Init(cs[i], g.Config.MarketInfo, g.Config.SellersIDs, g.Config.BuyersIDs)
-		ex.SetTraders(g.ReMakeAgents())
-		ex.StartMarket(g.Config.EID+"/GEN_"+gen+"/IND_"+strconv.Itoa(i), g.Config.Schedule, g.Config.SandDs)
+	markets, err := runnerOf(g.Config, g.Config.Workers, g.sink()).Run(g.Config, jobs)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"EID":   g.Config.EID,
+			"Gen":   gen,
+			"error": err.Error(),
+		}).Panic("The markets of the generation could not be run")
 	}
+	return markets
 }
 
-func (g *GA) FitnessFunction(fnName string, gen string) []float64 {
+func (g *GA) FitnessFunction(fnName string, markets []exchange.MarketResult) []float64 {
 	// Allow for different functions to be used
 	switch fnName {
 	case "ALPHA":
 		// alpha
-		trades := g.readTradesCSV(fmt.Sprintf("../mexs/logs/%s/GEN_%s/", g.Config.EID, gen))
-		return g.allAlphaScores(trades)
+		return g.allAlphaScores(markets)
 
 	case "ALOC-EFF":
 		// FIXME: assume no market shocks for now
 		// Regular schedule
-
-		trades := g.getLimitPrices(fmt.Sprintf("../mexs/logs/%s/GEN_%s/", g.Config.EID, gen))
-		return g.allEffs(trades)
+		return g.allEffs(markets)
 	case "AVG-TRADER-EFF":
 		return []float64{}
 	case "COM-EFFICENCY":
@@ -304,16 +304,21 @@ func (g *GA) FitnessFunction(fnName string, gen string) []float64 {
 	}
 }
 
-func (g *GA) allAlphaScores(trades map[int][]tradesCSV) []float64 {
+func (g *GA) allAlphaScores(markets []exchange.MarketResult) []float64 {
 	scores := make([]float64, g.N)
-	for k, v := range trades {
-		scores[k] = g.alphaFitnessFn(v)
+	for k, m := range markets {
+		scores[k] = g.alphaFitnessFn(m.Trades)
 	}
 	return scores
 }
 
-func (g *GA) alphaFitnessFn(trades []tradesCSV) float64 {
-	//
+func (g *GA) alphaFitnessFn(trades []exchange.TradeResult) float64 {
+	return alphaScore(trades, g.EqSched, g.Config.MarketInfo.TradingDays)
+}
+
+// alphaScore is the Smith's alpha of a market averaged over its trading days, eq has
+// the equilibrium of each day. Days with no trades get a big alpha
+func alphaScore(trades []exchange.TradeResult, eq map[int]schedData, days int) float64 {
 	tNum := float64(len(trades))
 	if tNum == 0 {
 		// Big value to penalise exchanges that make no trades happen
@@ -321,62 +326,68 @@ func (g *GA) alphaFitnessFn(trades []tradesCSV) float64 {
 	}
 
 	// There is one alpha per day as market shocks occur between days for now
-	alphas := make([]float64, g.Config.MarketInfo.TradingDays)
-	sums := make([]float64, g.Config.MarketInfo.TradingDays)
-
+	alphas := make([]float64, days)
+	sums := make([]float64, days)
 
 	for _, t := range trades {
-		sums[t.TD] += math.Pow(t.P-g.EqSched[t.TD].EqP, 2.0)
+		// every unit traded counts as one transaction
+		sums[t.Day] += float64(t.Quantity) * math.Pow(t.Price-eq[t.Day].EqP, 2.0)
 		// use alphas to store count of trades per day, to save some memory
-		alphas[t.TD] ++
+		alphas[t.Day] += float64(t.Quantity)
 	}
 
 	// score si the average alpha between trading days
 	alpha := 0.0
-	for d:= 0; d < g.Config.MarketInfo.TradingDays; d++ {
+	for d := 0; d < days; d++ {
 		// Penalize market with no trades
 		if alphas[d] == 0 {
 			sums[d] = 100000
 			alphas[d] = 1
 		}
 
-		sums[d] = math.Sqrt(sums[d]/alphas[d])
-		alphas[d] = (100.0 / g.EqSched[d].EqP) * sums[d]
+		sums[d] = math.Sqrt(sums[d] / alphas[d])
+		alphas[d] = (100.0 / eq[d].EqP) * sums[d]
 		alpha += alphas[d]
 	}
-	alpha = alpha / float64(g.Config.MarketInfo.TradingDays)
+	alpha = alpha / float64(days)
 	return alpha
 }
 
-func (g *GA) allEffs(trades map[int][]tradeLPs) []float64 {
+func (g *GA) allEffs(markets []exchange.MarketResult) []float64 {
 	scores := make([]float64, g.N)
-	for k, v := range trades {
-		scores[k] = g.efficiency(v)
+	for k, m := range markets {
+		scores[k] = g.efficiency(m.Trades)
 	}
 	return scores
 }
 
 // Average efficency between days
-func (g *GA) efficiency(trades []tradeLPs) float64 {
+func (g *GA) efficiency(trades []exchange.TradeResult) float64 {
+	return efficiencyScore(trades, g.EqSched, g.Config.MarketInfo.TradingDays)
+}
+
+// efficiencyScore is the allocative efficiency of a market averaged over its trading
+// days, eq has the equilibrium surplus of each day
+func efficiencyScore(trades []exchange.TradeResult, eq map[int]schedData, days int) float64 {
 	if len(trades) == 0 {
 		return 0.0
 	}
 
-	effs := make([]float64, g.Config.MarketInfo.TradingDays)
+	effs := make([]float64, days)
 	for _, v := range trades {
 		// Seller profit is  =  Trade price  - Seller limit price
 		// buyers profit is  = Buyer limit price  - Trade Price
 		// Total profit is = buyer profit + seller profit
-		effs[v.TD] += (v.TP - v.Slp) + (v.Blp - v.TP)
+		effs[v.Day] += float64(v.Quantity) * ((v.Price - v.SLimit) + (v.BLimit - v.Price))
 	}
 
 	eff := 0.0
-	for d:= 0; d < g.Config.MarketInfo.TradingDays; d++ {
-		effs[d] = effs[d] / (g.EqSched[d].bSurplus + g.EqSched[d].sSurplus)
+	for d := 0; d < days; d++ {
+		effs[d] = effs[d] / (eq[d].bSurplus + eq[d].sSurplus)
 		eff += effs[d]
 	}
 
-	eff = eff / float64(g.Config.MarketInfo.TradingDays)
+	eff = eff / float64(days)
 
 	log.WithFields(log.Fields{
 		"trades": len(trades),
@@ -384,150 +395,27 @@ func (g *GA) efficiency(trades []tradeLPs) float64 {
 	return eff
 }
 
-func (g *GA) readTradesCSV(folderPath string) map[int][]tradesCSV {
-	allTrades := make(map[int][]tradesCSV)
-	for i := 0; i < g.N; i++ {
-		fileName, err := filepath.Abs(folderPath + "IND_" + strconv.Itoa(i) + "/TRADES.csv")
-		if err != nil {
-			log.WithFields(log.Fields{
-				"error": err.Error(),
-			}).Panic("Could not find path to trade file: ", fileName)
-		}
-
-		file, err := os.OpenFile(fileName, os.O_RDONLY, 0644)
-		lines, err := csv.NewReader(file).ReadAll()
-		if err != nil {
-			log.WithFields(log.Fields{
-				"Error": err.Error(),
-			}).Panic("Could not read the file:", fileName)
-		}
-		file.Close()
-
-		// remove headers from csv
-		lines = lines[1:][:]
-		trades := make([]tradesCSV, len(lines))
-		for i, line := range lines {
-			id, _ := strconv.Atoi(line[0])
-			td, _ := strconv.Atoi(line[1])
-			ts, _ := strconv.Atoi(line[2])
-			p, _ := strconv.ParseFloat(line[3], 64)
-			sid, _ := strconv.Atoi(line[4])
-			bid, _ := strconv.Atoi(line[5])
-			ap, _ := strconv.ParseFloat(line[6], 64)
-			bp, _ := strconv.ParseFloat(line[7], 64)
-
-			trades[i] = tradesCSV{
-				ID:  id,
-				TD:  td,
-				TS:  ts,
-				P:   p,
-				SID: sid,
-				BID: bid,
-				AP:  ap,
-				BP:  bp,
-			}
-		}
-		allTrades[i] = trades
-	}
-	return allTrades
-}
-
-// return trades and limit prices  in form map[individual]structure
-func (g *GA) getLimitPrices(folderPath string) map[int][]tradeLPs {
-	allTrades := make(map[int][]tradeLPs)
-	for i:=0; i< g.N; i++ {
-		// READ trades.csv
-		fileName, err := filepath.Abs(folderPath + "IND_" + strconv.Itoa(i) + "/TRADES.csv")
-		if err != nil {
-			log.WithFields(log.Fields{
-				"error": err.Error(),
-			}).Panic("Could not find path to trade file: ", fileName)
-		}
-
-		file, err := os.OpenFile(fileName, os.O_RDONLY, 0644)
-
-		lines, err := csv.NewReader(file).ReadAll()
-
-		if err != nil {
-			log.WithFields(log.Fields{
-				"Error": err.Error(),
-			}).Panic("Could not read the file:", fileName)
-		}
-
-		// remove headers from csv
-		lines = lines[1:][:]
-		log.Debug(lines)
-		trades := make([]tradeLPs, len(lines))
-		for ix, line := range lines {
-			id, _ := strconv.Atoi(line[0])
-			td, _ := strconv.Atoi(line[1])
-			ts, _ := strconv.Atoi(line[2])
-			p, _ := strconv.ParseFloat(line[3], 64)
-
-			ap, _ := strconv.ParseFloat(line[8], 64)
-			bp, _ := strconv.ParseFloat(line[9], 64)
-
-			trades[ix] = tradeLPs{
-				TID:  id,
-				TD:  td,
-				TS:  ts,
-				TP:   p,
-				Slp: ap,
-				Blp: bp,
-			}
-		}
-		allTrades[i] = trades
-		file.Close()
+func (g *GA) sink() results.ResultSink {
+	if g.Sink == nil {
+		return results.Default
 	}
-
-	return allTrades
+	return g.Sink
 }
 
 func (g *GA) chromozonesToCSV(gen int, cs []exchange.AuctionParameters, scores []float64) {
-	fileName, err := filepath.Abs(fmt.Sprintf("../mexs/logs/%s/chromozones.csv", g.Config.EID))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"experimentID": g.Config.EID,
-			"error":        err.Error(),
-		}).Error("File Path not found")
-		return
-	}
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
-	}
-
-	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer f.Close()
-
-	writer := csv.NewWriter(f)
-	defer writer.Flush()
-
-	if addHeader {
-		writer.Write([]string{
-			"Gen",
-			"Score",
-			"B:A",
-			"K",
-			"MinIncrement",
-			"WindowSizeEE",
-			"DeltaEE",
-			"MaxShift",
-			"Dominance",
-		})
-	}
-
-	if len(scores) !=  len(cs) {
+	if len(scores) != len(cs) {
 		log.WithFields(log.Fields{
 			"Scores len ": len(scores),
-			"Len cs": len(cs),
+			"Len cs":      len(cs),
 		}).Panic("Size of chromosomes array does not match score array")
 	}
 
+	rows := make([][]string, 0, len(cs))
 	for i, v := range cs {
-		writer.Write([]string{
+		rows = append(rows, []string{
 			strconv.Itoa(gen),
 			fmt.Sprintf("%.5f", scores[i]),
+			strconv.Itoa(i),
 			fmt.Sprintf("%.5f", v.BidAskRatio),
 			fmt.Sprintf("%.5f", v.KPricing),
 			fmt.Sprintf("%.5f", v.MinIncrement),
@@ -535,74 +423,54 @@ func (g *GA) chromozonesToCSV(gen int, cs []exchange.AuctionParameters, scores [
 			fmt.Sprintf("%.5f", v.DeltaEE),
 			fmt.Sprintf("%.5f", v.MaxShift),
 			strconv.Itoa(v.Dominance),
+			v.PricingRule,
+			strconv.Itoa(v.PricingWindow),
 		})
 	}
+
+	g.save("chromozones", []string{
+		"Gen",
+		"Score",
+		"ID",
+		"B:A",
+		"K",
+		"MinIncrement",
+		"WindowSizeEE",
+		"DeltaEE",
+		"MaxShift",
+		"Dominance",
+		"PricingRule",
+		"PricingWindow",
+	}, rows)
 }
 
-func InitializeChromozones(initType string) exchange.AuctionParameters {
+// InitializeChromozones makes an individual of the first generation with the init strategy
+// initType, the genes follow the schema and the ones that are not evolved are taken from base
+func InitializeChromozones(initType string, genes GeneSchema, base exchange.AuctionParameters,
+	rng *rand.Rand) exchange.AuctionParameters {
+	c := initChromozone(initType, genes, rng)
+	// Order queuing is not evolved, it is taken from the config file
+	c.OrderQueuing = base.OrderQueuing
+	// A pricing rule in the config file is the starting point of the population
+	if base.PricingRule != "" {
+		c.PricingRule = base.PricingRule
+	}
+	return genes.Apply(c, base)
+}
+
+// initChromozone places the genes at the bottom of their range for LOW, in the middle for
+// NORMAL and at the top for HIGH, those take the first pricing rule option. RANDOM and
+// any other init type draw every gene uniformly from its range
+func initChromozone(initType string, genes GeneSchema, rng *rand.Rand) exchange.AuctionParameters {
 	switch initType {
 	case "LOW":
-		return exchange.AuctionParameters{
-			BidAskRatio:  0.25,
-			KPricing:     0,
-			MinIncrement: 0,
-			MaxShift:     0.1,
-			WindowSizeEE: 1,
-			DeltaEE:      0.0,
-			Dominance:    0,
-			OrderQueuing: 1,
-		}
+		return genes.at(0)
 	case "NORMAL":
-		return exchange.AuctionParameters{
-			BidAskRatio:  0.5,
-			KPricing:     0.5,
-			MinIncrement: 1,
-			MaxShift:     2,
-			WindowSizeEE: 10,
-			DeltaEE:      10.0,
-			Dominance:    0,
-			OrderQueuing: 1,
-		}
+		return genes.at(0.5)
 	case "HIGH":
-		return exchange.AuctionParameters{
-			BidAskRatio:  0.75,
-			KPricing:     1,
-			MinIncrement: 10,
-			MaxShift:     10,
-			WindowSizeEE: 50,
-			DeltaEE:      100.0,
-			Dominance:    10,
-			OrderQueuing: 1,
-		}
-	case "RANDOM":
-		// random, in logical range
-		// BidAsk Ratio between [0.1, 0.9)
-		// KPricing between [0,1)
-		// MinIncrement between [0,5)
-		// MaxShift between [0.5,1.5)
-		// Domminance between [0,5)
-		return exchange.AuctionParameters{
-			BidAskRatio:  rand.Float64() * (0.9-0.1) + 0.1,
-			KPricing:     rand.Float64(),
-			MinIncrement: float64(rand.Intn(5)),
-			MaxShift:     rand.Float64() + 0.5,
-			WindowSizeEE: rand.Intn(50-10) + 10,
-			DeltaEE:      8+ 5*rand.Float64(),
-			Dominance:    rand.Intn(5),
-			OrderQueuing: 1,
-		}
+		return genes.at(1)
 	default:
-		// Note: default to any especial case I want to test out
-		return exchange.AuctionParameters{
-			BidAskRatio:  float64(rand.Intn(13-7)+7) / 10.0,
-			KPricing:     rand.Float64(),
-			MinIncrement: float64(rand.Intn(5)),
-			MaxShift:     rand.Float64() + 0.5,
-			WindowSizeEE: rand.Intn(6-1) + 1,
-			DeltaEE:      2 + 5*rand.Float64(),
-			Dominance:    rand.Intn(5),
-			OrderQueuing: 1,
-		}
+		return genes.draw(rng)
 	}
 }
 
@@ -633,40 +501,20 @@ func (g *GA) elitism(low bool, scores []float64) (exchange.AuctionParameters, fl
 }
 
 func (g *GA) logElite(elite exchange.AuctionParameters, score float64, ix int, gen string) {
-	fileName, err := filepath.Abs(fmt.Sprintf("../mexs/logs/%s/elite.csv", g.Config.EID))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"experimentID": g.Config.EID,
-			"error":        err.Error(),
-		}).Error("File Path not found")
-		return
-	}
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
-	}
-
-	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer f.Close()
-
-	writer := csv.NewWriter(f)
-	defer writer.Flush()
-
-	if addHeader {
-		writer.Write([]string{
-			"Gen",
-			"Score",
-			"ID",
-			"B:A",
-			"K",
-			"MinIncrement",
-			"WindowSizeEE",
-			"DeltaEE",
-			"MaxShift",
-			"Dominance",
-		})
-	}
-	writer.Write([]string{
+	g.save("elite", []string{
+		"Gen",
+		"Score",
+		"ID",
+		"B:A",
+		"K",
+		"MinIncrement",
+		"WindowSizeEE",
+		"DeltaEE",
+		"MaxShift",
+		"Dominance",
+		"PricingRule",
+		"PricingWindow",
+	}, [][]string{{
 		gen,
 		fmt.Sprintf("%.4f", score),
 		strconv.Itoa(ix),
@@ -677,53 +525,12 @@ func (g *GA) logElite(elite exchange.AuctionParameters, score float64, ix int, g
 		fmt.Sprintf("%.5f", elite.DeltaEE),
 		fmt.Sprintf("%.5f", elite.MaxShift),
 		strconv.Itoa(elite.Dominance),
-	})
-
-}
-
-func (g* GA) ReMakeAgents() map[int]bots.RobotTrader {
-	traders := make(map[int]bots.RobotTrader)
-	for i, id := range g.Config.SellersIDs {
-		switch g.Config.AlgoS[i] {
-		case "ZIP":
-			zipT := &bots.ZIPTrader{}
-			zipT.InitRobotCore(id, "SELLER", g.Config.MarketInfo)
-			traders[zipT.Info.TraderID] = zipT
-		case "ZIC":
-			zic := &bots.ZICTrader{}
-			zic.InitRobotCore(id, "SELLER", g.Config.MarketInfo)
-			traders[zic.Info.TraderID] = zic
-		case "AA":
-			aa := &bots.AATrader{}
-			aa.InitRobotCore(id, "SELLER", g.Config.MarketInfo)
-			traders[aa.Info.TraderID] = aa
-		default:
-			log.Panic("SHIIT")
-		}
-	}
-
-	for i, id := range g.Config.BuyersIDs {
-		switch g.Config.AlgoB[i] {
-		case "ZIP":
-			zipT := &bots.ZIPTrader{}
-			zipT.InitRobotCore(id, "BUYER", g.Config.MarketInfo)
-			traders[zipT.Info.TraderID] = zipT
-		case "ZIC":
-			zic := &bots.ZICTrader{}
-			zic.InitRobotCore(id, "BUYER", g.Config.MarketInfo)
-			traders[zic.Info.TraderID] = zic
-		case "AA":
-			aa := &bots.AATrader{}
-			aa.InitRobotCore(id, "BUYER", g.Config.MarketInfo)
-			traders[aa.Info.TraderID] = aa
-		default:
-			log.Panic("SHIIT")
-		}
-	}
-	return traders
+		elite.PricingRule,
+		strconv.Itoa(elite.PricingWindow),
+	}})
 }
 
-func getLimits(c ExperimentConfig) (map[int][]float64, map[int][]float64){
+func getLimits(c ExperimentConfig) (map[int][]float64, map[int][]float64) {
 	// Case 1: when there is only one s and d
 	sps := make(map[int][]float64)
 	bps := make(map[int][]float64)
@@ -731,11 +538,11 @@ func getLimits(c ExperimentConfig) (map[int][]float64, map[int][]float64){
 		var sPrices []float64
 		var bPrices []float64
 		for _, alp := range s.Sps {
-			sPrices = append(sPrices, alp.Prices...)
+			sPrices = append(sPrices, unitPrices(alp)...)
 		}
 
 		for _, alp := range s.Bps {
-			bPrices = append(bPrices, alp.Prices...)
+			bPrices = append(bPrices, unitPrices(alp)...)
 		}
 
 		sps[s.ID] = sPrices
@@ -745,6 +552,18 @@ func getLimits(c ExperimentConfig) (map[int][]float64, map[int][]float64){
 	return sps, bps
 }
 
+// unitPrices repeats each limit price once per unit so that supply and
+// demand curves take the quantities into account
+func unitPrices(alp exchange.AgentLimitPrices) []float64 {
+	var prices []float64
+	for ix, p := range alp.Prices {
+		for q := 0; q < alp.Quantity(ix); q++ {
+			prices = append(prices, p)
+		}
+	}
+	return prices
+}
+
 // calculates equilibrium price and equilibrium quantity
 // the maximal theoretical number of trades is equal to the equilibrium quantity floored
 // as no fraction trade can be made
@@ -752,11 +571,11 @@ func calculateAllEQ(sched exchange.AllocationSchedule, SAndDs map[int]exchange.S
 	results := make(map[int]schedData)
 
 	for d, _ := range sched.Schedule {
-		for _ , sid := range sched.Schedule[d] {
+		for _, sid := range sched.Schedule[d] {
 			if _, ok := results[d]; !ok {
 				data, err := calculateSchedEQ(SAndDs[sid])
 				if err != nil {
-					log.Panic("The stats could not be calculated for schedule ", sid)
+					return nil, fmt.Errorf("the equilibrium of schedule %d could not be calculated: %s", sid, err.Error())
 				}
 				results[d] = data
 			}
@@ -771,18 +590,18 @@ func calculateSchedEQ(s exchange.SandD) (schedData, error) {
 	var bPrices []float64
 
 	for _, alp := range s.Sps {
-		sPrices = append(sPrices, alp.Prices...)
+		sPrices = append(sPrices, unitPrices(alp)...)
 	}
 
 	for _, alp := range s.Bps {
-		bPrices = append(bPrices, alp.Prices...)
+		bPrices = append(bPrices, unitPrices(alp)...)
 	}
 
 	sort.Float64s(sPrices)
 	sort.Sort(sort.Reverse(sort.Float64Slice(bPrices)))
 
 	for ix, value := range sPrices {
-		if len(bPrices) <= ix + 1 {
+		if len(bPrices) <= ix+1 {
 			break
 		}
 
@@ -791,22 +610,22 @@ func calculateSchedEQ(s exchange.SandD) (schedData, error) {
 			eqQ := ix
 			sellerS, buyerS := calculateMaxSurplus(sPrices, bPrices, eqP)
 			return schedData{
-				SID: s.ID,
-				EqP:eqP,
-				EqQ:eqQ,
-				sSurplus:sellerS,
-				bSurplus:buyerS,
+				SID:      s.ID,
+				EqP:      eqP,
+				EqQ:      eqQ,
+				sSurplus: sellerS,
+				bSurplus: buyerS,
 			}, nil
 		} else if bPrices[ix] < value {
 			eqP := (bPrices[ix] + value) / 2.0
 			eqQ := ix
 			sellerS, buyerS := calculateMaxSurplus(sPrices, bPrices, eqP)
 			return schedData{
-				SID: s.ID,
-				EqP:eqP,
-				EqQ:eqQ,
-				sSurplus:sellerS,
-				bSurplus:buyerS,
+				SID:      s.ID,
+				EqP:      eqP,
+				EqQ:      eqQ,
+				sSurplus: sellerS,
+				bSurplus: buyerS,
 			}, nil
 		}
 	}
@@ -834,10 +653,9 @@ func calculateMaxSurplus(sps, bps []float64, pe float64) (float64, float64) {
 	return sMaxSurplus, bMaxSurplus
 }
 
-
 // decrease mutation rate every X steps
 func (g *GA) decayMutationRate(steps, gen int, factor float64) {
-	if gen != 0 && gen % steps == 0 {
+	if gen != 0 && gen%steps == 0 {
 		g.MutationRate = g.MutationRate / factor
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"mexs/common"
+	"mexs/exchange"
+	"testing"
+)
+
+// testEq is a schedule with the equilibrium at 100 and a surplus of 60 every day
+var testEq = map[int]schedData{
+	0: {EqP: 100, EqQ: 2, bSurplus: 30, sSurplus: 30},
+	1: {EqP: 100, EqQ: 2, bSurplus: 30, sSurplus: 30},
+}
+
+func trade(day int, price float64, quantity int) exchange.TradeResult {
+	return exchange.TradeResult{Day: day, Price: price, Quantity: quantity, SLimit: 80, BLimit: 120}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestAlphaScore(t *testing.T) {
+	cases := []struct {
+		name   string
+		trades []exchange.TradeResult
+		alpha  float64
+	}{
+		{"no trades", nil, 100},
+		{"at equilibrium", []exchange.TradeResult{trade(0, 100, 1), trade(1, 100, 2)}, 0},
+		// each unit counts as a transaction, day 0 deviates by sqrt(300 / 4) and day 1 by 0
+		{"units", []exchange.TradeResult{trade(0, 110, 3), trade(0, 100, 1), trade(1, 100, 1)}, math.Sqrt(75) / 2},
+		// a day with no trades is penalised with a deviation of sqrt(100000)
+		{"day with no trades", []exchange.TradeResult{trade(0, 100, 1)}, math.Sqrt(100000) / 2},
+	}
+
+	for _, c := range cases {
+		if alpha := alphaScore(c.trades, testEq, 2); !near(alpha, c.alpha) {
+			t.Errorf("%s: alpha %.5f, want %.5f", c.name, alpha, c.alpha)
+		}
+	}
+}
+
+func TestEfficiencyScore(t *testing.T) {
+	cases := []struct {
+		name   string
+		trades []exchange.TradeResult
+		eff    float64
+	}{
+		{"no trades", nil, 0},
+		// every unit makes 40 of the 60 of surplus of its day
+		{"one unit a day", []exchange.TradeResult{trade(0, 100, 1), trade(1, 90, 1)}, 40.0 / 60},
+		{"units", []exchange.TradeResult{trade(0, 100, 1), trade(0, 110, 1), trade(1, 100, 1)}, (80.0/60 + 40.0/60) / 2},
+	}
+
+	for _, c := range cases {
+		if eff := efficiencyScore(c.trades, testEq, 2); !near(eff, c.eff) {
+			t.Errorf("%s: efficiency %.5f, want %.5f", c.name, eff, c.eff)
+		}
+	}
+}
+
+func TestFitnessComesFromTheTradesOfEachMarket(t *testing.T) {
+	g := &GA{N: 2, EqSched: testEq, Config: ExperimentConfig{MarketInfo: common.MarketInfo{TradingDays: 2}}}
+	markets := []exchange.MarketResult{
+		{EID: "a", Trades: []exchange.TradeResult{trade(0, 110, 1), trade(1, 90, 1)}},
+		{EID: "b", Trades: []exchange.TradeResult{trade(0, 100, 1), trade(1, 100, 1)}},
+	}
+
+	alphas := g.FitnessFunction("ALPHA", markets)
+	if len(alphas) != 2 || !near(alphas[0], 10) || !near(alphas[1], 0) {
+		t.Errorf("alphas are %v, want [10 0]", alphas)
+	}
+	effs := g.FitnessFunction("ALOC-EFF", markets)
+	if len(effs) != 2 || !near(effs[0], 40.0/60) || !near(effs[1], 40.0/60) {
+		t.Errorf("efficiencies are %v, want both %.5f", effs, 40.0/60)
+	}
+}
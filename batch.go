@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"mexs/common"
+	"mexs/exchange"
+	"mexs/results"
+	"strconv"
+	"sync"
+)
+
+// runSummary is the outcome of one run of a batch
+type runSummary struct {
+	Run        int
+	EID        string
+	Seed       int64
+	Trades     int
+	Volume     int
+	Efficiency float64
+	Alpha      float64
+}
+
+// runBatch runs the experiment runs times over parallel goroutines, run i gets a seed derived
+// from the one of base and the EID eidOf(i) so the results do not depend on parallel
+func runBatch(base ExperimentConfig, runs, parallel int, eidOf func(i int) string,
+	run func(config ExperimentConfig) exchange.MarketResult) []runSummary {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	// the equilibrium is the same for every run as they share the schedule
+	eq, err := calculateAllEQ(base.Schedule, base.SandDs)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"EID":   base.EID,
+			"error": err.Error(),
+		}).Warn("Efficiency and alpha of the runs can not be calculated")
+	}
+	days := base.MarketInfo.TradingDays
+
+	summaries := make([]runSummary, runs)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				log.Warn("Run: ", i)
+				config := base
+				config.Seed = common.DeriveSeed(base.Seed, "run", i)
+				config.EID = eidOf(i)
+				recordSeed(results.Default, config.EID, config.Seed)
+
+				market := run(config)
+				s := runSummary{
+					Run:        i,
+					EID:        config.EID,
+					Seed:       config.Seed,
+					Trades:     len(market.Trades),
+					Efficiency: math.NaN(),
+					Alpha:      math.NaN(),
+				}
+				for _, t := range market.Trades {
+					s.Volume += t.Quantity
+				}
+				if err == nil {
+					s.Efficiency = efficiencyScore(market.Trades, eq, days)
+					s.Alpha = alphaScore(market.Trades, eq, days)
+				}
+				summaries[i] = s
+			}
+		}()
+	}
+	for i := 0; i < runs; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return summaries
+}
+
+// writeSummary saves each run to the RUNS table of the batch and the mean, standard
+// deviation and range of their metrics to its SUMMARY table
+func writeSummary(eid string, summaries []runSummary) {
+	rows := make([][]string, len(summaries))
+	for i, s := range summaries {
+		rows[i] = []string{
+			strconv.Itoa(s.Run),
+			s.EID,
+			strconv.FormatInt(s.Seed, 10),
+			strconv.Itoa(s.Trades),
+			strconv.Itoa(s.Volume),
+			fmt.Sprintf("%.5f", s.Efficiency),
+			fmt.Sprintf("%.5f", s.Alpha),
+		}
+	}
+	results.Save(results.Default, eid, "RUNS",
+		[]string{"Run", "EID", "Seed", "Trades", "Volume", "Efficiency", "Alpha"}, rows)
+
+	metrics := []struct {
+		name  string
+		value func(s runSummary) float64
+	}{
+		{"Trades", func(s runSummary) float64 { return float64(s.Trades) }},
+		{"Volume", func(s runSummary) float64 { return float64(s.Volume) }},
+		{"Efficiency", func(s runSummary) float64 { return s.Efficiency }},
+		{"Alpha", func(s runSummary) float64 { return s.Alpha }},
+	}
+
+	rows = [][]string{}
+	fields := log.Fields{"EID": eid, "Runs": len(summaries)}
+	for _, m := range metrics {
+		values := []float64{}
+		for _, s := range summaries {
+			// runs without an equilibrium have no efficiency or alpha
+			if v := m.value(s); !math.IsNaN(v) {
+				values = append(values, v)
+			}
+		}
+		mean, std, min, max := describe(values)
+		rows = append(rows, []string{
+			m.name,
+			fmt.Sprintf("%.5f", mean),
+			fmt.Sprintf("%.5f", std),
+			fmt.Sprintf("%.5f", min),
+			fmt.Sprintf("%.5f", max),
+			strconv.Itoa(len(values)),
+		})
+		fields[m.name] = fmt.Sprintf("%.5f ± %.5f", mean, std)
+	}
+	results.Save(results.Default, eid, "SUMMARY",
+		[]string{"Metric", "Mean", "Std", "Min", "Max", "Runs"}, rows)
+
+	log.WithFields(fields).Warn("Summary of the runs")
+}
+
+// describe returns the mean, sample standard deviation, min and max of values, all NaN
+// when there are none
+func describe(values []float64) (mean, std, min, max float64) {
+	if len(values) == 0 {
+		return math.NaN(), math.NaN(), math.NaN(), math.NaN()
+	}
+
+	min, max = values[0], values[0]
+	for _, v := range values {
+		mean += v
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	mean = mean / float64(len(values))
+
+	if len(values) > 1 {
+		for _, v := range values {
+			std += math.Pow(v-mean, 2.0)
+		}
+		std = math.Sqrt(std / float64(len(values)-1))
+	}
+	return mean, std, min, max
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"mexs/common"
+	"mexs/exchange"
+	"mexs/results"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// useDefaultSink makes sink the default sink of the results until the end of the test
+func useDefaultSink(t *testing.T, sink results.ResultSink) {
+	old := results.Default
+	results.Default = sink
+	t.Cleanup(func() { results.Default = old })
+}
+
+func TestRunBatchDerivesTheSeedAndEIDOfEachRun(t *testing.T) {
+	sink := &results.MemorySink{}
+	useDefaultSink(t, sink)
+	base := testConfig(t)
+	eidOf := func(i int) string { return base.EID + "_" + strconv.Itoa(i) }
+	// each market makes as many trades of 2 units as the number of its run
+	run := func(config ExperimentConfig) exchange.MarketResult {
+		i, _ := strconv.Atoi(config.EID[len(base.EID)+1:])
+		market := exchange.MarketResult{EID: config.EID}
+		for j := 0; j < i; j++ {
+			market.Trades = append(market.Trades, exchange.TradeResult{Day: 0, Price: 100, Quantity: 2})
+		}
+		return market
+	}
+
+	alone := runBatch(base, 5, 1, eidOf, run)
+	pool := runBatch(base, 5, 3, eidOf, run)
+	if !reflect.DeepEqual(alone, pool) {
+		t.Errorf("runs over 3 goroutines are %v, want %v", pool, alone)
+	}
+
+	for i, s := range pool {
+		seed := common.DeriveSeed(base.Seed, "run", i)
+		if s.Run != i || s.EID != eidOf(i) || s.Seed != seed {
+			t.Errorf("run %d is %d %s with seed %d, want %s with seed %d", i, s.Run, s.EID, s.Seed, eidOf(i), seed)
+		}
+		if s.Trades != i || s.Volume != 2*i {
+			t.Errorf("run %d made %d trades of %d units, want %d of %d", i, s.Trades, s.Volume, i, 2*i)
+		}
+		table, ok := sink.Table(s.EID, "SEED")
+		if !ok || table.Rows[0][0] != strconv.FormatInt(seed, 10) {
+			t.Errorf("run %d recorded seed %v, want %d", i, table.Rows, seed)
+		}
+	}
+}
+
+func TestWriteSummaryDescribesTheRuns(t *testing.T) {
+	sink := &results.MemorySink{}
+	useDefaultSink(t, sink)
+	writeSummary("batch", []runSummary{
+		{Run: 0, EID: "batch_0", Seed: 7, Trades: 2, Volume: 4, Efficiency: 0.5, Alpha: 10},
+		{Run: 1, EID: "batch_1", Seed: 8, Trades: 4, Volume: 6, Efficiency: 1, Alpha: 20},
+		// a run with no equilibrium only counts towards the trades and volume
+		{Run: 2, EID: "batch_2", Seed: 9, Trades: 6, Volume: 8, Efficiency: math.NaN(), Alpha: math.NaN()},
+	})
+
+	runs, ok := sink.Table("batch", "RUNS")
+	if !ok || len(runs.Rows) != 3 {
+		t.Fatalf("RUNS has %v", runs.Rows)
+	}
+	if want := []string{"1", "batch_1", "8", "4", "6", "1.00000", "20.00000"}; !reflect.DeepEqual(runs.Rows[1], want) {
+		t.Errorf("run 1 is %v, want %v", runs.Rows[1], want)
+	}
+
+	summary, ok := sink.Table("batch", "SUMMARY")
+	want := [][]string{
+		{"Trades", "4.00000", "2.00000", "2.00000", "6.00000", "3"},
+		{"Volume", "6.00000", "2.00000", "4.00000", "8.00000", "3"},
+		{"Efficiency", "0.75000", "0.35355", "0.50000", "1.00000", "2"},
+		{"Alpha", "15.00000", "7.07107", "10.00000", "20.00000", "2"},
+	}
+	if !ok || !reflect.DeepEqual(summary.Rows, want) {
+		t.Errorf("SUMMARY is %v, want %v", summary.Rows, want)
+	}
+}
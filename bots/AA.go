@@ -1,72 +1,70 @@
 package bots
 
 import (
-	"mexs/common"
-	"math/rand"
 	"errors"
-	"os"
-	"encoding/csv"
-	"strconv"
 	"fmt"
-	"path/filepath"
 	log "github.com/sirupsen/logrus"
-
 	"math"
+	"math/rand"
+	"mexs/common"
+	"mexs/results"
+	"strconv"
 	"time"
 )
 
 // Most of the code in this file is a port of Dave cliff
-//implementation of AA that can be found on BristolStockEchange
+// implementation of AA that can be found on BristolStockEchange
 type AATrader struct {
 	Info RobotCore
 	//External parameters
-	spinUpTime int
-	eta float64
-	thetaMax float64
-	thetaMin float64
-	lambdaA float64
-	lambdaR float64
-	beta1 float64
-	beta2 float64
-	gamma float64
-	nLastTrades int
-	ema float64
+	spinUpTime     int
+	eta            float64
+	thetaMax       float64
+	thetaMin       float64
+	lambdaA        float64
+	lambdaR        float64
+	beta1          float64
+	beta2          float64
+	gamma          float64
+	nLastTrades    int
+	ema            float64
 	maxNewtonItter int
 	maxNewtonError float64
 
 	// Internal params
-	equilibrium float64
-	theta float64
-	smithsAlpha float64
+	equilibrium    float64
+	theta          float64
+	smithsAlpha    float64
 	smithsAlphaMin float64
 	smithsAlphaMax float64
 
-	agresBuy float64
-	agresSell float64
-	targetBuy float64
+	agresBuy   float64
+	agresSell  float64
+	targetBuy  float64
 	targetSell float64
-	target float64
+	target     float64
 
 	// current job details
 	limitPrice float64
-	active bool
-	job *TraderOrder
+	active     bool
+	job        *TraderOrder
 
 	// Parameters describing market
 	prevBestBid float64
 	prevBestAsk float64
-	lastTrades []float64
+	lastTrades  []float64
 }
 
-func (t *AATrader) InitRobotCore(id int, sellerOrBuyer string, marketInfo common.MarketInfo) {
+func (t *AATrader) InitRobotCore(id int, sellerOrBuyer string, marketInfo common.MarketInfo, rng *rand.Rand) {
 	t.Info = RobotCore{
-		TraderID: id,
-		Type: "AA",
-		SellerOrBuyer: sellerOrBuyer,
+		TraderID:        id,
+		Type:            "AA",
+		SellerOrBuyer:   sellerOrBuyer,
 		ExecutionOrders: []*TraderOrder{},
-		MarketInfo: marketInfo,
-		ActiveOrders: map[int]*common.Order{},
-		Balance: 0,
+		MarketInfo:      marketInfo,
+		ActiveOrders:    map[int]*common.Order{},
+		Balance:         0,
+		Rand:            rng,
 	}
 
 	t.spinUpTime = 20
@@ -85,10 +83,10 @@ func (t *AATrader) InitRobotCore(id int, sellerOrBuyer string, marketInfo common
 
 	t.active = false
 
-	t.theta = -1.0 * (5.0 * rand.Float64())
+	t.theta = -1.0 * (5.0 * t.Info.Rand.Float64())
 
-	t.agresBuy = -1.0 * 0.3 * rand.Float64()
-	t.agresSell = -1.0 * 0.3 * rand.Float64()
+	t.agresBuy = -1.0 * 0.3 * t.Info.Rand.Float64()
+	t.agresSell = -1.0 * 0.3 * t.Info.Rand.Float64()
 	t.lastTrades = []float64{}
 
 	// Uninitialized values
@@ -103,6 +101,10 @@ func (t *AATrader) InitRobotCore(id int, sellerOrBuyer string, marketInfo common
 }
 
 func (t *AATrader) SetOrders(orders []*TraderOrder) {
+	// A quote made for another limit price is pulled from the book
+	if t.active && len(orders) > 0 && t.limitPrice != orders[0].LimitPrice {
+		t.Info.PullQuote()
+	}
 	t.Info.ExecutionOrders = orders
 }
 
@@ -115,94 +117,31 @@ func (t *AATrader) RemoveOrder() error {
 		return errors.New("no order to be removed")
 	}
 
-	t.Info.ExecutionOrders = t.Info.ExecutionOrders[:len(t.Info.ExecutionOrders)-1]
+	t.Info.ExecutionOrders = t.Info.ExecutionOrders[1:]
 	if len(t.Info.ExecutionOrders) != 0 {
 		t.limitPrice = t.Info.ExecutionOrders[0].LimitPrice
 	}
 	return nil
 }
 
-func (t *AATrader) LogBalance(fileName string, day int, trade *common.Trade) {
-	fileName, err := filepath.Abs(fileName + "/AATradersLog.csv")
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": day,
-			"error":       err.Error(),
-		}).Error("File Path not found")
-		return
-	}
-
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
-	}
-
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file.Close()
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": day,
-			"error":       err.Error(),
-		}).Error("AA trader CSV file could not be made")
-		return
-	}
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	if addHeader {
-		writer.Write([]string{"Day", "TimeStep", "TID", "TradeID", "Profit", "TPrice"})
-	}
-
-	writer.Write([]string{
+func (t *AATrader) LogBalance(eid string, day int, trade *common.Trade) {
+	results.Save(t.Info.sink(), eid, "AATradersLog", []string{"Day", "TimeStep", "TID", "TradeID", "Profit", "TPrice"}, [][]string{{
 		strconv.Itoa(day),
 		strconv.Itoa(trade.TimeStep),
 		strconv.Itoa(t.Info.TraderID),
 		strconv.Itoa(trade.TradeID),
 		fmt.Sprintf("%.5f", t.Info.Balance),
 		fmt.Sprintf("%.5f", trade.Price),
-	})
+	}})
 }
 
-func (t *AATrader) LogOrder(fileName string, d, ts, tradeID int, tPrice float64) {
+func (t *AATrader) LogOrder(eid string, d, ts, tradeID int, tPrice float64) {
 	if len(t.Info.ExecutionOrders) == 0 {
 		log.Warn("Log order called with no orders")
 		return
 	}
 	// For now assume agents have only one order at a time
-	fileName, err := filepath.Abs(fileName)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": d,
-			"error":       err.Error(),
-		}).Error("File Path not found")
-		return
-	}
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
-	}
-
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file.Close()
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": d,
-			"error":       err.Error(),
-		}).Error("AA exec order CSV file could not be made")
-		return
-	}
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	if addHeader {
-		writer.Write([]string{"Day", "TimeStep", "TID", "TradeID", "LimitPrice", "TPrice", "OType", "Algo"})
-	}
-
-	writer.Write([]string{
+	results.Save(t.Info.sink(), eid, "ExecOrders", []string{"Day", "TimeStep", "TID", "TradeID", "LimitPrice", "TPrice", "OType", "Algo"}, [][]string{{
 		strconv.Itoa(d),
 		strconv.Itoa(ts),
 		strconv.Itoa(t.Info.TraderID),
@@ -211,14 +150,30 @@ func (t *AATrader) LogOrder(fileName string, d, ts, tradeID int, tPrice float64)
 		fmt.Sprintf("%.5f", tPrice),
 		t.Info.ExecutionOrders[0].Type,
 		"AA",
-	})
+	}})
 }
 
 func (t *AATrader) GetExecutionOrder() []*TraderOrder {
 	return t.Info.ExecutionOrders
 }
 
+func (t *AATrader) Charge(fee float64) {
+	t.Info.Charge(fee)
+}
+
+func (t *AATrader) SetSink(sink results.ResultSink) {
+	t.Info.Sink = sink
+}
+
+func (t *AATrader) GetBalance() float64 {
+	return t.Info.Balance
+}
+
 func (t *AATrader) GetOrder(timeStep int) *common.Order {
+	if cancel := t.Info.CancelRequest(timeStep); cancel != nil {
+		return cancel
+	}
+
 	if len(t.Info.ExecutionOrders) == 0 {
 		t.active = false
 		t.job = &TraderOrder{Type: "NA"}
@@ -234,36 +189,42 @@ func (t *AATrader) GetOrder(timeStep int) *common.Order {
 	t.updateTarget()
 
 	var quotePrice float64
-	 // TODO: change target Buy target sell to target??
+	// TODO: change target Buy target sell to target??
 	if t.job.IsBid() {
 		if t.spinUpTime > 0 {
-			askPlus := (1 + t.lambdaR) * t.prevBestAsk +t.lambdaA
+			askPlus := (1+t.lambdaR)*t.prevBestAsk + t.lambdaA
 			quotePrice = t.prevBestBid +
-				(math.Min(t.limitPrice, askPlus) - t.prevBestBid) / t.eta
+				(math.Min(t.limitPrice, askPlus)-t.prevBestBid)/t.eta
 		} else {
-			quotePrice = t.prevBestBid + (t.targetBuy - t.prevBestBid) / t.eta
+			quotePrice = t.prevBestBid + (t.targetBuy-t.prevBestBid)/t.eta
 		}
 	} else {
 		if t.spinUpTime > 0 {
-			bidMinus := (1 - t.lambdaR) * t.prevBestBid - t.lambdaA
+			bidMinus := (1-t.lambdaR)*t.prevBestBid - t.lambdaA
 			quotePrice = t.prevBestAsk -
-				(t.prevBestAsk - math.Max(t.limitPrice, bidMinus)) / t.eta
+				(t.prevBestAsk-math.Max(t.limitPrice, bidMinus))/t.eta
 		} else {
-			quotePrice = t.prevBestAsk - (t.prevBestAsk - t.targetSell) / t.eta
+			quotePrice = t.prevBestAsk - (t.prevBestAsk-t.targetSell)/t.eta
 		}
 	}
 
-	return &common.Order{
-		TraderID: t.Info.TraderID,
+	quote := &common.Order{
+		TraderID:  t.Info.TraderID,
 		OrderType: t.job.Type,
-		Price: quotePrice,
-		Quantity: t.job.Quantity,
-		TimeStep: timeStep,
-		Time: time.Now(),
-	}
+		Price:     quotePrice,
+		Quantity:  t.job.Quantity,
+		TimeStep:  timeStep,
+		Time:      time.Now(),
+		Symbol:    t.job.Symbol,
+	}
+	t.Info.LastQuote = quote
+	return quote
 }
 
-func (t *AATrader) 	MarketUpdate(update common.MarketUpdate) {
+func (t *AATrader) MarketUpdate(update common.MarketUpdate) {
+	if !t.Info.Follows(update.Symbol) {
+		return
+	}
 	// bid LOB
 	bidImproved := false
 	bidHit := false
@@ -272,7 +233,7 @@ func (t *AATrader) 	MarketUpdate(update common.MarketUpdate) {
 			bidImproved = true
 		} else if update.LastTrade.TimeStep == update.TimeStep &&
 			(t.prevBestBid >= update.BestBid || t.prevBestBid == -1) {
-				bidHit = true
+			bidHit = true
 		}
 	} else if t.prevBestBid != -1 {
 		bidHit = true
@@ -297,7 +258,7 @@ func (t *AATrader) 	MarketUpdate(update common.MarketUpdate) {
 	t.prevBestBid = update.BestBid
 
 	if t.spinUpTime > 0 {
-		t.spinUpTime --
+		t.spinUpTime--
 	}
 
 	if deal {
@@ -331,27 +292,24 @@ func (t *AATrader) 	MarketUpdate(update common.MarketUpdate) {
 	t.updateTarget()
 }
 
-func (t *AATrader) TradeMade(trade *common.Trade) bool {
-	t.Info.TradeRecord = append(t.Info.TradeRecord, trade)
-	if trade.SellOrder.TraderID == t.Info.TraderID {
-		t.Info.Balance += trade.Price - t.Info.ExecutionOrders[0].LimitPrice
-	} else {
-		t.Info.Balance += t.Info.ExecutionOrders[0].LimitPrice - trade.Price
+func (t *AATrader) TradeMade(trade *common.Trade) (bool, float64) {
+	l, done := t.Info.ExecuteTrade(trade)
+	if done {
+		t.RemoveOrder()
 	}
 
-	t.RemoveOrder()
 	if len(t.Info.ExecutionOrders) == 0 {
 		t.active = false
 	}
 
-	return true
+	return true, l
 }
 
 // AA Helper functions
 func (t AATrader) calcRShout(target float64, buying bool) float64 {
 	if buying {
 		// Extramarginal
-		if t.equilibrium >= t.limitPrice{
+		if t.equilibrium >= t.limitPrice {
 			return 0.0
 		}
 		if target > t.equilibrium {
@@ -359,13 +317,13 @@ func (t AATrader) calcRShout(target float64, buying bool) float64 {
 			if target > t.limitPrice {
 				newTarget = t.limitPrice
 			}
-			rShout := math.Log((((newTarget - t.equilibrium) *
-				(math.Exp(t.theta) -1)) / (t.limitPrice - t.equilibrium)) + 1) / t.theta
-			return  rShout
+			rShout := math.Log((((newTarget-t.equilibrium)*
+				(math.Exp(t.theta)-1))/(t.limitPrice-t.equilibrium))+1) / t.theta
+			return rShout
 		}
-		rShout := math.Log((1 - (target / t.equilibrium)) *
-			(math.Exp(t.newton4Buying()) -1 ) + 1) / (- t.newton4Buying())
-		return  rShout
+		rShout := math.Log((1-(target/t.equilibrium))*
+			(math.Exp(t.newton4Buying())-1)+1) / (-t.newton4Buying())
+		return rShout
 	}
 
 	// selling
@@ -373,21 +331,21 @@ func (t AATrader) calcRShout(target float64, buying bool) float64 {
 		return 0.0
 	}
 	if target > t.equilibrium {
-		rShout := math.Log(((target - t.equilibrium) *
-			(math.Exp(t.newton4Selling()) - 1)) /
-				(t.Info.MarketInfo.MaxPrice - t.equilibrium) + 1) / (-t.newton4Selling())
-		return  rShout
+		rShout := math.Log(((target-t.equilibrium)*
+			(math.Exp(t.newton4Selling())-1))/
+			(t.Info.MarketInfo.MaxPrice-t.equilibrium)+1) / (-t.newton4Selling())
+		return rShout
 	}
 	newTarget := target
 	if target < t.limitPrice {
 		newTarget = t.limitPrice
 	}
-	rShout := math.Log((1 - (newTarget -t.limitPrice) / (t.equilibrium - t.limitPrice)) *
-		(math.Exp(t.theta) -1) + 1) / t.theta
-	return  rShout
+	rShout := math.Log((1-(newTarget-t.limitPrice)/(t.equilibrium-t.limitPrice))*
+		(math.Exp(t.theta)-1)+1) / t.theta
+	return rShout
 }
 
-func (t *AATrader) updateAgg(up , buying bool, target float64) float64 {
+func (t *AATrader) updateAgg(up, buying bool, target float64) float64 {
 	oldAgg := t.agresSell
 	if buying {
 		oldAgg = t.agresBuy
@@ -395,12 +353,12 @@ func (t *AATrader) updateAgg(up , buying bool, target float64) float64 {
 
 	var delta float64
 	if up {
-		delta = (1 + t.lambdaR) * t.calcRShout(target, buying) + t.lambdaA
+		delta = (1+t.lambdaR)*t.calcRShout(target, buying) + t.lambdaA
 	} else {
-		delta = (1 - t.lambdaR) * t.calcRShout(target, buying) - t.lambdaA
+		delta = (1-t.lambdaR)*t.calcRShout(target, buying) - t.lambdaA
 	}
 
-	newAgg := oldAgg + t.beta1 * (delta -oldAgg)
+	newAgg := oldAgg + t.beta1*(delta-oldAgg)
 	if newAgg > 1.0 {
 		newAgg = 0
 	} else if newAgg < 0.0 {
@@ -411,25 +369,25 @@ func (t *AATrader) updateAgg(up , buying bool, target float64) float64 {
 
 func (t *AATrader) updateTheta() {
 	alphaBar := (t.smithsAlpha - t.smithsAlphaMin) / (t.smithsAlphaMax - t.smithsAlphaMin)
-	desiredTheta := (t.thetaMax -t.thetaMin) * (1 -(alphaBar *
-		math.Exp(t.gamma * (alphaBar - 1)))) + t.thetaMin
-	theta := t.theta + t.beta2 * (desiredTheta - t.theta)
+	desiredTheta := (t.thetaMax-t.thetaMin)*(1-(alphaBar*
+		math.Exp(t.gamma*(alphaBar-1)))) + t.thetaMin
+	theta := t.theta + t.beta2*(desiredTheta-t.theta)
 	if theta == 0.0 {
 		theta += 0.0000001
 	}
 	t.theta = theta
 }
 
-func (t * AATrader) updateSmithsAlpha(price float64){
+func (t *AATrader) updateSmithsAlpha(price float64) {
 	t.lastTrades = append(t.lastTrades, price)
 	if !(len(t.lastTrades) <= t.nLastTrades) {
 		t.lastTrades = t.lastTrades[1:]
 	}
 	sum := 0.0
 	for _, v := range t.lastTrades {
-		sum += math.Pow(v - t.equilibrium,2)
+		sum += math.Pow(v-t.equilibrium, 2)
 	}
-	t.smithsAlpha = math.Sqrt(sum * (1 / float64(len(t.lastTrades)))) / t.equilibrium
+	t.smithsAlpha = math.Sqrt(sum*(1/float64(len(t.lastTrades)))) / t.equilibrium
 
 	if t.smithsAlphaMin == -1.0 {
 		t.smithsAlphaMin = t.smithsAlpha
@@ -448,7 +406,7 @@ func (t *AATrader) updateEq(price float64) {
 	if t.equilibrium == -1 {
 		t.equilibrium = price
 	} else {
-		t.equilibrium = t.ema * price + (1 - t.ema) * t.equilibrium
+		t.equilibrium = t.ema*price + (1-t.ema)*t.equilibrium
 	}
 }
 
@@ -456,22 +414,22 @@ func (t *AATrader) updateTarget() {
 	// For buying
 	if t.limitPrice < t.equilibrium {
 		// Extra-marginal buyer
-		if t.agresBuy >= 0{
+		if t.agresBuy >= 0 {
 			t.targetBuy = t.limitPrice
 		} else {
 			t.targetBuy = t.limitPrice *
-				(1 - (math.Exp(-t.agresBuy * t.theta) -1 )) /
+				(1 - (math.Exp(-t.agresBuy*t.theta) - 1)) /
 				(math.Exp(t.theta) - 1.0)
 		}
 	} else {
 		// Intra-marginal buyer
-		if t.agresBuy >=0 {
-			t.targetBuy = t.equilibrium + (t.limitPrice - t.equilibrium) *
-				((math.Exp(t.agresBuy * t.theta) - 1) / (math.Exp(t.theta) - 1))
+		if t.agresBuy >= 0 {
+			t.targetBuy = t.equilibrium + (t.limitPrice-t.equilibrium)*
+				((math.Exp(t.agresBuy*t.theta)-1)/(math.Exp(t.theta)-1))
 		} else {
 			thetaEst := t.newton4Buying()
 			t.targetBuy = t.equilibrium *
-				(1 - (math.Exp(-t.agresBuy * thetaEst) - 1) / (math.Exp(thetaEst) - 1))
+				(1 - (math.Exp(-t.agresBuy*thetaEst)-1)/(math.Exp(thetaEst)-1))
 		}
 	}
 
@@ -481,28 +439,28 @@ func (t *AATrader) updateTarget() {
 			t.targetSell = t.limitPrice
 		} else {
 			t.targetSell = t.limitPrice +
-				(t.Info.MarketInfo.MaxPrice - t.equilibrium) *
-					((math.Exp(-t.agresSell * t.theta) - 1) / (math.Exp(t.theta) - 1))
+				(t.Info.MarketInfo.MaxPrice-t.equilibrium)*
+					((math.Exp(-t.agresSell*t.theta)-1)/(math.Exp(t.theta)-1))
 		}
 	} else {
 		// Intra-marginal seller
 		if t.agresSell >= 0 {
-			t.targetSell = t.limitPrice + (t.equilibrium -t.limitPrice) *
-				(1 - (math.Exp(t.agresSell * t.theta) -1) / (math.Exp(t.theta) -1 ))
+			t.targetSell = t.limitPrice + (t.equilibrium-t.limitPrice)*
+				(1-(math.Exp(t.agresSell*t.theta)-1)/(math.Exp(t.theta)-1))
 		} else {
 			thetaEst := t.newton4Selling()
 			t.targetSell = t.equilibrium +
-				(t.Info.MarketInfo.MaxPrice - t.equilibrium) *
-					((math.Exp(-t.agresSell * thetaEst) -1) / (math.Exp(thetaEst) - 1))
+				(t.Info.MarketInfo.MaxPrice-t.equilibrium)*
+					((math.Exp(-t.agresSell*thetaEst)-1)/(math.Exp(thetaEst)-1))
 		}
 	}
 }
 
 func (t *AATrader) newton4Buying() float64 {
 	thetaEst := t.theta
-	rightHSide := (t.theta * (t.limitPrice - t.equilibrium)) / (math.Exp(t.theta) -1)
+	rightHSide := (t.theta * (t.limitPrice - t.equilibrium)) / (math.Exp(t.theta) - 1)
 
-	for i := 0; i <= t.maxNewtonItter ; i++ {
+	for i := 0; i <= t.maxNewtonItter; i++ {
 		eX := math.Exp(thetaEst)
 		exMinOne := eX - 1
 		fofX := ((thetaEst * t.equilibrium) / exMinOne) - rightHSide
@@ -510,7 +468,7 @@ func (t *AATrader) newton4Buying() float64 {
 			break
 		}
 		dfofx := (t.equilibrium / exMinOne) -
-			(eX * t.equilibrium * thetaEst) / (exMinOne * exMinOne)
+			(eX*t.equilibrium*thetaEst)/(exMinOne*exMinOne)
 		thetaEst = thetaEst - (fofX / dfofx)
 	}
 	if thetaEst == 0.0 {
@@ -522,7 +480,7 @@ func (t *AATrader) newton4Buying() float64 {
 func (t *AATrader) newton4Selling() float64 {
 	thetaEst := t.theta
 	rightHSide := (t.theta * (t.equilibrium - t.limitPrice)) / (math.Exp(t.theta) - 1)
-	for i:=0; i <= t.maxNewtonItter; i++{
+	for i := 0; i <= t.maxNewtonItter; i++ {
 		eX := math.Exp(thetaEst)
 		exMinOne := eX - 1
 		fofX := ((thetaEst * (t.Info.MarketInfo.MaxPrice - t.equilibrium)) /
@@ -531,7 +489,7 @@ func (t *AATrader) newton4Selling() float64 {
 			break
 		}
 
-		dfofx := ((t.Info.MarketInfo.MaxPrice - t.equilibrium)/ exMinOne) -
+		dfofx := ((t.Info.MarketInfo.MaxPrice - t.equilibrium) / exMinOne) -
 			((eX * (t.Info.MarketInfo.MaxPrice - t.equilibrium) * thetaEst) /
 				(exMinOne * exMinOne))
 		thetaEst = thetaEst - (fofX / dfofx)
@@ -544,4 +502,4 @@ func (t *AATrader) newton4Selling() float64 {
 	return thetaEst
 }
 
-var _ RobotTrader = (*AATrader)(nil)
\ No newline at end of file
+var _ RobotTrader = (*AATrader)(nil)
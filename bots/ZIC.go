@@ -1,14 +1,12 @@
 package bots
 
 import (
-	"math/rand"
-	"encoding/csv"
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"math/rand"
 	"mexs/common"
-	"os"
-	"path/filepath"
+	"mexs/results"
 	"strconv"
 	"time"
 )
@@ -17,7 +15,7 @@ type ZICTrader struct {
 	Info RobotCore
 }
 
-func (t *ZICTrader) InitRobotCore(id int, sellerOrBuyer string, marketInfo common.MarketInfo) {
+func (t *ZICTrader) InitRobotCore(id int, sellerOrBuyer string, marketInfo common.MarketInfo, rng *rand.Rand) {
 	t.Info = RobotCore{
 		TraderID:        id,
 		Type:            "ZIC",
@@ -26,6 +24,7 @@ func (t *ZICTrader) InitRobotCore(id int, sellerOrBuyer string, marketInfo commo
 		MarketInfo:      marketInfo,
 		ActiveOrders:    map[int]*common.Order{},
 		Balance:         0,
+		Rand:            rng,
 	}
 }
 
@@ -55,7 +54,7 @@ func (t *ZICTrader) GetOrder(timeStep int) *common.Order {
 	}
 
 	if order.IsBid() {
-		bidPrice := float64(rand.Intn(int(order.LimitPrice + 1.0 - t.Info.MarketInfo.MinPrice))) + t.Info.MarketInfo.MinPrice
+		bidPrice := float64(t.Info.Rand.Intn(int(order.LimitPrice+1.0-t.Info.MarketInfo.MinPrice))) + t.Info.MarketInfo.MinPrice
 
 		marketOrder := &common.Order{
 			TraderID:  t.Info.TraderID,
@@ -65,13 +64,14 @@ func (t *ZICTrader) GetOrder(timeStep int) *common.Order {
 			Quantity: order.Quantity,
 			TimeStep: timeStep,
 			Time:     time.Now(),
+			Symbol:   order.Symbol,
 		}
 
 		t.Info.ActiveOrders[timeStep] = marketOrder
 		return marketOrder
 	}
 
-	askPrice := float64(rand.Intn(int(t.Info.MarketInfo.MaxPrice - order.LimitPrice))) + order.LimitPrice
+	askPrice := float64(t.Info.Rand.Intn(int(t.Info.MarketInfo.MaxPrice-order.LimitPrice))) + order.LimitPrice
 
 	marketOrder := &common.Order{
 		TraderID:  t.Info.TraderID,
@@ -81,6 +81,7 @@ func (t *ZICTrader) GetOrder(timeStep int) *common.Order {
 		Quantity: order.Quantity,
 		TimeStep: timeStep,
 		Time:     time.Now(),
+		Symbol:   order.Symbol,
 	}
 
 	t.Info.ActiveOrders[timeStep] = marketOrder
@@ -113,23 +114,18 @@ func (t *ZICTrader) TradeMade(trade *common.Trade) (bool, float64) {
 	// For system with multiple order queueing and that allows
 	// canceling this should be part of a second function such as confirm trade
 	// ignore for now as it is async and without order queueing for the time being
-	t.Info.TradeRecord = append(t.Info.TradeRecord, trade)
 	// For now assume that the is only one order thus trade ...
 	//  ... must match first order in order array..
 	// ... this could cause problems in async so should be changed in
 	// ... the future
 
-	// This code also assumes quantity matches, if it does not it
-	// ... should update execute order for correct quantity and limit price
-	l := t.Info.ExecutionOrders[0].LimitPrice
-	if trade.SellOrder.TraderID == t.Info.TraderID {
-		t.Info.Balance += trade.Price - t.Info.ExecutionOrders[0].LimitPrice
-	} else {
-		t.Info.Balance += t.Info.ExecutionOrders[0].LimitPrice - trade.Price
+	// Partial fills only reduce the quantity of the execution order, it is
+	// removed once all its units have been traded
+	l, done := t.Info.ExecuteTrade(trade)
+	if done {
+		t.RemoveOrder()
 	}
 
-	t.RemoveOrder()
-
 	// In case trade is no longer possible this should return false
 	// May be necessary for async markets
 	return true, l
@@ -144,86 +140,35 @@ func (t *ZICTrader) GetExecutionOrder() []*TraderOrder {
 	return t.Info.ExecutionOrders
 }
 
-func (t *ZICTrader) LogBalance(fileName string, day int, trade *common.Trade) {
-	fileName, err := filepath.Abs(fileName + "/ZICTradersLog.csv")
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": day,
-			"error":       err.Error(),
-		}).Error("File Path not found")
-		return
-	}
-
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
-	}
-
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file.Close()
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": day,
-			"error":       err.Error(),
-		}).Error("ZIC trader CSV file could not be made")
-		return
-	}
+func (t *ZICTrader) Charge(fee float64) {
+	t.Info.Charge(fee)
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+func (t *ZICTrader) SetSink(sink results.ResultSink) {
+	t.Info.Sink = sink
+}
 
-	if addHeader {
-		writer.Write([]string{"Day", "TimeStep", "TID", "TradeID", "Profit", "TPrice"})
-	}
+func (t *ZICTrader) GetBalance() float64 {
+	return t.Info.Balance
+}
 
-	writer.Write([]string{
+func (t *ZICTrader) LogBalance(eid string, day int, trade *common.Trade) {
+	results.Save(t.Info.sink(), eid, "ZICTradersLog", []string{"Day", "TimeStep", "TID", "TradeID", "Profit", "TPrice"}, [][]string{{
 		strconv.Itoa(day),
 		strconv.Itoa(trade.TimeStep),
 		strconv.Itoa(t.Info.TraderID),
 		strconv.Itoa(trade.TradeID),
 		fmt.Sprintf("%.5f", t.Info.Balance),
 		fmt.Sprintf("%.5f", trade.Price),
-	})
+	}})
 }
 
-func (t *ZICTrader) LogOrder(fileName string, d, ts, tradeID int, tPrice float64) {
+func (t *ZICTrader) LogOrder(eid string, d, ts, tradeID int, tPrice float64) {
 	if len(t.Info.ExecutionOrders) == 0 {
 		return
 	}
 	// For now assume agents have only one order at a time
-	fileName, err := filepath.Abs(fileName)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": d,
-			"error":       err.Error(),
-		}).Error("File Path not found")
-		return
-	}
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
-	}
-
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file.Close()
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": d,
-			"error":       err.Error(),
-		}).Error("ZIP exec order CSV file could not be made")
-		return
-	}
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	if addHeader {
-		writer.Write([]string{"Day", "TimeStep", "TID", "TradeID", "LimitPrice", "TPrice", "OType"})
-	}
-
-	writer.Write([]string{
+	results.Save(t.Info.sink(), eid, "ExecOrders", []string{"Day", "TimeStep", "TID", "TradeID", "LimitPrice", "TPrice", "OType"}, [][]string{{
 		strconv.Itoa(d),
 		strconv.Itoa(ts),
 		strconv.Itoa(t.Info.TraderID),
@@ -231,7 +176,7 @@ func (t *ZICTrader) LogOrder(fileName string, d, ts, tradeID int, tPrice float64
 		fmt.Sprintf("%.5f", t.Info.ExecutionOrders[0].LimitPrice),
 		fmt.Sprintf("%.5f", tPrice),
 		t.Info.ExecutionOrders[0].Type,
-	})
+	}})
 }
 
 // Check robot interface correctly implemented
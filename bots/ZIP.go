@@ -6,14 +6,12 @@ package bots
 // better fit this simulator, but it still makes the same decisions overall.
 
 import (
-	"encoding/csv"
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"math/rand"
 	"mexs/common"
-	"os"
-	"path/filepath"
+	"mexs/results"
 	"sort"
 	"strconv"
 	"time"
@@ -39,7 +37,7 @@ type ZIPTrader struct {
 	prevBestAskQty   int
 }
 
-func (t *ZIPTrader) InitRobotCore(id int, sellerOrBuyer string, marketInfo common.MarketInfo) {
+func (t *ZIPTrader) InitRobotCore(id int, sellerOrBuyer string, marketInfo common.MarketInfo, rng *rand.Rand) {
 	t.Info = RobotCore{
 		TraderID:        id,
 		Type:            "ZIP",
@@ -48,17 +46,18 @@ func (t *ZIPTrader) InitRobotCore(id int, sellerOrBuyer string, marketInfo commo
 		MarketInfo:      marketInfo,
 		ActiveOrders:    map[int]*common.Order{},
 		Balance:         0,
+		Rand:            rng,
 	}
 
 	// Initialize ZIP parameters following Dave cliff 1997 paper procedure
 	t.active = false
 	t.lastDelta = 0.0
-	t.beta = 0.1 + 0.4*rand.Float64()
-	t.momentum = 0.2 + rand.Float64()*0.6
+	t.beta = 0.1 + 0.4*t.Info.Rand.Float64()
+	t.momentum = 0.2 + t.Info.Rand.Float64()*0.6
 	t.ca = 0.05 // t.ca & .cr were hard-coded in '97 but parameterised later
 	t.cr = 0.05
-	t.marginBuy = -(0.05 + 0.3*rand.Float64())
-	t.marginSell = 0.05 + 0.3*rand.Float64()
+	t.marginBuy = -(0.05 + 0.3*t.Info.Rand.Float64())
+	t.marginSell = 0.05 + 0.3*t.Info.Rand.Float64()
 	t.margin = 0.0
 	//t.marginBuy = 0.0
 	//t.marginSell = 0.0
@@ -74,6 +73,10 @@ func (t *ZIPTrader) setPrice() {
 }
 
 func (t *ZIPTrader) SetOrders(orders []*TraderOrder) {
+	// A quote made for another limit price is pulled from the book
+	if t.limitPrice != 0 && t.limitPrice != orders[0].LimitPrice {
+		t.Info.PullQuote()
+	}
 	t.Info.ExecutionOrders = orders
 
 	t.active = true
@@ -98,9 +101,9 @@ func (t *ZIPTrader) AddOrder(order *TraderOrder) {
 	t.Info.ExecutionOrders = append(t.Info.ExecutionOrders, order)
 }
 
-func (t *ZIPTrader) ResetMargins(orderType string){
-	t.marginBuy = -(0.05 + 0.3*rand.Float64())
-	t.marginSell = 0.05 + 0.3*rand.Float64()
+func (t *ZIPTrader) ResetMargins(orderType string) {
+	t.marginBuy = -(0.05 + 0.3*t.Info.Rand.Float64())
+	t.marginSell = 0.05 + 0.3*t.Info.Rand.Float64()
 	if orderType == "BID" {
 		t.margin = t.marginBuy
 	} else {
@@ -144,12 +147,16 @@ func (t *ZIPTrader) RemoveOrder() error {
 	t.Info.ExecutionOrders = t.Info.ExecutionOrders[1:]
 	if len(t.Info.ExecutionOrders) != 0 {
 		t.limitPrice = t.Info.ExecutionOrders[0].LimitPrice
-		t.DealWithMarginOnOrderChange(t.limitPrice,t.Info.ExecutionOrders[0].Type )
+		t.DealWithMarginOnOrderChange(t.limitPrice, t.Info.ExecutionOrders[0].Type)
 	}
 	return nil
 }
 
 func (t *ZIPTrader) GetOrder(timeStep int) *common.Order {
+	if cancel := t.Info.CancelRequest(timeStep); cancel != nil {
+		return cancel
+	}
+
 	if len(t.Info.ExecutionOrders) < 1 {
 		t.active = false
 		t.job = &TraderOrder{Type: "NA"}
@@ -191,12 +198,17 @@ func (t *ZIPTrader) GetOrder(timeStep int) *common.Order {
 		Quantity:  order.Quantity,
 		TimeStep:  timeStep,
 		Time:      time.Now(),
+		Symbol:    order.Symbol,
 	}
 	t.Info.ActiveOrders[timeStep] = marketOrder
+	t.Info.LastQuote = marketOrder
 	return marketOrder
 }
 
 func (t *ZIPTrader) MarketUpdate(update common.MarketUpdate) {
+	if !t.Info.Follows(update.Symbol) {
+		return
+	}
 	// assumes that a trader can not change from buyer to seller
 	// Sellers
 	if t.Info.SellerOrBuyer == "SELLER" {
@@ -307,13 +319,13 @@ func (t *ZIPTrader) willingToTrade(price float64) bool {
 func (t *ZIPTrader) targetUp(price float64) float64 {
 	//  Generate a higher target price by randomly perturbing given price
 	if t.Info.SellerOrBuyer == "SELLER" {
-		absolutePerturbation := t.ca * rand.Float64()
-		relativePerturbation := price * (1.0 + (t.cr * rand.Float64()))
+		absolutePerturbation := t.ca * t.Info.Rand.Float64()
+		relativePerturbation := price * (1.0 + (t.cr * t.Info.Rand.Float64()))
 		target := relativePerturbation + absolutePerturbation
 		return target
 	} else {
-		absolutePerturbation := t.ca * rand.Float64()
-		relativePerturbation := price * (1.0 - (t.cr * rand.Float64()))
+		absolutePerturbation := t.ca * t.Info.Rand.Float64()
+		relativePerturbation := price * (1.0 - (t.cr * t.Info.Rand.Float64()))
 		target := relativePerturbation - absolutePerturbation
 		return target
 	}
@@ -322,13 +334,13 @@ func (t *ZIPTrader) targetUp(price float64) float64 {
 func (t *ZIPTrader) targetDown(price float64) float64 {
 	//  Generate a lower target price by randomly perturbing given price
 	if t.Info.SellerOrBuyer == "SELLER" {
-		absolutePerturbation := t.ca * rand.Float64()
-		relativePerturbation := price * (1.0 - (t.cr * rand.Float64()))
+		absolutePerturbation := t.ca * t.Info.Rand.Float64()
+		relativePerturbation := price * (1.0 - (t.cr * t.Info.Rand.Float64()))
 		target := relativePerturbation - absolutePerturbation
 		return target
 	} else {
-		absolutePerturbation := t.ca * rand.Float64()
-		relativePerturbation := price * (1.0 + (t.cr * rand.Float64()))
+		absolutePerturbation := t.ca * t.Info.Rand.Float64()
+		relativePerturbation := price * (1.0 + (t.cr * t.Info.Rand.Float64()))
 		target := relativePerturbation + absolutePerturbation
 		return target
 	}
@@ -358,16 +370,11 @@ func (t *ZIPTrader) profitAlter(price float64) {
 
 func (t *ZIPTrader) TradeMade(trade *common.Trade) (bool, float64) {
 	// Got to ZIC.go to read about this function weaknesses and reasoning
-	t.Info.TradeRecord = append(t.Info.TradeRecord, trade)
-
-	l := t.Info.ExecutionOrders[0].LimitPrice
-	if trade.SellOrder.TraderID == t.Info.TraderID {
-		t.Info.Balance += trade.Price - t.Info.ExecutionOrders[0].LimitPrice
-	} else {
-		t.Info.Balance += t.Info.ExecutionOrders[0].LimitPrice - trade.Price
+	l, done := t.Info.ExecuteTrade(trade)
+	if done {
+		t.RemoveOrder()
 	}
 
-	t.RemoveOrder()
 	if len(t.Info.ExecutionOrders) == 0 {
 		t.active = false
 	}
@@ -379,87 +386,36 @@ func (t *ZIPTrader) GetExecutionOrder() []*TraderOrder {
 	return t.Info.ExecutionOrders
 }
 
-func (t *ZIPTrader) LogBalance(fileName string, day int, trade *common.Trade) {
-	fileName, err := filepath.Abs(fileName + "/ZIPTradersLog.csv")
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": day,
-			"error":       err.Error(),
-		}).Error("File Path not found")
-		return
-	}
-
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
-	}
-
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file.Close()
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": day,
-			"error":       err.Error(),
-		}).Error("ZIP trader CSV file could not be made")
-		return
-	}
+func (t *ZIPTrader) Charge(fee float64) {
+	t.Info.Charge(fee)
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+func (t *ZIPTrader) SetSink(sink results.ResultSink) {
+	t.Info.Sink = sink
+}
 
-	if addHeader {
-		writer.Write([]string{"Day", "TimeStep", "TID", "TradeID", "Profit", "TPrice"})
-	}
+func (t *ZIPTrader) GetBalance() float64 {
+	return t.Info.Balance
+}
 
-	writer.Write([]string{
+func (t *ZIPTrader) LogBalance(eid string, day int, trade *common.Trade) {
+	results.Save(t.Info.sink(), eid, "ZIPTradersLog", []string{"Day", "TimeStep", "TID", "TradeID", "Profit", "TPrice"}, [][]string{{
 		strconv.Itoa(day),
 		strconv.Itoa(trade.TimeStep),
 		strconv.Itoa(t.Info.TraderID),
 		strconv.Itoa(trade.TradeID),
 		fmt.Sprintf("%.5f", t.Info.Balance),
 		fmt.Sprintf("%.5f", trade.Price),
-	})
+	}})
 }
 
-func (t *ZIPTrader) LogOrder(fileName string, d, ts, tradeID int, tPrice float64) {
+func (t *ZIPTrader) LogOrder(eid string, d, ts, tradeID int, tPrice float64) {
 	if len(t.Info.ExecutionOrders) == 0 {
 		log.Warn("Log order called with no orders")
 		return
 	}
 	// For now assume agents have only one order at a time
-	fileName, err := filepath.Abs(fileName)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": d,
-			"error":       err.Error(),
-		}).Error("File Path not found")
-		return
-	}
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
-	}
-
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file.Close()
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": d,
-			"error":       err.Error(),
-		}).Error("ZIP exec order CSV file could not be made")
-		return
-	}
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	if addHeader {
-		writer.Write([]string{"Day", "TimeStep", "TID", "TradeID", "LimitPrice", "TPrice", "OType", "Algo"})
-	}
-
-	writer.Write([]string{
+	results.Save(t.Info.sink(), eid, "ExecOrders", []string{"Day", "TimeStep", "TID", "TradeID", "LimitPrice", "TPrice", "OType", "Algo"}, [][]string{{
 		strconv.Itoa(d),
 		strconv.Itoa(ts),
 		strconv.Itoa(t.Info.TraderID),
@@ -468,45 +424,14 @@ func (t *ZIPTrader) LogOrder(fileName string, d, ts, tradeID int, tPrice float64
 		fmt.Sprintf("%.5f", tPrice),
 		t.Info.ExecutionOrders[0].Type,
 		"ZIP",
-	})
+	}})
 }
 
+// LogMargin saves the margin of the agent to the ZIPMargin table, GA markets discard it
+// with the rest of their logs
 func (t *ZIPTrader) LogMargin(d, ts int, eid string) {
-	// NOTE: stop during GA test to speed up process
-	return
 	// For now assume agents have only one order at a time
-	fileName, err := filepath.Abs("../mexs/logs/" + eid + "/ZIPMargin.csv")
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": d,
-			"error":       err.Error(),
-		}).Error("File Path not found")
-		return
-	}
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
-	}
-
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file.Close()
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day": d,
-			"error":       err.Error(),
-		}).Error("ZIP margin CSV file could not be made")
-		return
-	}
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	if addHeader {
-		writer.Write([]string{"Day", "TimeStep", "TID", "Type", "LimitPrice", "Price", "Margin"})
-	}
-
-	writer.Write([]string{
+	results.Save(t.Info.sink(), eid, "ZIPMargin", []string{"Day", "TimeStep", "TID", "Type", "LimitPrice", "Price", "Margin"}, [][]string{{
 		strconv.Itoa(d),
 		strconv.Itoa(ts),
 		strconv.Itoa(t.Info.TraderID),
@@ -514,7 +439,7 @@ func (t *ZIPTrader) LogMargin(d, ts int, eid string) {
 		fmt.Sprintf("%.5f", t.limitPrice),
 		fmt.Sprintf("%.5f", t.price),
 		fmt.Sprintf("%.5f", t.margin),
-	})
+	}})
 }
 
 var _ RobotTrader = (*ZIPTrader)(nil)
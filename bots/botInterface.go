@@ -1,7 +1,10 @@
 package bots
 
 import (
+	"math/rand"
 	"mexs/common"
+	"mexs/results"
+	"time"
 )
 
 type RobotCore struct {
@@ -27,18 +30,66 @@ type RobotCore struct {
 	// Balance is money made by the agent
 	// Balance = LimitPrice - transaction price
 	Balance float64
+	// Fees is the money paid to the exchange, it is already taken from Balance
+	Fees float64
 
 	EID string
+	// LastQuote is the last bid or ask sent to the market
+	LastQuote *common.Order
+	// staleQuote is a resting quote to be pulled with the rest of its side in the next step
+	staleQuote *common.Order
+	// Rand is the random source of the agent, it is seeded from the run seed
+	Rand *rand.Rand
+	// Sink receives the logs of the agent, results.Default when nil
+	Sink results.ResultSink
+}
+
+func (rc *RobotCore) sink() results.ResultSink {
+	if rc.Sink == nil {
+		return results.Default
+	}
+	return rc.Sink
+}
+
+// PullQuote flags the quotes of the agent to be cancelled the next time it is asked for
+// an order, the request references the last quote and the exchange cancels every quote
+// queued on its side. It does nothing if the last quote is no longer in the book
+func (rc *RobotCore) PullQuote() {
+	if rc.LastQuote != nil && rc.LastQuote.OrderID > 0 && rc.LastQuote.Quantity > 0 {
+		rc.staleQuote = rc.LastQuote
+	}
+}
+
+// CancelRequest returns the PULL request for the quotes flagged by PullQuote or
+// nil when there is nothing to cancel
+func (rc *RobotCore) CancelRequest(timeStep int) *common.Order {
+	if rc.staleQuote == nil {
+		return nil
+	}
+
+	cancel := &common.Order{
+		OrderID:   rc.staleQuote.OrderID,
+		TraderID:  rc.TraderID,
+		OrderType: "PULL",
+		TimeStep:  timeStep,
+		Time:      time.Now(),
+		Symbol:    rc.staleQuote.Symbol,
+	}
+	rc.staleQuote = nil
+	rc.LastQuote = nil
+	return cancel
 }
 
 // TraderOrders encapsulate what the traders are supposed to do
 type TraderOrder struct {
 	LimitPrice float64
-	// Quantity for now will be set to 1 it can be change
-	// for more complicated simulations
+	// Quantity is the number of units still to be traded, it goes
+	// down as the agent orders are partially filled
 	Quantity int
 	// Type should be BID or ASK
 	Type string
+	// Symbol is the instrument to be traded, empty means common.DefaultSymbol
+	Symbol string
 }
 
 func (to *TraderOrder) IsValid() bool {
@@ -54,8 +105,58 @@ func (to *TraderOrder) IsAsk() bool {
 	return to.Type == "ASK"
 }
 
+func (to *TraderOrder) GetSymbol() string {
+	if to.Symbol == "" {
+		return common.DefaultSymbol
+	}
+	return to.Symbol
+}
+
+// Follows is true if the agent is working on an order of the instrument symbol,
+// agents with nothing to do follow every instrument
+func (rc *RobotCore) Follows(symbol string) bool {
+	if len(rc.ExecutionOrders) == 0 || symbol == "" {
+		return true
+	}
+	return rc.ExecutionOrders[0].GetSymbol() == symbol
+}
+
+// ExecuteTrade books a fill of the first execution order of the traded instrument,
+// that order is moved to the front if it was not there. It updates the balance
+// by the surplus of every unit traded and returns the limit price of the
+// execution order and whether the order has no units left
+func (rc *RobotCore) ExecuteTrade(trade *common.Trade) (float64, bool) {
+	rc.TradeRecord = append(rc.TradeRecord, trade)
+
+	for i, o := range rc.ExecutionOrders {
+		if o.GetSymbol() == trade.Symbol || trade.Symbol == "" {
+			copy(rc.ExecutionOrders[1:i+1], rc.ExecutionOrders[:i])
+			rc.ExecutionOrders[0] = o
+			break
+		}
+	}
+
+	order := rc.ExecutionOrders[0]
+	l := order.LimitPrice
+	if trade.SellOrder.TraderID == rc.TraderID {
+		rc.Balance += (trade.Price - l) * float64(trade.Quantity)
+	} else {
+		rc.Balance += (l - trade.Price) * float64(trade.Quantity)
+	}
+
+	order.Quantity -= trade.Quantity
+	return l, order.Quantity <= 0
+}
+
+// Charge takes a fee paid to the exchange from the balance
+func (rc *RobotCore) Charge(fee float64) {
+	rc.Balance -= fee
+	rc.Fees += fee
+}
+
 type RobotTrader interface {
-	InitRobotCore(id int, sellerOrBuyer string, marketInfo common.MarketInfo)
+	// InitRobotCore sets up the agent, rng is the source of all its random choices
+	InitRobotCore(id int, sellerOrBuyer string, marketInfo common.MarketInfo, rng *rand.Rand)
 	SetOrders(orders []*TraderOrder)
 	// Append execution order to array
 	AddOrder(order *TraderOrder)
@@ -66,6 +167,13 @@ type RobotTrader interface {
 	MarketUpdate(update common.MarketUpdate)
 	GetOrder(timeStep int) *common.Order
 	GetExecutionOrder() []*TraderOrder
-	LogBalance(fileName string, day int, trade *common.Trade)
-	LogOrder(fileName string, d, ts, tradeID int, tPrice float64)
+	// LogBalance and LogOrder save the agent state after a trade to the results of experiment eid
+	LogBalance(eid string, day int, trade *common.Trade)
+	LogOrder(eid string, d, ts, tradeID int, tPrice float64)
+	// Charge takes an exchange fee from the agent balance
+	Charge(fee float64)
+	// GetBalance returns the money made by the agent after fees
+	GetBalance() float64
+	// SetSink sets where the agent saves its logs, nil is results.Default
+	SetSink(sink results.ResultSink)
 }
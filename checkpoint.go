@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mexs/exchange"
+	"os"
+	"path/filepath"
+)
+
+// CheckpointFile is the name of the checkpoint in the folder of a GA
+const CheckpointFile = "checkpoint.json"
+
+// Checkpoint is the state of a GA between two generations, GA --resume continues from it
+type Checkpoint struct {
+	// Config is the config file of the GA with the seed and the command line options it ran with
+	Config ConfigFile
+	// Gen is the next generation to run and Population its individuals
+	Gen        int
+	Population []exchange.AuctionParameters
+	// Scores of the individuals of the last generation that was run and its best one
+	Scores     []float64
+	Elite      exchange.AuctionParameters
+	EliteScore float64
+	// EliteMarket is the market of the elite, it is the result of a GA that has no
+	// generation left to run
+	EliteMarket  exchange.MarketResult
+	MutationRate float64
+	// RNGDraws is the number of values drawn from the random source of the GA
+	RNGDraws uint64
+}
+
+// checkpoint saves the state of the GA before generation gen is run, the file is replaced
+// in one go so a crash never leaves half a checkpoint
+func (g *GA) checkpoint(gen int, scores []float64, elite exchange.AuctionParameters, eliteScore float64) {
+	cp := Checkpoint{
+		Config:       g.Config.Source,
+		Gen:          gen,
+		Population:   g.currentGenes,
+		Scores:       scores,
+		Elite:        elite,
+		EliteScore:   eliteScore,
+		EliteMarket:  g.Elite,
+		MutationRate: g.MutationRate,
+		RNGDraws:     g.rngSrc.Draws(),
+	}
+	if err := writeCheckpoint(g.CheckpointDir, cp); err != nil {
+		log.WithFields(log.Fields{
+			"EID":   g.Config.EID,
+			"Gen":   gen,
+			"error": err.Error(),
+		}).Error("Checkpoint could not be written")
+		return
+	}
+	log.WithFields(log.Fields{
+		"EID": g.Config.EID,
+		"Gen": gen,
+	}).Info("Checkpoint written")
+}
+
+func writeCheckpoint(dir string, cp Checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, CheckpointFile+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, CheckpointFile))
+}
+
+// ReadCheckpoint reads the checkpoint in the folder of a GA
+func ReadCheckpoint(dir string) (Checkpoint, error) {
+	var cp Checkpoint
+	data, err := ioutil.ReadFile(filepath.Join(dir, CheckpointFile))
+	if err != nil {
+		return cp, err
+	}
+	err = json.Unmarshal(data, &cp)
+	return cp, err
+}
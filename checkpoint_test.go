@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"mexs/exchange"
+	"mexs/results"
+	"reflect"
+	"testing"
+)
+
+// testGA is the GA of the test config writing to a memory sink and checkpointing to a temporary folder
+func testGA(t *testing.T, gens, checkpointEvery int) (*GA, *results.MemorySink) {
+	t.Helper()
+	configFile := testConfigFile(t)
+	configFile.Gens = gens
+	configFile.CheckpointEvery = checkpointEvery
+	config := buildConfig(configFile)
+
+	sink := &results.MemorySink{}
+	ga := newGA(config)
+	ga.Sink = sink
+	ga.CheckpointDir = t.TempDir()
+	return ga, sink
+}
+
+func sameMarket(t *testing.T, got, want exchange.MarketResult) {
+	t.Helper()
+	a, _ := json.Marshal(got)
+	b, _ := json.Marshal(want)
+	if string(a) != string(b) {
+		t.Errorf("elite market %s was restored as %s", want.EID, got.EID)
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	ga, _ := testGA(t, 2, 1)
+	ga.Start()
+
+	cp, err := ReadCheckpoint(ga.CheckpointDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Gen != 2 || len(cp.Population) != ga.N || len(cp.Scores) != ga.N {
+		t.Fatalf("checkpoint of gen %d has %d individuals and %d scores", cp.Gen, len(cp.Population), len(cp.Scores))
+	}
+	if cp.RNGDraws == 0 || cp.RNGDraws != ga.rngSrc.Draws() {
+		t.Errorf("checkpoint has %d draws of the GA and the GA made %d", cp.RNGDraws, ga.rngSrc.Draws())
+	}
+	if !reflect.DeepEqual(cp.Population, ga.currentGenes) {
+		t.Error("checkpoint population is not the population of the GA")
+	}
+	sameMarket(t, cp.EliteMarket, ga.Elite)
+
+	if err := writeCheckpoint(ga.CheckpointDir, cp); err != nil {
+		t.Fatal(err)
+	}
+	again, err := ReadCheckpoint(ga.CheckpointDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.Population, cp.Population) || again.MutationRate != cp.MutationRate {
+		t.Error("checkpoint changed when it was written again")
+	}
+}
+
+func TestResumeAfterLastGenRestoresElite(t *testing.T) {
+	ga, _ := testGA(t, 2, 2)
+	ga.Start()
+	cp, err := ReadCheckpoint(ga.CheckpointDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, _ := testGA(t, 2, 2)
+	resumed.Resume(cp)
+	if resumed.Elite.EID == "" {
+		t.Fatal("elite was not restored")
+	}
+	sameMarket(t, resumed.Elite, ga.Elite)
+}
+
+func TestResumeDropsGensRunAfterCheckpoint(t *testing.T) {
+	full, fullSink := testGA(t, 3, 2)
+	full.Start()
+	cp, err := ReadCheckpoint(full.CheckpointDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the GA stopped while running gen 2, its tables hold gens 0 and 1 and gen 2 has
+	// started writing market results
+	crashed, sink := testGA(t, 3, 2)
+	for _, table := range []string{"chromozones", "elite"} {
+		all, ok := fullSink.Table("test", table)
+		if !ok {
+			t.Fatalf("GA wrote no %s", table)
+		}
+		var rows [][]string
+		for _, row := range all.Rows {
+			if row[0] == "0" || row[0] == "1" {
+				rows = append(rows, row)
+			}
+		}
+		sink.Write("test", table, all.Columns, rows)
+	}
+	sink.Write("test/GEN_2/IND_0", "TRADES", []string{"ID"}, [][]string{{"1"}})
+
+	crashed.Resume(cp)
+	for _, table := range []string{"chromozones", "elite"} {
+		want, _ := fullSink.Table("test", table)
+		got, _ := sink.Table("test", table)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s has %d rows after resume and %d in the full run", table, len(got.Rows), len(want.Rows))
+		}
+	}
+	if _, ok := sink.Table("test/GEN_2/IND_0", "TRADES"); ok {
+		t.Error("results of the gen run after the checkpoint were kept")
+	}
+	sameMarket(t, crashed.Elite, full.Elite)
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// DeriveSeed returns the seed of one random source of a run. Every part of the
+// simulation that needs randomness gets its own source from the run seed, a stream
+// name and an id so adding draws in one part does not change the others
+func DeriveSeed(seed int64, stream string, id int) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(stream))
+	x := uint64(seed) ^ h.Sum64() ^ uint64(id)*0x9e3779b97f4a7c15
+
+	// splitmix64 finaliser so close seeds and ids give unrelated sources
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return int64(x)
+}
+
+// NewRand returns the random source of stream id for a run seed
+func NewRand(seed int64, stream string, id int) *rand.Rand {
+	return rand.New(rand.NewSource(DeriveSeed(seed, stream, id)))
+}
+
+// CountingSource is a random source that counts its draws so its state can be saved as
+// its seed and the number of draws, a new source with the same seed moved on with Skip
+// gives the rest of the same sequence
+type CountingSource struct {
+	src   rand.Source64
+	draws uint64
+}
+
+// NewCountingSource returns the counting source of stream id for a run seed
+func NewCountingSource(seed int64, stream string, id int) *CountingSource {
+	return &CountingSource{src: rand.NewSource(DeriveSeed(seed, stream, id)).(rand.Source64)}
+}
+
+func (s *CountingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *CountingSource) Uint64() uint64 {
+	s.draws++
+	return s.src.Uint64()
+}
+
+func (s *CountingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.draws = 0
+}
+
+// Draws is the number of values the source has given
+func (s *CountingSource) Draws() uint64 {
+	return s.draws
+}
+
+// Skip throws away the next n values of the source
+func (s *CountingSource) Skip(n uint64) {
+	for i := uint64(0); i < n; i++ {
+		s.Int63()
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"time"
 )
 
+// DefaultSymbol is the instrument of markets that trade a single good
+const DefaultSymbol = "DEFAULT"
+
 // This is other parameters from the market
 // It should be change to use time.Time for async version
 type MarketInfo struct {
@@ -15,29 +18,52 @@ type MarketInfo struct {
 	MarketEnd int `json:"MarketEnd"`
 	// Number of trading days
 	TradingDays int `json:"TradingDays"`
+	// DisclosedLevels is the number of price levels of each side of the book
+	// shown to the traders, 0 discloses the whole book
+	DisclosedLevels int `json:"DisclosedLevels,omitempty"`
 }
 
-//TODO: CHECK IF this is all that is needed
+// TODO: CHECK IF this is all that is needed
 type MarketUpdate struct {
 	TimeStep  int
 	Day       int
 	EID       string
+	Symbol    string
 	BestAsk   float64
 	BestBid   float64
 	Bids      []*Order
 	Asks      []*Order
+	BidDepth  []DepthLevel
+	AskDepth  []DepthLevel
 	Trades    []*Trade
 	LastTrade *Trade
 }
 
+// DepthLevel aggregates the orders resting at one price, MarketUpdate.BidDepth
+// and MarketUpdate.AskDepth hold the disclosed levels sorted from best to worst price
+type DepthLevel struct {
+	Price    float64
+	Quantity int
+	Orders   int
+}
+
 type Order struct {
+	// OrderID is given by the order book when the order is placed
+	// 0 means the order has not been placed yet
+	OrderID  int
 	TraderID int
 	// Order types: [Bid, ask, NAN, NA]  NA stands for non active it will
+	// CANCEL and AMEND are requests on the resting order with id OrderID, PULL
+	// cancels it with every other order its trader has queued on that side
 	OrderType string
 	Price     float64
 	Quantity  int
 	TimeStep  int
 	Time      time.Time
+	// Symbol of the instrument, empty means DefaultSymbol
+	Symbol string
+	// SimTime is the simulated time the order reached the exchange
+	SimTime float64
 }
 
 // For sorting lists of orders
@@ -71,26 +97,50 @@ func (o ByTimeStep) Less(i, j int) bool {
 func (o *Order) IsValid() bool {
 	if o.TraderID >= 0 &&
 		(o.OrderType == "BID" || o.OrderType == "ASK") &&
-		o.Price >= ^ 0 && o.TimeStep >= 0 &&
+		o.Price >= ^0 && o.TimeStep >= 0 &&
 		o.Quantity > 0 {
 		return true
 	} else if o.TraderID >= 0 && (o.OrderType == "NAN" || o.OrderType == "NA") {
 		return true
+	} else if o.TraderID >= 0 && o.OrderID > 0 && (o.OrderType == "CANCEL" || o.OrderType == "PULL") {
+		return true
+	} else if o.TraderID >= 0 && o.OrderID > 0 && o.OrderType == "AMEND" &&
+		o.Price >= 0 && o.Quantity > 0 {
+		return true
 	}
 
 	return false
 }
 
+// GetSymbol returns the instrument of the order
+func (o *Order) GetSymbol() string {
+	if o.Symbol == "" {
+		return DefaultSymbol
+	}
+	return o.Symbol
+}
+
+// IsRequest is true for orders that change a resting order instead of adding one
+func (o *Order) IsRequest() bool {
+	return o.OrderType == "CANCEL" || o.OrderType == "PULL" || o.OrderType == "AMEND"
+}
+
 type Trade struct {
 	TradeID   int
+	Symbol    string
 	BuyOrder  *Order
 	SellOrder *Order
-	BLimit float64
-	SLimit float64
+	BLimit    float64
+	SLimit    float64
 	Price     float64
 	Quantity  int
 	TimeStep  int
 	Time      time.Time
+	// Event is the trading phase the trade was made in
+	// [CONTINUOUS, CALL, OPEN, CLOSE, BATCH]
+	Event string
+	// SimTime is the simulated time the trade was made
+	SimTime float64
 }
 
 func (t *Trade) GetBuyer() int {
@@ -103,6 +153,7 @@ func (t *Trade) GetSeller() int {
 // Round returns the nearest integer, rounding half away from zero.
 //
 // Special cases are:
+//
 //	Round(±0) = ±0
 //	Round(±Inf) = ±Inf
 //	Round(NaN) = NaN
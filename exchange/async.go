@@ -0,0 +1,178 @@
+package exchange
+
+import (
+	"container/heap"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+// AsyncConfig turns the exchange into a discrete event simulation. Instead of one shout
+// per time step each agent arrives at the market at the times of a Poisson process,
+// orders are matched as they arrive and the clock is a float where time step t covers
+// [t, t+1). The BidAskRatio is not enforced as agents choose when to come
+type AsyncConfig struct {
+	// Rate is the mean number of arrivals of every agent per time step
+	Rate float64 `json:"Rate"`
+	// Rates overrides Rate for some agents, keys are trader ids
+	Rates map[int]float64 `json:"Rates,omitempty"`
+	// Seed varies the arrival times drawn for the same run seed
+	Seed int64 `json:"Seed,omitempty"`
+}
+
+// Validate checks that no rate is negative and at least one agent can arrive
+func (c *AsyncConfig) Validate() error {
+	if c.Rate < 0 {
+		return fmt.Errorf("arrival rate %.2f is negative", c.Rate)
+	}
+
+	active := c.Rate > 0
+	for id, r := range c.Rates {
+		if r < 0 {
+			return fmt.Errorf("arrival rate %.2f of trader %d is negative", r, id)
+		}
+		active = active || r > 0
+	}
+	if !active {
+		return fmt.Errorf("no agent has a positive arrival rate")
+	}
+	return nil
+}
+
+// RateOf returns the arrival rate of a trader
+func (c *AsyncConfig) RateOf(traderID int) float64 {
+	if r, ok := c.Rates[traderID]; ok {
+		return r
+	}
+	return c.Rate
+}
+
+// arrival is the time an agent comes to the market
+type arrival struct {
+	time     float64
+	traderID int
+}
+
+// arrivalHeap keeps the next arrival of every agent with the earliest first, ties go
+// to the lowest trader id. It implements container/heap.Interface
+type arrivalHeap []arrival
+
+func (h arrivalHeap) Len() int {
+	return len(h)
+}
+
+func (h arrivalHeap) Less(i, j int) bool {
+	if h[i].time != h[j].time {
+		return h[i].time < h[j].time
+	}
+	return h[i].traderID < h[j].traderID
+}
+
+func (h arrivalHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *arrivalHeap) Push(x interface{}) {
+	*h = append(*h, x.(arrival))
+}
+
+func (h *arrivalHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	a := old[n-1]
+	*h = old[:n-1]
+	return a
+}
+
+// Clock returns the simulated time of the exchange
+func (ex *Exchange) Clock() float64 {
+	return ex.clock
+}
+
+// scheduleArrivals draws the first arrival of every agent of the trading day
+func (ex *Exchange) scheduleArrivals() {
+	ex.clock = 0
+	ex.arrivals = arrivalHeap{}
+	for _, id := range ex.agentIDs {
+		ex.scheduleNext(id, 0)
+	}
+}
+
+// scheduleNext draws the next arrival of an agent after time from, agents with
+// no rate never arrive
+func (ex *Exchange) scheduleNext(traderID int, from float64) {
+	rate := ex.Async.RateOf(traderID)
+	if rate <= 0 {
+		return
+	}
+	heap.Push(&ex.arrivals, arrival{
+		time:     from + ex.arrivalRng.ExpFloat64()/rate,
+		traderID: traderID,
+	})
+}
+
+// stepAsync runs all the arrivals of time step t, each arriving agent is asked for an
+// order which is matched straight away in continuous phases, delayed orders are
+// matched when they reach the book. Auctions clear at the end of the step as they
+// do in step mode
+func (ex *Exchange) stepAsync(t, d int) {
+	ex.clock = float64(t)
+	ex.RenewExecOrders(t, d)
+
+	end := float64(t + 1)
+	for {
+		arrivalDue := ex.arrivals.Len() > 0 && ex.arrivals[0].time < end
+		orderDue := ex.inflight.Len() > 0 && ex.inflight[0].due < end
+		if !arrivalDue && !orderDue {
+			break
+		}
+
+		// delayed orders reaching the book before the next arrival go first
+		if orderDue && (!arrivalDue || ex.inflight[0].due <= ex.arrivals[0].time) {
+			ex.clock = ex.inflight[0].due
+			ex.deliverOrders(t, d)
+			ex.UpdateAgents(t, d)
+			continue
+		}
+
+		next := heap.Pop(&ex.arrivals).(arrival)
+		ex.clock = next.time
+		ex.arrive(next.traderID, t, d)
+		ex.scheduleNext(next.traderID, next.time)
+	}
+	ex.clock = end
+	ex.deliverUpdates()
+
+	if ex.sealedAt(t) {
+		ex.Match(t, d)
+		ex.UpdateAgents(t, d)
+	}
+}
+
+// arrive asks an agent for an order and processes it at the current clock
+func (ex *Exchange) arrive(traderID, t, d int) {
+	agent, ok := ex.agents[traderID]
+	if !ok {
+		return
+	}
+
+	order := agent.GetOrder(t)
+	if delay := ex.orderDelay(traderID); delay > 0 {
+		if isOrder(order) {
+			ex.sendOrder(order, delay)
+		}
+		return
+	}
+	if !ex.checkOrder(order, t, d) {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"TID":   traderID,
+		"Clock": ex.clock,
+	}).Debug("Agent arrived")
+	ex.submit(order, t, d)
+	if !ex.sealedAt(t) {
+		ex.MakeTrades(t, d)
+	}
+	ex.UpdateAgents(t, d)
+}
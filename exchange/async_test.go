@@ -0,0 +1,62 @@
+package exchange
+
+import "testing"
+
+func TestAsyncArrivalsFollowTheClock(t *testing.T) {
+	ex := &Exchange{Seed: 3, Async: &AsyncConfig{Rate: 1, Rates: map[int]float64{0: 0}}}
+	journal := runTestDay(ex)
+
+	submits := journal.of(EventSubmit)
+	if len(submits) == 0 {
+		t.Fatal("no order was placed")
+	}
+	last := 0.0
+	for _, e := range journal.events {
+		if e.Type == EventDayEnd {
+			continue
+		}
+		if e.SimTime < last {
+			t.Fatalf("event %d at %.3f is before the previous one at %.3f", e.Seq, e.SimTime, last)
+		}
+		last = e.SimTime
+		if e.Type == EventSubmit && (e.SimTime < float64(e.TimeStep) || e.SimTime >= float64(e.TimeStep+1)) {
+			t.Errorf("order of step %d was placed at %.3f", e.TimeStep, e.SimTime)
+		}
+		if e.Type == EventSubmit && e.TraderID == 0 {
+			t.Error("trader with no arrival rate placed an order")
+		}
+	}
+	if ex.Clock() != float64(testInfo.MarketEnd) {
+		t.Errorf("clock is %.3f at the end of the day", ex.Clock())
+	}
+
+	again := runTestDay(&Exchange{Seed: 3, Async: &AsyncConfig{Rate: 1, Rates: map[int]float64{0: 0}}})
+	// orders keep the wall clock time they were made at, so events are compared as text
+	if len(again.events) != len(journal.events) {
+		t.Fatalf("the same seed gave %d events and %d", len(again.events), len(journal.events))
+	}
+	for i, e := range again.events {
+		if e.String() != journal.events[i].String() {
+			t.Fatalf("the same seed gave %s and %s", e, journal.events[i])
+		}
+	}
+}
+
+func TestValidateAsync(t *testing.T) {
+	cases := []struct {
+		config AsyncConfig
+		valid  bool
+	}{
+		{AsyncConfig{Rate: 1}, true},
+		{AsyncConfig{Rates: map[int]float64{3: 0.5}}, true},
+		{AsyncConfig{}, false},
+		{AsyncConfig{Rate: -1}, false},
+		{AsyncConfig{Rate: 1, Rates: map[int]float64{3: -0.5}}, false},
+	}
+
+	for i, c := range cases {
+		if err := c.config.Validate(); (err == nil) != c.valid {
+			t.Errorf("case %d: got error %v, valid %v", i, err, c.valid)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"mexs/common"
+)
+
+// TradingPhase is a period of the trading day with its own way of matching orders.
+// CONTINUOUS matches every time step, the auction phases keep orders sealed and clear
+// them at a uniform price: OPEN and CLOSE once at End and CALL every Every steps.
+// A CONTINUOUS phase with Every set runs a BATCH auction every Every steps, the orders
+// of that step are sealed and cleared together at its end
+type TradingPhase struct {
+	// Type is one of CONTINUOUS, CALL, OPEN or CLOSE
+	Type string `json:"Type"`
+	// Start and End are the first and last time step of the phase
+	Start int `json:"Start"`
+	End   int `json:"End"`
+	// Every is the number of time steps between CALL clearings, 0 clears only at the
+	// end of the phase. For CONTINUOUS phases it is the period of the batch auctions,
+	// 0 runs none
+	Every int `json:"Every,omitempty"`
+}
+
+// IsAuction is true for phases where orders are sealed and cleared at a uniform price
+func (tp TradingPhase) IsAuction() bool {
+	return tp.Type != "CONTINUOUS"
+}
+
+// clearsAt is true when an auction phase has to clear at the end of time step t
+func (tp TradingPhase) clearsAt(t int) bool {
+	if t == tp.End {
+		return true
+	}
+
+	if tp.Type == "CALL" && tp.Every > 0 {
+		return (t-tp.Start+1)%tp.Every == 0
+	}
+	return false
+}
+
+// batchAt is true when time step t of a continuous phase is a batch auction
+func (tp TradingPhase) batchAt(t int) bool {
+	return tp.Type == "CONTINUOUS" && tp.Every > 0 && (t-tp.Start+1)%tp.Every == 0
+}
+
+// ValidatePhases checks that the phases are of a known type, inside the trading day
+// and that they do not overlap
+func ValidatePhases(phases []TradingPhase, marketEnd int) error {
+	for ix, p := range phases {
+		switch p.Type {
+		case "CONTINUOUS", "CALL", "OPEN", "CLOSE":
+		default:
+			return errors.New(fmt.Sprintf("phase %d has unknown type %s", ix, p.Type))
+		}
+
+		if p.Every < 0 {
+			return errors.New(fmt.Sprintf("phase %d has a negative period %d", ix, p.Every))
+		}
+
+		if p.Start < 0 || p.End < p.Start || p.End >= marketEnd {
+			return errors.New(fmt.Sprintf("phase %d [%d, %d] is not inside the trading day", ix, p.Start, p.End))
+		}
+
+		for _, o := range phases[:ix] {
+			if p.Start <= o.End && o.Start <= p.End {
+				return errors.New(fmt.Sprintf("phase %d overlaps with another phase", ix))
+			}
+		}
+	}
+	return nil
+}
+
+// setPhases builds the trading day from the market type when no phases are given,
+// a CDA is one CONTINUOUS phase and a call market one CALL phase
+func (ex *Exchange) setPhases() {
+	if len(ex.Phases) != 0 {
+		return
+	}
+
+	phase := TradingPhase{Type: "CONTINUOUS", Start: 0, End: ex.Info.MarketEnd - 1}
+	if ex.MarketType == "CALL" {
+		phase.Type = "CALL"
+		phase.Every = ex.CallPeriod
+	}
+	ex.Phases = []TradingPhase{phase}
+}
+
+// PhaseAt returns the trading phase of time step t, steps not covered by any
+// phase trade continuously
+func (ex *Exchange) PhaseAt(t int) TradingPhase {
+	for _, p := range ex.Phases {
+		if p.Start <= t && t <= p.End {
+			return p
+		}
+	}
+	return TradingPhase{Type: "CONTINUOUS", Start: t, End: t}
+}
+
+// sealedAt is true when the orders of time step t are kept sealed until an auction
+// clears them, in auction phases and in the batch steps of continuous ones
+func (ex *Exchange) sealedAt(t int) bool {
+	phase := ex.PhaseAt(t)
+	return phase.IsAuction() || phase.batchAt(t)
+}
+
+// Match runs the matching of the current phase at the end of time step t,
+// continuous trading matches every step while auctions only clear at the end of each period
+func (ex *Exchange) Match(t, d int) {
+	phase := ex.PhaseAt(t)
+	switch {
+	case phase.batchAt(t):
+		ex.ClearCall(t, d, "BATCH")
+	case !phase.IsAuction():
+		ex.MakeTrades(t, d)
+	case phase.clearsAt(t):
+		ex.ClearCall(t, d, phase.Type)
+	}
+}
+
+// ClearCall clears the book of every instrument at a single uniform price that maximises
+// the traded volume, orders that do not trade stay in the book for the next phase.
+// Trades are logged with the auction type as their event
+func (ex *Exchange) ClearCall(timeStep, d int, event string) {
+	for _, symbol := range ex.symbols {
+		ex.clearCall(ex.markets[symbol], timeStep, d, event)
+	}
+}
+
+func (ex *Exchange) clearCall(m *market, timeStep, d int, event string) {
+	price, volume := m.book.UniformPrice(ex.GAVector.KPricing)
+	if volume == 0 {
+		log.WithFields(log.Fields{
+			"Time step": timeStep,
+			"Event":     event,
+			"Symbol":    m.Symbol,
+		}).Debug("Auction cleared with no trades")
+		return
+	}
+
+	made := 0
+	for {
+		ok, bid, ask, _ := m.book.FindPossibleTrade()
+		if !ok || bid.Price < price || ask.Price > price {
+			break
+		}
+
+		if !ex.canFill(m, bid, ask, timeStep) {
+			continue
+		}
+
+		trade := &common.Trade{
+			TradeID:   m.book.GetNextTradeID(),
+			Symbol:    m.Symbol,
+			Price:     price,
+			BuyOrder:  bid,
+			SellOrder: ask,
+			Event:     event,
+		}
+		if !ex.executeTrade(trade, timeStep, d) {
+			return
+		}
+		made++
+	}
+
+	log.WithFields(log.Fields{
+		"Time step": timeStep,
+		"Event":     event,
+		"Symbol":    m.Symbol,
+		"Price":     price,
+		"Volume":    volume,
+		"Trades":    made,
+	}).Info("Auction cleared")
+}
@@ -0,0 +1,114 @@
+package exchange
+
+import (
+	"mexs/common"
+	"testing"
+)
+
+func TestBatchAuctionsInsideContinuousPhase(t *testing.T) {
+	ex := newTestExchange(AuctionParameters{KPricing: 0.5, OrderQueuing: 2})
+	ex.Phases = []TradingPhase{{Type: "CONTINUOUS", Start: 0, End: 9, Every: 5}}
+	setTestTraders(ex, testTrader(0, "BID", 150, 2), testTrader(1, "ASK", 50, 2))
+	ex.OpenDay(0)
+
+	for step, sealed := range []bool{false, false, false, false, true, false, false, false, false, true} {
+		if ex.sealedAt(step) != sealed {
+			t.Errorf("step %d: sealed %v, want %v", step, !sealed, sealed)
+		}
+	}
+
+	place(t, ex, &common.Order{TraderID: 0, OrderType: "BID", Price: 120, Quantity: 1, TimeStep: 4})
+	place(t, ex, &common.Order{TraderID: 1, OrderType: "ASK", Price: 100, Quantity: 1, TimeStep: 4})
+	ex.Match(4, 0)
+	place(t, ex, &common.Order{TraderID: 0, OrderType: "BID", Price: 120, Quantity: 1, TimeStep: 5})
+	place(t, ex, &common.Order{TraderID: 1, OrderType: "ASK", Price: 100, Quantity: 1, TimeStep: 5})
+	ex.Match(5, 0)
+
+	trades := ex.market(common.DefaultSymbol).book.tradeRecord
+	if len(trades) != 2 {
+		t.Fatalf("%d trades, want 2", len(trades))
+	}
+	if trades[0].Event != "BATCH" || trades[0].Price != 110 {
+		t.Errorf("batch step traded %s at %.2f, want BATCH at 110", trades[0].Event, trades[0].Price)
+	}
+	if trades[1].Event != "CONTINUOUS" {
+		t.Errorf("step after the batch traded %s, want CONTINUOUS", trades[1].Event)
+	}
+}
+
+func TestValidatePhases(t *testing.T) {
+	cases := []struct {
+		phases []TradingPhase
+		valid  bool
+	}{
+		{[]TradingPhase{{Type: "OPEN", Start: 0, End: 0}, {Type: "CONTINUOUS", Start: 1, End: 8, Every: 3},
+			{Type: "CLOSE", Start: 9, End: 9}}, true},
+		{[]TradingPhase{{Type: "BATCH", Start: 0, End: 9}}, false},
+		{[]TradingPhase{{Type: "CONTINUOUS", Start: 0, End: 9, Every: -1}}, false},
+		{[]TradingPhase{{Type: "CALL", Start: 0, End: 5}, {Type: "CONTINUOUS", Start: 5, End: 9}}, false},
+		{[]TradingPhase{{Type: "CONTINUOUS", Start: 0, End: 10}}, false},
+	}
+
+	for i, c := range cases {
+		if err := ValidatePhases(c.phases, 10); (err == nil) != c.valid {
+			t.Errorf("case %d: got error %v, valid %v", i, err, c.valid)
+		}
+	}
+}
+
+func TestUniformPriceMaximisesVolume(t *testing.T) {
+	book := newTestBook()
+	if price, volume := book.UniformPrice(0.5); price != -1 || volume != 0 {
+		t.Errorf("empty book clears %d units at %.2f", volume, price)
+	}
+
+	addOrders(t, book, bid(1, 110, 2), bid(2, 100, 1), bid(3, 80, 1), ask(4, 90, 1), ask(5, 95, 2), ask(6, 120, 1))
+	for _, c := range []struct{ k, price float64 }{{0, 95}, {0.5, 97.5}, {1, 100}} {
+		price, volume := book.UniformPrice(c.k)
+		if volume != 3 || price != c.price {
+			t.Errorf("k %.1f clears %d units at %.2f, want 3 at %.2f", c.k, volume, price, c.price)
+		}
+	}
+
+	book = newTestBook()
+	addOrders(t, book, bid(1, 90, 1), ask(2, 95, 1))
+	if price, volume := book.UniformPrice(0.5); price != -1 || volume != 0 {
+		t.Errorf("book that is not crossed clears %d units at %.2f", volume, price)
+	}
+}
+
+func TestCallMarketClearsEveryPeriod(t *testing.T) {
+	ex := newTestExchange(AuctionParameters{KPricing: 0.5, OrderQueuing: 1})
+	ex.Phases = []TradingPhase{{Type: "CALL", Start: 0, End: 9, Every: 3}}
+	setTestTraders(ex, testTrader(0, "BID", 150, 2), testTrader(1, "BID", 150, 1),
+		testTrader(2, "ASK", 50, 1), testTrader(3, "ASK", 50, 2))
+	ex.OpenDay(0)
+
+	place(t, ex, &common.Order{TraderID: 0, OrderType: "BID", Price: 120, Quantity: 2})
+	place(t, ex, &common.Order{TraderID: 1, OrderType: "BID", Price: 100, Quantity: 1})
+	place(t, ex, &common.Order{TraderID: 2, OrderType: "ASK", Price: 90, Quantity: 1})
+	place(t, ex, &common.Order{TraderID: 3, OrderType: "ASK", Price: 105, Quantity: 2})
+
+	book := ex.market(common.DefaultSymbol).book
+	for step := 0; step < 2; step++ {
+		ex.Match(step, 0)
+		if len(book.tradeRecord) != 0 {
+			t.Fatalf("call market traded at step %d before the end of its period", step)
+		}
+	}
+	ex.Match(2, 0)
+
+	units := 0
+	for _, trade := range book.tradeRecord {
+		if trade.Price != 112.5 || trade.Event != "CALL" {
+			t.Errorf("trade %d is a %s trade at %.2f, want CALL at 112.50", trade.TradeID, trade.Event, trade.Price)
+		}
+		units += trade.Quantity
+	}
+	if units != 2 {
+		t.Errorf("auction traded %d units, want 2", units)
+	}
+	if o := book.bidBook.Best(); o == nil || o.TraderID != 1 {
+		t.Error("the bid that did not trade is not left in the book")
+	}
+}
@@ -0,0 +1,149 @@
+package exchange
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"mexs/bots"
+	"mexs/results"
+	"strconv"
+)
+
+// Competition runs several exchanges in lockstep over the same population of traders.
+// At the start of each trading day every trader picks the exchange it trades in
+// with the Selector, all exchanges must share the same MarketInfo
+type Competition struct {
+	EID       string
+	Exchanges []*Exchange
+	// Names of the exchanges, each one logs to EID/Name
+	Names    []string
+	Selector MarketSelector
+	// Sink receives the competition stats, results.Default when nil
+	Sink    results.ResultSink
+	agents  map[int]bots.RobotTrader
+	sellers []int
+	buyers  []int
+}
+
+func (c *Competition) SetTraders(traders map[int]bots.RobotTrader, sellers, buyers []int) {
+	c.agents = traders
+	c.sellers = sellers
+	c.buyers = buyers
+}
+
+func (c *Competition) Start(s AllocationSchedule, sAndDs map[int]SandD) {
+	if len(c.Exchanges) == 0 {
+		log.Error("Competition has no exchanges")
+		return
+	}
+	if c.Sink == nil {
+		c.Sink = results.Default
+	}
+
+	for i, ex := range c.Exchanges {
+		ex.Open(c.EID+"/"+c.Names[i], s, sAndDs)
+	}
+
+	info := c.Exchanges[0].Info
+	for d := 0; d < info.TradingDays; d++ {
+		picks := c.pickMarkets(d)
+		balances := map[int]float64{}
+		for id, agent := range c.agents {
+			balances[id] = agent.GetBalance()
+		}
+
+		for _, ex := range c.Exchanges {
+			ex.OpenDay(d)
+		}
+		for t := 0; t < info.MarketEnd; t++ {
+			for _, ex := range c.Exchanges {
+				ex.Step(t, d)
+			}
+		}
+
+		profits := make([]float64, len(c.Exchanges))
+		for _, ex := range c.Exchanges {
+			ex.CloseDay(d)
+		}
+		// traders are visited in the order they were picked so profits add up the same every run
+		for _, ids := range [][]int{c.sellers, c.buyers} {
+			for _, id := range ids {
+				profit := c.agents[id].GetBalance() - balances[id]
+				profits[picks[id]] += profit
+				c.Selector.Reward(id, picks[id], profit)
+			}
+		}
+
+		c.WriteStats(d, profits)
+	}
+
+	for i, ex := range c.Exchanges {
+		log.WithFields(log.Fields{
+			"Exchange": c.Names[i],
+			"Trades":   ex.trades,
+			"Revenue":  ex.TotalRevenue().Total(),
+		}).Info("Competition ended")
+	}
+}
+
+// pickMarkets asks the selector for the exchange of every trader and hands each
+// exchange its traders for day d
+func (c *Competition) pickMarkets(d int) map[int]int {
+	picks := map[int]int{}
+	traders := make([]map[int]bots.RobotTrader, len(c.Exchanges))
+	sellers := make([][]int, len(c.Exchanges))
+	buyers := make([][]int, len(c.Exchanges))
+	for i := range c.Exchanges {
+		traders[i] = map[int]bots.RobotTrader{}
+		sellers[i] = []int{}
+		buyers[i] = []int{}
+	}
+
+	for _, id := range c.sellers {
+		m := c.Selector.Select(id, d, len(c.Exchanges))
+		picks[id] = m
+		traders[m][id] = c.agents[id]
+		sellers[m] = append(sellers[m], id)
+	}
+	for _, id := range c.buyers {
+		m := c.Selector.Select(id, d, len(c.Exchanges))
+		picks[id] = m
+		traders[m][id] = c.agents[id]
+		buyers[m] = append(buyers[m], id)
+	}
+
+	for i, ex := range c.Exchanges {
+		ex.SetTraders(traders[i])
+		ex.SellersIDs = sellers[i]
+		ex.BuyersIDs = buyers[i]
+	}
+	return picks
+}
+
+// WriteStats saves the market share, trader profit and efficiency of every exchange
+// in trading day d to the COMPETITION table
+func (c *Competition) WriteStats(d int, profits []float64) {
+	rows := make([][]string, 0, len(c.Exchanges))
+	for i, ex := range c.Exchanges {
+		stats := ex.Stats()
+		share := 0.0
+		if len(c.agents) > 0 {
+			share = float64(stats.Traders) / float64(len(c.agents))
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(d),
+			c.Names[i],
+			strconv.Itoa(stats.Traders),
+			fmt.Sprintf("%.5f", share),
+			strconv.Itoa(stats.Trades),
+			strconv.Itoa(stats.Volume),
+			fmt.Sprintf("%.5f", profits[i]),
+			fmt.Sprintf("%.5f", stats.Revenue),
+			fmt.Sprintf("%.5f", stats.Surplus),
+			fmt.Sprintf("%.5f", stats.MaxSurplus),
+			fmt.Sprintf("%.5f", stats.Efficiency()),
+		})
+	}
+
+	results.Save(c.Sink, c.EID, "COMPETITION", []string{"TradingDay", "Exchange", "Traders", "Share", "Trades",
+		"Volume", "Profit", "Revenue", "Surplus", "MaxSurplus", "Efficiency"}, rows)
+}
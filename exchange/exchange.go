@@ -1,19 +1,15 @@
 package exchange
 
 import (
-	"crypto/rand"
-	"encoding/csv"
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	"math"
-	"math/big"
+	fastRand "math/rand"
 	"mexs/bots"
 	"mexs/common"
-	"os"
-	"path/filepath"
+	"mexs/results"
+	"sort"
 	"strconv"
 	"time"
-	fastRand "math/rand"
 )
 
 // AuctionParameters are the ones to be evolved by the GA
@@ -36,9 +32,14 @@ type AuctionParameters struct {
 	WindowSizeEE int `json:"WindowSizeEE"`
 	// DeltaEE is the relaxing parameter in EE shout improvement rule
 	DeltaEE float64 `json:"DeltaEE"`
-	// OrderQueueing is the number of orders one trader can have queued
-	// for now fixed to 1
+	// OrderQueueing is the number of orders one trader can have queued on
+	// each side of the book, once full a new order replaces the oldest one
+	// values below 1 are treated as 1
 	OrderQueuing int `json:"OrderQueuing,omitempty"`
+	// PricingRule sets the price of continuous trades, one of PricingRules, empty means K
+	PricingRule string `json:"PricingRule,omitempty"`
+	// PricingWindow is the number of trades averaged by the MOVING_AVERAGE pricing rule
+	PricingWindow int `json:"PricingWindow,omitempty"`
 }
 
 // Used to define when
@@ -52,25 +53,33 @@ type AllocationSchedule struct {
 
 // Help structure to pair orders to Traders
 type SandD struct {
-	ID int
+	ID   int
 	SIDs []int
 	BIDs []int
-	Sps []AgentLimitPrices
-	Bps []AgentLimitPrices
+	Sps  []AgentLimitPrices
+	Bps  []AgentLimitPrices
 }
 type SchedToPrices struct {
-	SID int`json:"SID"`
-	Day int `json:"Day, omitempty"`
-	TimeStep int `json:"TimeStep, omitempty"`
-	SLimitPrices []AgentLimitPrices `json:"SLimitPrices, omitempty"`
-	BLimitPrices []AgentLimitPrices `json:"BLimitPrices, omitempty"`
+	SID          int                `json:"SID"`
+	Day          int                `json:"Day,omitempty"`
+	TimeStep     int                `json:"TimeStep,omitempty"`
+	SLimitPrices []AgentLimitPrices `json:"SLimitPrices,omitempty"`
+	BLimitPrices []AgentLimitPrices `json:"BLimitPrices,omitempty"`
 }
 
 type AgentLimitPrices struct {
-	ID int `json:"ID"`
+	ID     int       `json:"ID"`
 	Prices []float64 `json:"LimitPrice"`
-	// Ignore for now
-	Quantities []int64 `json:"Quantities, omitempty"`
+	// Quantities[i] is the number of units at Prices[i], missing values mean 1 unit
+	Quantities []int64 `json:"Quantities,omitempty"`
+}
+
+// Quantity returns the number of units to be traded at the ix limit price
+func (alp AgentLimitPrices) Quantity(ix int) int {
+	if ix < len(alp.Quantities) && alp.Quantities[ix] > 0 {
+		return int(alp.Quantities[ix])
+	}
+	return 1
 }
 
 /* Exchange defines the basic interfaces all exchanges have to follow
@@ -79,28 +88,73 @@ type AgentLimitPrices struct {
 *   -
  */
 type Exchange struct {
-	EID              string
-	GAVector         AuctionParameters
-	Info             common.MarketInfo
-	orderBook        OrderBook
-	agents           map[int]bots.RobotTrader
-	AgentNum         int
-	SellersIDs       []int
-	BuyersIDs        []int
-	bids             int
-	asks             int
-	trades           int
-	tradeRecordPrice []float64
-	SandDs map[int]SandD
-	Alloc AllocationSchedule
-	LogAll bool
+	EID string
+	// Seed of the run, every random choice of the exchange comes from sources derived from it
+	Seed       int64
+	rng        *fastRand.Rand
+	GAVector   AuctionParameters
+	Info       common.MarketInfo
+	agents     map[int]bots.RobotTrader
+	AgentNum   int
+	SellersIDs []int
+	BuyersIDs  []int
+	bids       int
+	asks       int
+	trades     int
+	pricing    PricingRule
+	SandDs     map[int]SandD
+	Alloc      AllocationSchedule
+	LogAll     bool
+	// MarketType is CDA for a continuous double auction, CALL for a call market
+	// where orders are sealed and cleared every CallPeriod time steps or HYBRID
+	// to use the trading phases in Phases
+	MarketType string
+	// CallPeriod is the number of time steps between clearings of a call market,
+	// 0 clears only at the end of the trading day
+	CallPeriod int
+	// Phases split the trading day, when empty they are built from MarketType
+	Phases []TradingPhase
+	// Rules are checked in order on every shout, DefaultRules are used when nil
+	Rules []MarketRule
+	// Fees charged to the traders
+	Fees Fees
+	// revenue made from fees in each trading day
+	revenue map[int]*Revenue
+	// day has the stats of the current trading day
+	day      DayStats
+	dayUnits map[int][]bots.TraderOrder
+	// Instruments traded in the exchange, when empty only common.DefaultSymbol is traded
+	Instruments []Instrument
+	// markets has the book and trade history of each instrument in symbols
+	markets map[string]*market
+	symbols []string
+	// Async runs the exchange as a discrete event simulation, nil runs one shout per time step
+	Async *AsyncConfig
+	// clock is the simulated time, in step mode it is the current time step
+	clock      float64
+	arrivals   arrivalHeap
+	arrivalRng *fastRand.Rand
+	agentIDs   []int
+	// Latency delays the orders and market data of the agents, nil delivers everything at once
+	Latency    *LatencyConfig
+	inflight   messageHeap
+	feeds      messageHeap
+	msgSeq     int
+	latencyRng *fastRand.Rand
+	// TraderSelector picks the traders asked for orders in step mode, BID_ASK_RATIO when nil
+	TraderSelector TraderSelector
+	// Sink receives the results of the exchange, results.Default when nil
+	Sink results.ResultSink
+	// Journal records every event of the exchange so its books can be replayed, nil records nothing
+	Journal    Journal
+	journalSeq int
+	// result has the trades and stats of the days run so far
+	result MarketResult
 }
 
 func (ex *Exchange) Init(GAVector AuctionParameters, Info common.MarketInfo, sellers, buyers []int) {
 	ex.GAVector = GAVector
 	ex.Info = Info
-	ex.orderBook = OrderBook{}
-	ex.orderBook.Init()
 	ex.agents = map[int]bots.RobotTrader{}
 	ex.AgentNum = 0
 	ex.SellersIDs = sellers
@@ -108,12 +162,48 @@ func (ex *Exchange) Init(GAVector AuctionParameters, Info common.MarketInfo, sel
 	ex.bids = 0
 	ex.asks = 0
 	ex.trades = 0
-	ex.tradeRecordPrice = make([]float64, GAVector.WindowSizeEE)
+	ex.setMarkets()
+	ex.agentIDs = []int{}
+	ex.rng = common.NewRand(ex.Seed, "exchange", 0)
+	if ex.Async != nil {
+		ex.arrivalRng = common.NewRand(ex.Seed, "arrivals", int(ex.Async.Seed))
+	}
+	if ex.Latency != nil {
+		ex.latencyRng = common.NewRand(ex.Seed, "latency", int(ex.Latency.Seed))
+	}
+	ex.resetMessages()
+	ex.revenue = map[int]*Revenue{}
+	pricing, err := GetPricingRule(GAVector.PricingRule)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Panic("The pricing rule is not valid")
+	}
+	ex.pricing = pricing
+	if ex.Sink == nil {
+		ex.Sink = results.Default
+	}
+	if ex.TraderSelector == nil {
+		ex.TraderSelector = &RatioSelector{}
+	}
+	if ex.Rules == nil {
+		ex.Rules, _ = BuildRules(DefaultRules)
+	}
 }
 
 func (ex *Exchange) SetTraders(traders map[int]bots.RobotTrader) {
 	ex.agents = traders
+	// agents log to the results of the exchange
+	for _, agent := range traders {
+		agent.SetSink(ex.Sink)
+	}
 	ex.AgentNum = len(traders)
+	// agents are always visited in id order so runs can be repeated
+	ex.agentIDs = make([]int, 0, len(traders))
+	for id := range traders {
+		ex.agentIDs = append(ex.agentIDs, id)
+	}
+	sort.Ints(ex.agentIDs)
 }
 
 func (ex *Exchange) ResetBidAskCount() {
@@ -121,154 +211,280 @@ func (ex *Exchange) ResetBidAskCount() {
 	ex.asks = 0
 }
 
-func (ex *Exchange) PriceMatch(bid, ask *common.Order) *common.Trade {
-	// Implement K pricing rule using GA parameter
-	price := ex.GAVector.KPricing*bid.Price +
-		(1-ex.GAVector.KPricing)*ask.Price
+// PriceMatch prices a trade between a crossed bid and ask, it fails when their symbol is
+// not traded in the exchange
+func (ex *Exchange) PriceMatch(bid, ask *common.Order) (*common.Trade, error) {
+	book, err := ex.book(bid)
+	if err != nil {
+		return nil, err
+	}
+	price := ex.pricing.Price(ex, bid, ask)
 
 	return &common.Trade{
-		TradeID:   ex.orderBook.GetNextTradeID(),
+		TradeID:   book.GetNextTradeID(),
+		Symbol:    bid.GetSymbol(),
 		Price:     price,
 		BuyOrder:  bid,
 		SellOrder: ask,
-	}
+	}, nil
 }
 
 func (ex *Exchange) MakeTrades(timeStep, d int) {
-	// NOTE: This function is designed for the time step, single unit approach
-	// for a multi unit asynchronous system this function should be called
+	// NOTE: This function is designed for the time step approach
+	// for an asynchronous system this function should be called
 	// every time an order is received and block until end
 	// arriving orders should be put in a queued and processed in turn
-	// The trade matching function should also be extended to deal with
-	// multiple units
-	ok, bid, ask, _ := ex.orderBook.FindPossibleTrade()
-	if !ok {
+	// Orders are matched until the book is no longer crossed, each fill is
+	// for the smaller of the two quantities and emits its own trade
+	for _, symbol := range ex.symbols {
+		ex.makeTrades(ex.markets[symbol], timeStep, d)
+	}
+}
+
+func (ex *Exchange) makeTrades(m *market, timeStep, d int) {
+	made := 0
+	for {
+		ok, bid, ask, _ := m.book.FindPossibleTrade()
+		if !ok {
+			break
+		}
+
+		if !ex.canFill(m, bid, ask, timeStep) {
+			continue
+		}
+
+		trade, err := ex.PriceMatch(bid, ask)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Time step": timeStep,
+				"Symbol":    m.Symbol,
+				"error":     err.Error(),
+			}).Error("Orders could not be matched")
+			return
+		}
+		trade.Event = "CONTINUOUS"
+		if !ex.executeTrade(trade, timeStep, d) {
+			return
+		}
+		made++
+	}
+
+	if made == 0 {
 		log.WithFields(log.Fields{
 			"Time step": timeStep,
+			"Symbol":    m.Symbol,
 		}).Debug("No trade could be made")
-		return
 	}
+}
 
-	trade := ex.PriceMatch(bid, ask)
+// canFill checks both traders still have units of the instrument of market m to trade.
+// Traders with queued orders may have more units in the book than left to trade, those
+// orders are dropped from the book
+func (ex *Exchange) canFill(m *market, bid, ask *common.Order, timeStep int) bool {
+	bUnits := ex.agentUnits(bid.TraderID, m.Symbol)
+	sUnits := ex.agentUnits(ask.TraderID, m.Symbol)
+	if bUnits == 0 {
+		ex.drop(m, bid, timeStep)
+	}
+	if sUnits == 0 {
+		ex.drop(m, ask, timeStep)
+	}
+	return bUnits > 0 && sUnits > 0
+}
+
+// drop takes a resting order out of the book of market m
+func (ex *Exchange) drop(m *market, order *common.Order, timeStep int) {
+	if m.book.CancelOrder(order.OrderID) == nil {
+		ex.record(timeStep, JournalEvent{
+			Type:     EventDrop,
+			Symbol:   m.Symbol,
+			TraderID: order.TraderID,
+			OrderID:  order.OrderID,
+		})
+	}
+}
+
+// executeTrade fills a priced trade for as many units as both orders and traders allow,
+// records it and lets the traders know. It returns false if the trade could not be made
+func (ex *Exchange) executeTrade(trade *common.Trade, timeStep, d int) bool {
+	bid := trade.BuyOrder
+	ask := trade.SellOrder
 	trade.TimeStep = timeStep
-	// NOTE: Should always be 1 for now it may be changed
-	trade.Quantity = 1
+	trade.SimTime = ex.clock
+	trade.Quantity = minInt(bid.Quantity, ask.Quantity,
+		ex.agentUnits(bid.TraderID, trade.Symbol), ex.agentUnits(ask.TraderID, trade.Symbol))
 	trade.Time = time.Now()
 
 	// NOTE: This code is smelly, it assumes agents accept trade and can not refuse
 	// once the order is posted for any reason
-	err := ex.orderBook.RecordTrade(trade)
+	m := ex.market(trade.Symbol)
+	err := m.book.RecordTrade(trade)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"Time step": timeStep,
 		}).Error("Trade could not be made Error:", err)
-		return
-	}
+		return false
+	}
+
+	ex.record(timeStep, JournalEvent{
+		Type:     EventTrade,
+		Symbol:   trade.Symbol,
+		TraderID: -1,
+		Trade: &JournalTrade{
+			TradeID:     trade.TradeID,
+			BuyOrderID:  bid.OrderID,
+			SellOrderID: ask.OrderID,
+			BuyerID:     bid.TraderID,
+			SellerID:    ask.TraderID,
+			Price:       trade.Price,
+			Quantity:    trade.Quantity,
+			Event:       trade.Event,
+		},
+	})
 
 	// add trade price to trade record to use with EE shout improvement rule
-	ex.tradeRecordPrice[ex.trades%ex.GAVector.WindowSizeEE] = trade.Price
+	if len(m.eePrices) > 0 {
+		m.eePrices[m.trades%len(m.eePrices)] = trade.Price
+	}
+	m.trades++
 	ex.trades++
+	ex.recordPrice(m, trade.Price)
 
-	//ex.agents[bid.TraderID].LogOrder("../mexs/logs/"+ex.EID+"/ExecOrders.csv", d, trade.TimeStep, trade.TradeID, trade.Price)
-	//ex.agents[ask.TraderID].LogOrder("../mexs/logs/"+ex.EID+"/ExecOrders.csv", d, trade.TimeStep, trade.TradeID, trade.Price)
+	//ex.agents[bid.TraderID].LogOrder(ex.EID, d, trade.TimeStep, trade.TradeID, trade.Price)
+	//ex.agents[ask.TraderID].LogOrder(ex.EID, d, trade.TimeStep, trade.TradeID, trade.Price)
 	// Traders should add there limit prices
 	_, vl := ex.agents[bid.TraderID].TradeMade(trade)
 	_, sl := ex.agents[ask.TraderID].TradeMade(trade)
 
 	trade.BLimit = vl
 	trade.SLimit = sl
+	ex.chargeTrade(trade, d)
+	ex.day.Trades++
+	ex.day.Volume += trade.Quantity
+	ex.day.Surplus += (vl - sl) * float64(trade.Quantity)
 
-	//ex.agents[bid.TraderID].LogBalance("../mexs/logs/"+ex.EID, d, trade)
-	//ex.agents[ask.TraderID].LogBalance("../mexs/logs/"+ex.EID, d, trade)
+	//ex.agents[bid.TraderID].LogBalance(ex.EID, d, trade)
+	//ex.agents[ask.TraderID].LogBalance(ex.EID, d, trade)
 	log.WithFields(log.Fields{
 		"Time step": timeStep,
+		"Symbol":    trade.Symbol,
 		"BuyerID":   bid.TraderID,
 		"SellerID":  ask.TraderID,
 		"Price":     trade.Price,
+		"Quantity":  trade.Quantity,
 	}).Info("Trade made!")
+	return true
 }
 
-func (ex *Exchange) GetTraderOrder(t, d int, eid string) (bool, *common.Order) {
-	traderType := "NONE"
-	for tries := 0; tries < 5; tries++ {
-		traderType1, traderID := ex.EnforceBidToAskRatio(traderType, t)
-		traderType = traderType1
-		var agent bots.RobotTrader = ex.agents[traderID]
-		order := agent.GetOrder(t)
-		if order.OrderType != "BID" && order.OrderType != "ASK" {
-			log.WithFields(log.Fields{
-				"traderType":       traderType,
-				"OrderType":        order.OrderType,
-				"TraderID":         traderID,
-				"Agent has orders": len(agent.GetExecutionOrder()),
-			}).Debug("invalid order")
-			continue
+// agentUnits returns how many units are left in the first execution order a trader
+// has in the instrument symbol
+func (ex *Exchange) agentUnits(traderID int, symbol string) int {
+	for _, o := range ex.agents[traderID].GetExecutionOrder() {
+		if o.GetSymbol() == symbol {
+			return o.Quantity
 		}
+	}
+	return 0
+}
 
-		validOrder, reason := ex.OrderComplies(order, t)
-		if validOrder {
-			if order.OrderType == "BID" {
-				ex.bids++
-			} else {
-				ex.asks++
-			}
-			log.Debugf("Bids ask %d:%d", ex.bids, ex.asks)
-			if (ex.LogAll) {
-				logOrderToCSV(order, d, eid, "TRUE", "N/A")
-			}
-			return true, order
-		}
-
-		log.WithFields(log.Fields{
-			"traderType":       traderType,
-			"OrderType":        order.OrderType,
-			"order price":      order.Price,
-			"TraderID":         traderID,
-			"Agent has orders": len(agent.GetExecutionOrder()),
-		}).Debug("Order did not comply")
-		if (ex.LogAll) {
-			logOrderToCSV(order, d, eid, "FALSE", reason)
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
 		}
 	}
-	return false, &common.Order{}
+	return m
 }
 
-func logOrderToCSV(order *common.Order, day int, experimentID, accepted, reason string) {
-	fileName, err := filepath.Abs(fmt.Sprintf("../mexs/logs/%s/ALLORDERS.csv", experimentID))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day":  day,
-			"experimentID": experimentID,
-			"error":        err.Error(),
-		}).Error("File Path not found")
-		return
+// PlaceOrder adds an accepted order to the book, when the trader already has
+// OrderQueuing orders on that side its oldest order is replaced.
+// Cancel, pull and amend requests are applied to the order they reference
+func (ex *Exchange) PlaceOrder(order *common.Order) error {
+	m := ex.market(order.GetSymbol())
+	if m == nil {
+		return fmt.Errorf("symbol %s is not traded in this exchange", order.GetSymbol())
 	}
 
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
+	return m.book.Place(order, ex.GAVector.OrderQueuing)
+}
+
+// AskTraders asks the traders picked by the TraderSelector for orders, the accepted ones
+// are placed as they come and matched in continuous phases. It returns the number of
+// orders sent, delayed orders count once they are on their way
+func (ex *Exchange) AskTraders(t, d int) int {
+	ids, quotes := ex.TraderSelector.Select(ex, t)
+	sent := 0
+	for _, traderID := range ids {
+		if sent >= quotes {
+			break
+		}
+		agent, ok := ex.agents[traderID]
+		if !ok {
+			continue
+		}
+
+		order := agent.GetOrder(t)
+		if delay := ex.orderDelay(traderID); delay > 0 {
+			// the order is checked when it reaches the book
+			if isOrder(order) {
+				ex.sendOrder(order, delay)
+				sent++
+			}
+			continue
+		}
+		if ex.receive(order, t, d) {
+			sent++
+		}
 	}
+	return sent
+}
 
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file.Close()
+// isOrder is true for shouts and requests
+func isOrder(order *common.Order) bool {
+	return order.OrderType == "BID" || order.OrderType == "ASK" || order.IsRequest()
+}
 
-	if err != nil {
+// checkOrder is true if the order is a shout or request that follows the market rules,
+// rejected orders are logged
+func (ex *Exchange) checkOrder(order *common.Order, t, d int) bool {
+	if !isOrder(order) {
 		log.WithFields(log.Fields{
-			"Trading Day":  day,
-			"experimentID": experimentID,
-			"error":        err.Error(),
-		}).Error("Trade CSV file could not be made")
-		return
+			"OrderType": order.OrderType,
+			"TraderID":  order.TraderID,
+		}).Debug("invalid order")
+		return false
+	}
+
+	order.SimTime = ex.clock
+	validOrder, reason := ex.OrderComplies(order, t)
+	if validOrder {
+		// Cancel and amend requests do not count as new shouts
+		if order.OrderType == "BID" {
+			ex.bids++
+		} else if order.OrderType == "ASK" {
+			ex.asks++
+		}
+		log.Debugf("Bids ask %d:%d", ex.bids, ex.asks)
+		return true
 	}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	if addHeader {
-		writer.Write([]string{"Day", "TimeStep", "OrderType", "TID", "PRICE", "ACCEPTED", "REASON"})
+	log.WithFields(log.Fields{
+		"OrderType":   order.OrderType,
+		"order price": order.Price,
+		"TraderID":    order.TraderID,
+	}).Debug("Order did not comply")
+	ex.recordOrder(t, EventReject, *order, 0, reason)
+	if ex.LogAll {
+		ex.logOrder(order, d, "FALSE", reason)
 	}
+	return false
+}
 
-	writer.Write([]string{
+// logOrder saves an order to the ALLORDERS table with the reason it was accepted or not
+func (ex *Exchange) logOrder(order *common.Order, day int, accepted, reason string) {
+	results.Save(ex.Sink, ex.EID, "ALLORDERS", []string{"Day", "TimeStep", "OrderType", "TID", "PRICE", "ACCEPTED",
+		"REASON", "OID", "SYMBOL", "SIMTIME"}, [][]string{{
 		strconv.Itoa(day),
 		strconv.Itoa(order.TimeStep),
 		order.OrderType,
@@ -276,24 +492,10 @@ func logOrderToCSV(order *common.Order, day int, experimentID, accepted, reason
 		fmt.Sprintf("%.5f", order.Price),
 		accepted,
 		reason,
-	})
-}
-
-func (ex *Exchange) EnforceBidToAskRatio(traderType string, t int) (string, int) {
-	if traderType == "NONE" {
-		traderType2 := ex.nextBuyerOrSeller(t)
-		return traderType2, ex.getRandomTrader(traderType2)
-	}
-
-	return traderType, ex.getRandomTrader(traderType)
-}
-
-// switch between enforce agent and random picker
-func (ex *Exchange) RandomAgentPicker(traderType string, t int) (string, int) {
-	val, _ := rand.Int(rand.Reader, big.NewInt(int64(ex.AgentNum)))
-	id := int(val.Int64())
-	tType := "buyer"
-	return tType, id
+		strconv.Itoa(order.OrderID),
+		order.GetSymbol(),
+		fmt.Sprintf("%.5f", order.SimTime),
+	}})
 }
 
 // Returns the id of the trader to be asked
@@ -301,7 +503,7 @@ func (ex *Exchange) nextBuyerOrSeller(t int) string {
 	// case where no bids or ask made choose at random
 	tOrders := ex.totalOrders()
 	if tOrders == 0 {
-		x := fastRand.Float64()
+		x := ex.rng.Float64()
 		if x < 0.5 {
 			return "buyer"
 		}
@@ -310,7 +512,7 @@ func (ex *Exchange) nextBuyerOrSeller(t int) string {
 	// Choose at random if current BA is same as he one we want
 	currentBa := ex.currentBA()
 	if currentBa == ex.GAVector.BidAskRatio {
-		x := fastRand.Float64()
+		x := ex.rng.Float64()
 		if x < 0.5 {
 			return "buyer"
 		}
@@ -328,193 +530,147 @@ func (ex *Exchange) totalOrders() int {
 	return ex.bids + ex.asks
 }
 
-func (ex *Exchange) currentBA () float64 {
+func (ex *Exchange) currentBA() float64 {
 	return float64(ex.bids) / float64(ex.totalOrders())
 }
 
 func (ex *Exchange) getRandomTrader(traderType string) int {
+	// In a competition a side of the market can be empty for a day
+	if traderType == "seller" && len(ex.SellersIDs) == 0 {
+		return -1
+	} else if traderType == "buyer" && len(ex.BuyersIDs) == 0 {
+		return -1
+	}
+
 	if traderType == "seller" {
-		val, _ := rand.Int(rand.Reader, big.NewInt(int64(len(ex.SellersIDs))))
-		return ex.SellersIDs[int(val.Int64())]
+		return ex.SellersIDs[ex.rng.Intn(len(ex.SellersIDs))]
 	} else if traderType == "buyer" {
-		val, _ := rand.Int(rand.Reader, big.NewInt(int64(len(ex.BuyersIDs))))
-		return ex.BuyersIDs[int(val.Int64())]
+		return ex.BuyersIDs[ex.rng.Intn(len(ex.BuyersIDs))]
 	}
 
 	log.WithFields(log.Fields{
 		"traderType": traderType,
 	}).Error("Invalid trader type")
 	// pick an Id at random
-	val, _ := rand.Int(rand.Reader, big.NewInt(int64(ex.AgentNum)))
-	return int(val.Int64())
+	return ex.rng.Intn(ex.AgentNum)
 }
 
 func (ex *Exchange) OrderComplies(order *common.Order, t int) (bool, string) {
 	// It will check that the order follows the market rules
-
-	//Between max and min values of the system
-	if order.Price > ex.Info.MaxPrice || order.Price < ex.Info.MinPrice {
-		return false, "Not invalid price range"
-	}
-
-	// Here we deal with the minimum increment rule NYSE style rule
-	//valid := ex.ShoutImprovementRule(order)
-	//if !valid {
-	//	return valid, "Does not pass minimum increment"
-	//}
-	//EE shout improvemnt
-	valid := ex.EEShoutImprovement(order)
-	if !valid {
-		return valid, "Does not pass minimum EE increment"
-	}
-
-	valid = ex.MaxShift(order)
-	if !valid {
-		return valid, "Does not pass max shift"
+	m := ex.market(order.GetSymbol())
+	if m == nil {
+		return false, ReasonUnknownSymbol
 	}
 
-	valid = ex.DominanceRule(order, t)
-	if !valid {
-		return valid, "Does not pass max shift"
-	}
-	return valid, "PASSES"
-}
-
-func (ex *Exchange) DominanceRule(order *common.Order, t int) bool {
-	// Dominance rule is to ensure no trader can dominate by being the only one sending bids/asks
-	if order.OrderType == "BID" {
-		if lastO, ok := ex.orderBook.bidBook.Orders[order.TraderID]; ok {
-			if lastO.TimeStep+ex.GAVector.Dominance > t {
-				log.WithFields(log.Fields{
-					"Dominance":         ex.GAVector.Dominance,
-					"Last Quote in":     lastO.TimeStep,
-					"Current Time step": t,
-				}).Debug("Order rejected as it not passes Dominance rule")
-				return false
-			}
+	// Requests can only change resting orders of the same trader, an amendment
+	// has to follow the rules as a new shout on the side of the order it changes
+	if order.IsRequest() {
+		target, ok := m.book.GetOrder(order.OrderID)
+		if !ok {
+			return false, ReasonNotInBook
 		}
-	} else if order.OrderType == "ASK" {
-		if lastO, ok := ex.orderBook.askBook.Orders[order.TraderID]; ok {
-			if lastO.TimeStep+ex.GAVector.Dominance > t {
-				log.WithFields(log.Fields{
-					"Dominance":         ex.GAVector.Dominance,
-					"Last Quote in":     lastO.TimeStep,
-					"Current Time step": t,
-				}).Debug("Order rejected as it not passes Dominance rule")
-				return false
-			}
-		}
-	}
 
-	return true
-}
+		if target.TraderID != order.TraderID {
+			return false, ReasonNotOwner
+		}
 
-func (ex *Exchange) EEShoutImprovement(order *common.Order) bool {
-	// This rule https://www.researchgate.net/publication/221455475_Reducing_price_fluctuation_in_continuous_double_auctions_through_pricing_policy_and_shout_improvement
-	// The rule keeps an estimate of the equilibrium price using an estimate of the equilibrium price Pe
-	// Pe = (1/m) * sum_0_m(Pi)
-	// where m is the size of the sliding window
-	// then all bids above Pe - delta are accepted
-	// and all asks bellow Pe + delta are accepted
-	// Tunable parameters are m and delta
-	if ex.trades < ex.GAVector.WindowSizeEE {
-		// Not enough trades to estimate Pe so accept all bids and asks
-		return true
-	}
+		if order.OrderType == "CANCEL" || order.OrderType == "PULL" {
+			return true, ReasonPasses
+		}
 
-	pe := 1.0 / float64(ex.GAVector.WindowSizeEE)
-	sum := 0.0
-	for i := 0; i < ex.GAVector.WindowSizeEE; i++ {
-		sum += ex.tradeRecordPrice[i]
+		amended := *order
+		amended.OrderType = target.OrderType
+		order = &amended
 	}
-	pe = pe * sum
 
-	if order.OrderType == "BID" && order.Price >= (pe-ex.GAVector.DeltaEE) {
-		return true
-	} else if order.OrderType == "ASK" && order.Price <= (pe+ex.GAVector.DeltaEE) {
-		return true
+	for _, rule := range ex.Rules {
+		if ok, reason := rule.Check(ex, order, t); !ok {
+			return false, reason
+		}
 	}
-
-	return false
+	return true, ReasonPasses
 }
 
-func (ex *Exchange) MaxShift(order *common.Order) bool {
-	// This maximum shift rule defines the maximum amount any seller can shift the
-	// Price, it is based on the last transaction
-	if ex.orderBook.lastTrade.TradeID == -1 {
-		return true
-	}
-
-	if ex.orderBook.lastTrade.Price*ex.GAVector.MaxShift >
-		math.Abs(ex.orderBook.lastTrade.Price-order.Price) {
-		return true
-	}
-
-	log.WithFields(log.Fields{
-		"Max Shift":   ex.GAVector.MaxShift,
-		"Last Trade":  ex.orderBook.lastTrade.Price,
-		"Order Price": order.Price,
-	}).Debug("Order rejected as it not passes max shift rule")
-	return false
-}
+// UpdateAgents sends every agent one market update for each instrument, agents with
+// data latency get it once it reaches them
+func (ex *Exchange) UpdateAgents(timeStep, day int) {
+	ex.deliverUpdates()
+	for _, symbol := range ex.symbols {
+		book := ex.markets[symbol].book
+		marketUpdate := common.MarketUpdate{
+			TimeStep:  timeStep,
+			Day:       day,
+			EID:       ex.EID,
+			Symbol:    symbol,
+			BestAsk:   -1,
+			BestBid:   -1,
+			Bids:      []*common.Order{},
+			Asks:      []*common.Order{},
+			BidDepth:  []common.DepthLevel{},
+			AskDepth:  []common.DepthLevel{},
+			Trades:    book.tradeRecord,
+			LastTrade: book.lastTrade,
+		}
 
-func (ex *Exchange) ShoutImprovementRule(order *common.Order) bool {
-	if order.OrderType == "BID" {
-		if ex.orderBook.bidBook.BestPrice != -1 {
-			if ex.orderBook.bidBook.BestPrice+ex.GAVector.MinIncrement > order.Price {
-				log.WithFields(log.Fields{
-					"Best price":        ex.orderBook.bidBook.BestPrice,
-					"Minimum Increment": ex.GAVector.MinIncrement,
-					"Bid":               order.Price,
-					"TID":               order.TraderID,
-				}).Debug("Bid was rejected as it does not improve enough on best bid")
-				return false
-			}
+		// During auctions orders are sealed so only trades are disclosed
+		if !ex.sealedAt(timeStep) {
+			marketUpdate.BestAsk = book.askBook.BestPrice
+			marketUpdate.BestBid = book.bidBook.BestPrice
+			marketUpdate.Bids = book.bidBook.DisclosedOrders(ex.Info.DisclosedLevels)
+			marketUpdate.Asks = book.askBook.DisclosedOrders(ex.Info.DisclosedLevels)
+			marketUpdate.BidDepth = book.bidBook.Ladder(ex.Info.DisclosedLevels)
+			marketUpdate.AskDepth = book.askBook.Ladder(ex.Info.DisclosedLevels)
 		}
-	} else {
-		if ex.orderBook.askBook.BestPrice != -1 {
-			if ex.orderBook.askBook.BestPrice-ex.GAVector.MinIncrement < order.Price {
-				log.WithFields(log.Fields{
-					"Best ask":          ex.orderBook.askBook.BestPrice,
-					"Minimum Increment": ex.GAVector.MinIncrement,
-					"Ask":               order.Price,
-					"TID":               order.TraderID,
-				}).Debug("Ask was rejected as it does not improve enough on best ask")
-				return false
-			}
+
+		ex.record(timeStep, JournalEvent{
+			Type:     EventUpdate,
+			Symbol:   symbol,
+			TraderID: -1,
+			Update: &JournalUpdate{
+				BestBid:     book.bidBook.BestPrice,
+				BestAsk:     book.askBook.BestPrice,
+				LastTradeID: book.lastTrade.TradeID,
+				Sealed:      ex.sealedAt(timeStep),
+			},
+		})
+
+		for _, id := range ex.agentIDs {
+			ex.sendUpdate(id, marketUpdate)
 		}
 	}
-
-	return true
 }
 
-func (ex *Exchange) UpdateAgents(timeStep, day int) {
-	ex.orderBook.askBook.SetBestData()
-	ex.orderBook.bidBook.SetBestData()
-	bestAsk := ex.orderBook.askBook.BestPrice
-	bestBid := ex.orderBook.bidBook.BestPrice
-
-	marketUpdate := common.MarketUpdate{
-		TimeStep:  timeStep,
-		Day:       day,
-		EID:       ex.EID,
-		BestAsk:   bestAsk,
-		BestBid:   bestBid,
-		Bids:      ex.orderBook.bidBook.OrdersToList(),
-		Asks:      ex.orderBook.askBook.OrdersToList(),
-		Trades:    ex.orderBook.tradeRecord,
-		LastTrade: ex.orderBook.lastTrade,
-	}
-
-	for _, agent := range ex.agents {
-		agent.MarketUpdate(marketUpdate)
+// StartMarket runs every trading day of the experiment and returns its trades and stats
+func (ex *Exchange) StartMarket(experimentID string, s AllocationSchedule, sAndDs map[int]SandD) MarketResult {
+	ex.Open(experimentID, s, sAndDs)
+	for d := 0; d < ex.Info.TradingDays; d++ {
+		ex.OpenDay(d)
+		for t := 0; t < ex.Info.MarketEnd; t++ {
+			ex.Step(t, d)
+		}
+		ex.CloseDay(d)
 	}
+	log.WithFields(log.Fields{
+		"Trades":      ex.trades,
+		"Instruments": len(ex.symbols),
+		"EID":         experimentID,
+	}).Info("Experiment ended")
+	return ex.Result()
 }
 
-func (ex *Exchange) StartMarket(experimentID string, s AllocationSchedule, sAndDs map[int]SandD) {
+// Open gets the exchange ready to run the experiment, StartMarket does it for a single market
+// while competitions open all their exchanges and run them in lockstep
+func (ex *Exchange) Open(experimentID string, s AllocationSchedule, sAndDs map[int]SandD) {
 	ex.EID = experimentID
 	ex.SandDs = sAndDs
 	ex.Alloc = s
+	ex.result = MarketResult{EID: experimentID}
+	for _, m := range ex.markets {
+		if m.SandDs == nil {
+			m.Alloc = s
+			m.SandDs = sAndDs
+		}
+	}
 
 	log.WithFields(log.Fields{
 		"Trading days":        ex.Info.TradingDays,
@@ -523,99 +679,179 @@ func (ex *Exchange) StartMarket(experimentID string, s AllocationSchedule, sAndD
 		"ID":                  experimentID,
 	}).Info("Market experiment started")
 
-	err := os.MkdirAll("../mexs/logs/"+experimentID+"/", 0755)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Error": err.Error(),
-		}).Error("Log Folder for this experiment could not be made")
+	if ex.LogAll {
+		ex.WriteSchedule(experimentID)
 	}
 
-	if (ex.LogAll) {
-		ex.ScheduleToCSV(experimentID)
+	ex.setPhases()
+}
+
+// OpenDay starts trading day d with an empty book
+func (ex *Exchange) OpenDay(d int) {
+	for _, symbol := range ex.symbols {
+		ex.markets[symbol].book.Reset()
+	}
+	ex.ResetBidAskCount()
+	ex.revenue[d] = &Revenue{}
+	ex.day = DayStats{Day: d, Traders: len(ex.agents)}
+	ex.dayUnits = map[int][]bots.TraderOrder{}
+	for id, agent := range ex.agents {
+		ex.recordUnits(id, agent.GetExecutionOrder())
+	}
+	ex.chargeInfo(d)
+	ex.resetMessages()
+	ex.clock = 0
+	ex.record(0, JournalEvent{
+		Type:         EventDayStart,
+		TraderID:     -1,
+		Symbols:      ex.symbols,
+		OrderQueuing: ex.GAVector.OrderQueuing,
+	})
+	if ex.Async != nil {
+		ex.scheduleArrivals()
 	}
+	log.Info("Trading day:", d)
+}
 
-	for d := 0; d < ex.Info.TradingDays; d++ {
-		ex.orderBook.Reset()
-		ex.ResetBidAskCount()
-		log.Info("Trading day:", d)
-		for t := 0; t < ex.Info.MarketEnd; t++ {
-			log.Info("Time-step:", t)
-			ex.RenewExecOrders(t, d)
-			ok, order := ex.GetTraderOrder(t, d, experimentID)
-			if ok {
-				err := ex.orderBook.AddOrder(order)
-				if err == nil {
-					log.WithFields(log.Fields{
-						"TID":   order.TraderID,
-						"Type":  order.OrderType,
-						"Price": order.Price,
-					}).Info("Order received")
-				} else {
-					log.WithFields(log.Fields{
-						"Time step": t,
-						"error":     err.Error(),
-					}).Error("Order could not be added")
-				}
-			} else {
-				log.WithFields(log.Fields{
-					"Time step": t,
-				}).Info("No order was received this time step")
-			}
+// Step runs time step t of trading day d, delayed orders due by t reach the book, the
+// selected traders are asked for orders and the book is matched
+func (ex *Exchange) Step(t, d int) {
+	log.Info("Time-step:", t)
+	if ex.Async != nil {
+		ex.stepAsync(t, d)
+		return
+	}
 
-			ex.MakeTrades(t, d)
-			ex.orderBook.SetBest()
-			ex.UpdateAgents(t, d)
-		}
+	ex.clock = float64(t)
+	ex.RenewExecOrders(t, d)
+	if len(ex.agents) == 0 {
+		return
+	}
+	ex.deliverOrders(t, d)
 
+	if ex.AskTraders(t, d) == 0 {
 		log.WithFields(log.Fields{
-			"Trades": len(ex.orderBook.tradeRecord),
-			"Bids":   ex.bids,
-			"Asks":   ex.asks,
-		}).Info("Trading day ended")
-		ex.orderBook.TradesToCSV(experimentID, d)
+			"Time step": t,
+		}).Info("No order was received this time step")
 	}
+
+	ex.Match(t, d)
+	ex.UpdateAgents(t, d)
+}
+
+// submit places an accepted order in the book and charges the shout fee
+func (ex *Exchange) submit(order *common.Order, t, d int) {
+	// the book sets the id of the order, the journal keeps it as it was sent
+	submitted := *order
+	err := ex.PlaceOrder(order)
+	if err == nil {
+		ex.chargeShout(order, d)
+		log.WithFields(log.Fields{
+			"TID":   order.TraderID,
+			"OID":   order.OrderID,
+			"Type":  order.OrderType,
+			"Price": order.Price,
+		}).Info("Order received")
+		ex.recordOrder(t, EventSubmit, submitted, order.OrderID, "")
+		if ex.LogAll {
+			ex.logOrder(order, d, "TRUE", "N/A")
+		}
+	} else {
+		log.WithFields(log.Fields{
+			"Time step": t,
+			"error":     err.Error(),
+		}).Error("Order could not be added")
+		ex.recordOrder(t, EventReject, submitted, 0, err.Error())
+		if ex.LogAll {
+			ex.logOrder(order, d, "FALSE", err.Error())
+		}
+	}
+}
+
+// CloseDay ends trading day d and logs its trades and revenue
+func (ex *Exchange) CloseDay(d int) {
+	ex.day.Revenue = ex.revenue[d].Total()
+	ex.day.MaxSurplus = ex.maxSurplus()
 	log.WithFields(log.Fields{
-		"Trades":         ex.trades,
-		"remaining Bids": len(ex.orderBook.bidBook.Orders),
-		"remaining Asks": len(ex.orderBook.askBook.Orders),
-		"EID":            experimentID,
-	}).Info("Experiment ended")
+		"Trades":  ex.day.Trades,
+		"Bids":    ex.bids,
+		"Asks":    ex.asks,
+		"Revenue": ex.day.Revenue,
+	}).Info("Trading day ended")
+	ex.recordResult(d)
+	for _, symbol := range ex.symbols {
+		ex.markets[symbol].book.WriteTrades(ex.Sink, ex.EID, d)
+	}
+	ex.WriteRevenue(ex.EID, d)
+	ex.record(ex.Info.MarketEnd, JournalEvent{Type: EventDayEnd, TraderID: -1})
+}
+
+// recordReplenish adds the units a trader got from the schedule to the journal
+func (ex *Exchange) recordReplenish(t, traderID int, symbol string, orders []*bots.TraderOrder) {
+	if ex.Journal == nil {
+		return
+	}
+
+	units := make([]bots.TraderOrder, len(orders))
+	for i, o := range orders {
+		units[i] = *o
+	}
+	ex.record(t, JournalEvent{
+		Type:     EventReplenish,
+		Symbol:   symbol,
+		TraderID: traderID,
+		Units:    units,
+	})
 }
 
-// It renews Execution Orders based on a schedule
 func (ex *Exchange) RenewExecOrders(t, d int) {
+	for _, symbol := range ex.symbols {
+		ex.renewExecOrders(ex.markets[symbol], t, d)
+	}
+}
+
+func (ex *Exchange) renewExecOrders(m *market, t, d int) {
 	// Check that there is a schedule relocation in day d at time t
-	if _, ok := ex.Alloc.Schedule[d]; ok {
-		if id, ok := ex.Alloc.Schedule[d][t]; ok {
+	if _, ok := m.Alloc.Schedule[d]; ok {
+		if id, ok := m.Alloc.Schedule[d][t]; ok {
 			// Check that schedule with id:id exists
-			if sandd, ok := ex.SandDs[id]; ok {
+			if sandd, ok := m.SandDs[id]; ok {
 				// Set orders for sellers
 				for _, lp := range sandd.Sps {
+					// In a competition only the traders in this exchange get units here
+					if _, ok := ex.agents[lp.ID]; !ok {
+						continue
+					}
 					orders := make([]*bots.TraderOrder, len(lp.Prices))
 					for ix, p := range lp.Prices {
-						// FIXME quantity hardcoded to 1
 						order := &bots.TraderOrder{
 							LimitPrice: p,
-							Quantity: 1,
-							Type:"ASK",
+							Quantity:   lp.Quantity(ix),
+							Type:       "ASK",
+							Symbol:     m.Symbol,
 						}
 						orders[ix] = order
 					}
-					ex.agents[lp.ID].SetOrders(orders)
+					ex.setAgentOrders(lp.ID, m.Symbol, orders)
+					ex.recordReplenish(t, lp.ID, m.Symbol, orders)
 				}
 				// Set orders for buyers
 				for _, lp := range sandd.Bps {
+					if _, ok := ex.agents[lp.ID]; !ok {
+						continue
+					}
 					orders := make([]*bots.TraderOrder, len(lp.Prices))
 					for ix, p := range lp.Prices {
-						// FIXME quantity hardcoded to 1
 						order := &bots.TraderOrder{
 							LimitPrice: p,
-							Quantity: 1,
-							Type:"BID",
+							Quantity:   lp.Quantity(ix),
+							Type:       "BID",
+							Symbol:     m.Symbol,
 						}
 						orders[ix] = order
 					}
-					ex.agents[lp.ID].SetOrders(orders)
+					ex.setAgentOrders(lp.ID, m.Symbol, orders)
+					ex.recordReplenish(t, lp.ID, m.Symbol, orders)
 				}
 				log.Debug("Traders Replentish")
 			}
@@ -623,83 +859,73 @@ func (ex *Exchange) RenewExecOrders(t, d int) {
 	}
 }
 
-func (ex *Exchange) ScheduleToCSV(eid string) {
-	// Schedules csv works in a sort of relational table way. there is the schedule csv that links
-	// S&D ids to time step and trading dat
-	//Create schedule.csv
-	fileName1, err := filepath.Abs(fmt.Sprintf("../mexs/logs/%s/schedule.csv", eid))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err.Error(),
-		}).Error("Error creating schedule.scv")
-		return
-	}
-
-	file1, err := os.OpenFile(fileName1, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file1.Close()
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err.Error(),
-		}).Error("Sched CSV file could not be made")
-		return
-	}
-
-	writer1 := csv.NewWriter(file1)
-	defer writer1.Flush()
-	writer1.Write([]string{"TradingDay", "TimeStep", "ScheduleID"})
-	for d, _ := range ex.Alloc.Schedule {
-		for t, id := range ex.Alloc.Schedule[d] {
-			writer1.Write([]string{
-				strconv.Itoa(d),
-				strconv.Itoa(t),
-				strconv.Itoa(id),
-			})
+// WriteSchedule saves the schedule in the schedule table, which links the S&D ids to
+// the time steps and trading days they start at, and the limit prices of each S&D
+// in the LimitPrices table
+func (ex *Exchange) WriteSchedule(eid string) {
+	// rows are sorted so the same experiment always gives the same tables
+	schedRows := [][]string{}
+	for _, symbol := range ex.symbols {
+		m := ex.markets[symbol]
+		days := make([]int, 0, len(m.Alloc.Schedule))
+		for d := range m.Alloc.Schedule {
+			days = append(days, d)
 		}
-	}
-
-	// Write limit prices for each schedule in csv
-	fileName, err := filepath.Abs(fmt.Sprintf("../mexs/logs/%s/LimitPrices.csv", eid))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err.Error(),
-		}).Error("Error creating schedule.scv")
-		return
-	}
-
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file.Close()
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err.Error(),
-		}).Error("CSV file could not be made: ", fileName)
-		return
-	}
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-	writer.Write([]string{"ID", "TID", "TYPE", "LIMIT"})
-
-	for id, sandd := range ex.SandDs {
-		for _, slp := range sandd.Sps {
-			for _, ps := range slp.Prices {
-				writer.Write([]string{
-					strconv.Itoa(id),
-					strconv.Itoa(slp.ID),
-					"ASK",
-					fmt.Sprintf("%.2f", ps),
+		sort.Ints(days)
+		for _, d := range days {
+			steps := make([]int, 0, len(m.Alloc.Schedule[d]))
+			for t := range m.Alloc.Schedule[d] {
+				steps = append(steps, t)
+			}
+			sort.Ints(steps)
+			for _, t := range steps {
+				schedRows = append(schedRows, []string{
+					strconv.Itoa(d),
+					strconv.Itoa(t),
+					strconv.Itoa(m.Alloc.Schedule[d][t]),
+					symbol,
 				})
 			}
 		}
+	}
+	results.Save(ex.Sink, eid, "schedule", []string{"TradingDay", "TimeStep", "ScheduleID", "Symbol"}, schedRows)
 
-		for _, blp := range sandd.Bps {
-			for _, ps := range blp.Prices {
-				writer.Write([]string{
-					strconv.Itoa(id),
-					strconv.Itoa(blp.ID),
-					"BID",
-					fmt.Sprintf("%.2f", ps),
-				})
+	priceRows := [][]string{}
+	for _, symbol := range ex.symbols {
+		sandDs := ex.markets[symbol].SandDs
+		ids := make([]int, 0, len(sandDs))
+		for id := range sandDs {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			sandd := sandDs[id]
+			for _, slp := range sandd.Sps {
+				for ix, ps := range slp.Prices {
+					priceRows = append(priceRows, []string{
+						strconv.Itoa(id),
+						strconv.Itoa(slp.ID),
+						"ASK",
+						fmt.Sprintf("%.2f", ps),
+						strconv.Itoa(slp.Quantity(ix)),
+						symbol,
+					})
+				}
+			}
+
+			for _, blp := range sandd.Bps {
+				for ix, ps := range blp.Prices {
+					priceRows = append(priceRows, []string{
+						strconv.Itoa(id),
+						strconv.Itoa(blp.ID),
+						"BID",
+						fmt.Sprintf("%.2f", ps),
+						strconv.Itoa(blp.Quantity(ix)),
+						symbol,
+					})
+				}
 			}
 		}
 	}
+	results.Save(ex.Sink, eid, "LimitPrices", []string{"ID", "TID", "TYPE", "LIMIT", "QUANTITY", "SYMBOL"}, priceRows)
 }
@@ -0,0 +1,190 @@
+package exchange
+
+import (
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mexs/bots"
+	"mexs/common"
+	"mexs/results"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+var testInfo = common.MarketInfo{MaxPrice: 200, MinPrice: 1, MarketEnd: 10, TradingDays: 1}
+
+func newTestExchange(params AuctionParameters) *Exchange {
+	ex := &Exchange{Sink: results.Discard}
+	ex.Init(params, testInfo, nil, nil)
+	return ex
+}
+
+func place(t *testing.T, ex *Exchange, order *common.Order) {
+	t.Helper()
+	if err := ex.PlaceOrder(order); err != nil {
+		t.Fatalf("order %#v could not be placed: %s", order, err.Error())
+	}
+}
+
+// testTrader is a ZIC trader with units to trade on one side, its logs are discarded
+func testTrader(id int, side string, limit float64, quantity int) bots.RobotTrader {
+	sellerOrBuyer := "seller"
+	if side == "BID" {
+		sellerOrBuyer = "buyer"
+	}
+	trader := &bots.ZICTrader{}
+	trader.InitRobotCore(id, sellerOrBuyer, testInfo, common.NewRand(1, "trader", id))
+	trader.Info.Sink = results.Discard
+	trader.SetOrders([]*bots.TraderOrder{{LimitPrice: limit, Quantity: quantity, Type: side}})
+	return trader
+}
+
+func setTestTraders(ex *Exchange, traders ...bots.RobotTrader) {
+	agents := map[int]bots.RobotTrader{}
+	for i, trader := range traders {
+		agents[i] = trader
+	}
+	ex.SetTraders(agents)
+}
+
+func TestAgentsLogToTheSinkOfTheExchange(t *testing.T) {
+	sink := &results.MemorySink{}
+	ex := &Exchange{EID: "sink", Sink: sink}
+	ex.Init(AuctionParameters{}, testInfo, nil, nil)
+	agent := testTrader(0, "BID", 150, 1)
+	setTestTraders(ex, agent)
+
+	agent.LogBalance(ex.EID, 0, &common.Trade{TradeID: 1, Price: 100})
+	if _, ok := sink.Table(ex.EID, "ZICTradersLog"); !ok {
+		t.Error("the agent did not log to the sink of its exchange")
+	}
+}
+
+func TestMakeTradesFillsOrdersInParts(t *testing.T) {
+	ex := newTestExchange(AuctionParameters{KPricing: 0.5, OrderQueuing: 1, PricingRule: "K"})
+	setTestTraders(ex, testTrader(0, "BID", 150, 3), testTrader(1, "ASK", 50, 1), testTrader(2, "ASK", 50, 1))
+	ex.OpenDay(0)
+
+	buy := &common.Order{TraderID: 0, OrderType: "BID", Price: 120, Quantity: 3}
+	place(t, ex, buy)
+	place(t, ex, &common.Order{TraderID: 1, OrderType: "ASK", Price: 100, Quantity: 1})
+	place(t, ex, &common.Order{TraderID: 2, OrderType: "ASK", Price: 110, Quantity: 1})
+	ex.MakeTrades(0, 0)
+
+	book := ex.market(common.DefaultSymbol).book
+	if len(book.tradeRecord) != 2 {
+		t.Fatalf("%d trades, want 2", len(book.tradeRecord))
+	}
+	for i, trade := range book.tradeRecord {
+		if trade.Quantity != 1 || trade.BuyOrder != buy {
+			t.Errorf("trade %d is for %d units of order %d", i, trade.Quantity, trade.BuyOrder.OrderID)
+		}
+	}
+	if o, ok := book.GetOrder(buy.OrderID); !ok || o.Quantity != 1 {
+		t.Error("bid is not resting with its last unit")
+	}
+}
+
+// testJournal keeps the events of an exchange in memory
+type testJournal struct {
+	events []JournalEvent
+}
+
+func (j *testJournal) Record(eid string, e JournalEvent) error {
+	j.events = append(j.events, e)
+	return nil
+}
+
+func (j *testJournal) Close() error {
+	return nil
+}
+
+// of returns the events of one type
+func (j *testJournal) of(eventType string) []JournalEvent {
+	events := []JournalEvent{}
+	for _, e := range j.events {
+		if e.Type == eventType {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// runTestDay runs trading day 0 of an exchange with four buyers and four sellers
+// holding three units each, all of them are asked for orders every step. It returns
+// the journal of the day
+func runTestDay(ex *Exchange) *testJournal {
+	journal := &testJournal{}
+	ex.Journal = journal
+	ex.Sink = results.Discard
+	ex.TraderSelector = &AllSelector{}
+	ex.Init(AuctionParameters{BidAskRatio: 0.5, KPricing: 0.5, MaxShift: 1, OrderQueuing: 2, PricingRule: "K"}, testInfo, nil, nil)
+	traders := []bots.RobotTrader{}
+	for i := 0; i < 4; i++ {
+		traders = append(traders, testTrader(2*i, "BID", 150-float64(10*i), 3),
+			testTrader(2*i+1, "ASK", 50+float64(10*i), 3))
+	}
+	setTestTraders(ex, traders...)
+
+	ex.OpenDay(0)
+	for t := 0; t < testInfo.MarketEnd; t++ {
+		ex.Step(t, 0)
+	}
+	ex.CloseDay(0)
+	return journal
+}
+
+// updateRecorder is a test trader that keeps the market updates it is sent
+type updateRecorder struct {
+	bots.RobotTrader
+	updates []common.MarketUpdate
+}
+
+func (r *updateRecorder) MarketUpdate(update common.MarketUpdate) {
+	r.updates = append(r.updates, update)
+}
+
+func TestUpdatesDiscloseTheLevelsOfTheMarket(t *testing.T) {
+	cases := []struct {
+		levels int
+		phases []TradingPhase
+		bids   []common.DepthLevel
+		asks   []common.DepthLevel
+		orders int
+	}{
+		{1, nil, []common.DepthLevel{{Price: 50, Quantity: 3, Orders: 2}}, []common.DepthLevel{{Price: 60, Quantity: 1, Orders: 1}}, 2},
+		{5, nil, []common.DepthLevel{{Price: 50, Quantity: 3, Orders: 2}, {Price: 40, Quantity: 1, Orders: 1}},
+			[]common.DepthLevel{{Price: 60, Quantity: 1, Orders: 1}, {Price: 70, Quantity: 2, Orders: 1}}, 3},
+		// orders are sealed during auctions, nothing of the book is disclosed
+		{0, []TradingPhase{{Type: "CALL", Start: 0, End: 9, Every: 5}}, []common.DepthLevel{}, []common.DepthLevel{}, 0},
+	}
+
+	for _, c := range cases {
+		info := testInfo
+		info.DisclosedLevels = c.levels
+		ex := &Exchange{Sink: results.Discard, Phases: c.phases}
+		ex.Init(AuctionParameters{OrderQueuing: 1}, info, nil, nil)
+		recorder := &updateRecorder{RobotTrader: testTrader(0, "BID", 150, 1)}
+		setTestTraders(ex, recorder)
+		for _, o := range []*common.Order{bid(1, 50, 1), bid(2, 50, 2), bid(3, 40, 1), ask(4, 60, 1), ask(5, 70, 2)} {
+			place(t, ex, o)
+		}
+
+		ex.UpdateAgents(0, 0)
+		if len(recorder.updates) != 1 {
+			t.Fatalf("levels %d: trader got %d updates, want 1", c.levels, len(recorder.updates))
+		}
+		update := recorder.updates[0]
+		if !reflect.DeepEqual(update.BidDepth, c.bids) || !reflect.DeepEqual(update.AskDepth, c.asks) {
+			t.Errorf("levels %d: ladder is %+v and %+v, want %+v and %+v", c.levels, update.BidDepth, update.AskDepth, c.bids, c.asks)
+		}
+		if len(update.Bids) != c.orders {
+			t.Errorf("levels %d: %d bids disclosed, want %d", c.levels, len(update.Bids), c.orders)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package exchange
+
+import (
+	"fmt"
+	"mexs/common"
+	"mexs/results"
+	"sort"
+	"strconv"
+)
+
+// Fees are the charges the exchange takes from the traders, all of them default to 0
+type Fees struct {
+	// Shout is charged for every bid, ask or amendment that enters the book
+	Shout float64 `json:"Shout,omitempty"`
+	// Trade is charged to the buyer and the seller of every trade
+	Trade float64 `json:"Trade,omitempty"`
+	// Profit is the fraction of the surplus of a trade charged to each trader, in [0, 1]
+	Profit float64 `json:"Profit,omitempty"`
+	// Info is charged to every trader at the start of each trading day for the market data
+	Info float64 `json:"Info,omitempty"`
+}
+
+// Validate checks that the fees are not negative and the profit fee is a fraction
+func (f Fees) Validate() error {
+	if f.Shout < 0 || f.Trade < 0 || f.Profit < 0 || f.Info < 0 {
+		return fmt.Errorf("fees can not be negative")
+	}
+	if f.Profit > 1 {
+		return fmt.Errorf("profit fee %.2f is above 1", f.Profit)
+	}
+	return nil
+}
+
+// Revenue is the money made by the exchange from each kind of fee
+type Revenue struct {
+	Shout  float64
+	Trade  float64
+	Profit float64
+	Info   float64
+}
+
+// Total is the sum of all the fees
+func (r Revenue) Total() float64 {
+	return r.Shout + r.Trade + r.Profit + r.Info
+}
+
+func (r *Revenue) add(o Revenue) {
+	r.Shout += o.Shout
+	r.Trade += o.Trade
+	r.Profit += o.Profit
+	r.Info += o.Info
+}
+
+// TotalRevenue is the revenue of the exchange over all the trading days so far
+func (ex *Exchange) TotalRevenue() Revenue {
+	days := make([]int, 0, len(ex.revenue))
+	for d := range ex.revenue {
+		days = append(days, d)
+	}
+	// days are added in order so the sum is the same every run
+	sort.Ints(days)
+
+	total := Revenue{}
+	for _, d := range days {
+		total.add(*ex.revenue[d])
+	}
+	return total
+}
+
+// charge takes a fee from a trader, it does nothing for traders that are not in the market
+func (ex *Exchange) charge(traderID int, fee float64) float64 {
+	if fee <= 0 {
+		return 0
+	}
+
+	agent, ok := ex.agents[traderID]
+	if !ok {
+		return 0
+	}
+	agent.Charge(fee)
+	return fee
+}
+
+func (ex *Exchange) chargeShout(order *common.Order, d int) {
+	if order.OrderType == "CANCEL" || order.OrderType == "PULL" {
+		return
+	}
+	ex.revenue[d].Shout += ex.charge(order.TraderID, ex.Fees.Shout)
+}
+
+// chargeTrade takes the trade and profit fees from both sides, the profit fee is
+// only taken on positive surplus
+func (ex *Exchange) chargeTrade(trade *common.Trade, d int) {
+	r := ex.revenue[d]
+	r.Trade += ex.charge(trade.BuyOrder.TraderID, ex.Fees.Trade)
+	r.Trade += ex.charge(trade.SellOrder.TraderID, ex.Fees.Trade)
+
+	q := float64(trade.Quantity)
+	if surplus := (trade.BLimit - trade.Price) * q; surplus > 0 {
+		r.Profit += ex.charge(trade.BuyOrder.TraderID, ex.Fees.Profit*surplus)
+	}
+	if surplus := (trade.Price - trade.SLimit) * q; surplus > 0 {
+		r.Profit += ex.charge(trade.SellOrder.TraderID, ex.Fees.Profit*surplus)
+	}
+}
+
+func (ex *Exchange) chargeInfo(d int) {
+	for _, id := range ex.agentIDs {
+		ex.revenue[d].Info += ex.charge(id, ex.Fees.Info)
+	}
+}
+
+// WriteRevenue saves the revenue of the exchange in trading day d to the REVENUE table
+func (ex *Exchange) WriteRevenue(experimentID string, d int) {
+	r := ex.revenue[d]
+	results.Save(ex.Sink, experimentID, "REVENUE", []string{"TradingDay", "Shout", "Trade", "Profit", "Info", "Total"},
+		[][]string{{
+			strconv.Itoa(d),
+			fmt.Sprintf("%.5f", r.Shout),
+			fmt.Sprintf("%.5f", r.Trade),
+			fmt.Sprintf("%.5f", r.Profit),
+			fmt.Sprintf("%.5f", r.Info),
+			fmt.Sprintf("%.5f", r.Total()),
+		}})
+}
@@ -0,0 +1,58 @@
+package exchange
+
+import (
+	"math"
+	"mexs/bots"
+	"mexs/common"
+	"testing"
+)
+
+func TestFeesAreChargedToTraders(t *testing.T) {
+	ex := newTestExchange(AuctionParameters{KPricing: 0.5, OrderQueuing: 1})
+	ex.Fees = Fees{Shout: 1, Trade: 2, Profit: 0.1, Info: 0.5}
+	buyer := testTrader(0, "BID", 150, 1)
+	seller := testTrader(1, "ASK", 50, 1)
+	idle := testTrader(2, "BID", 150, 1)
+	setTestTraders(ex, buyer, seller, idle)
+	ex.OpenDay(0)
+
+	ex.submit(&common.Order{TraderID: 0, OrderType: "BID", Price: 120, Quantity: 1}, 0, 0)
+	ex.submit(&common.Order{TraderID: 1, OrderType: "ASK", Price: 100, Quantity: 1}, 0, 0)
+	quote := &common.Order{TraderID: 2, OrderType: "BID", Price: 90, Quantity: 1}
+	ex.submit(quote, 0, 0)
+	ex.submit(&common.Order{OrderID: quote.OrderID, TraderID: 2, OrderType: "CANCEL"}, 0, 0)
+	ex.MakeTrades(0, 0)
+
+	// the trade is at 110, the buyer makes 40 and the seller 60 before fees
+	want := Revenue{Shout: 3, Trade: 4, Profit: 10, Info: 1.5}
+	if got := ex.TotalRevenue(); got != want {
+		t.Errorf("revenue is %+v, want %+v", got, want)
+	}
+	for _, c := range []struct {
+		trader  bots.RobotTrader
+		balance float64
+	}{{buyer, 40 - 7.5}, {seller, 60 - 9.5}, {idle, -1.5}} {
+		info := c.trader.(*bots.ZICTrader).Info
+		if math.Abs(info.Balance-c.balance) > 1e-9 {
+			t.Errorf("trader %d has balance %.2f, want %.2f", info.TraderID, info.Balance, c.balance)
+		}
+	}
+}
+
+func TestValidateFees(t *testing.T) {
+	cases := []struct {
+		fees  Fees
+		valid bool
+	}{
+		{Fees{}, true},
+		{Fees{Shout: 1, Trade: 1, Profit: 1, Info: 1}, true},
+		{Fees{Trade: -1}, false},
+		{Fees{Profit: 1.5}, false},
+	}
+
+	for i, c := range cases {
+		if err := c.fees.Validate(); (err == nil) != c.valid {
+			t.Errorf("case %d: got error %v, valid %v", i, err, c.valid)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package exchange
+
+import (
+	"fmt"
+	"mexs/bots"
+	"mexs/common"
+)
+
+// Instrument is one of the goods traded in an exchange, each one has its own
+// order book, price bounds and supply and demand schedule. Traders work on their
+// execution orders in turn, so one with units in several instruments trades them
+// one after the other
+type Instrument struct {
+	Symbol string `json:"Symbol"`
+	// MinPrice and MaxPrice bound the shouts, when both are 0 the ones in MarketInfo are used
+	MinPrice float64 `json:"MinPrice,omitempty"`
+	MaxPrice float64 `json:"MaxPrice,omitempty"`
+	// Alloc and SandDs are the schedule of the instrument, when SandDs is nil the
+	// schedule given to StartMarket is used
+	Alloc  AllocationSchedule `json:"-"`
+	SandDs map[int]SandD      `json:"-"`
+}
+
+// ValidateInstruments checks that symbols are unique and price bounds make sense
+func ValidateInstruments(instruments []Instrument) error {
+	seen := map[string]bool{}
+	for _, ins := range instruments {
+		if ins.Symbol == "" {
+			return fmt.Errorf("instruments need a symbol")
+		}
+		if seen[ins.Symbol] {
+			return fmt.Errorf("symbol %s is used by two instruments", ins.Symbol)
+		}
+		seen[ins.Symbol] = true
+		if ins.MinPrice < 0 || ins.MaxPrice < ins.MinPrice {
+			return fmt.Errorf("price bounds of %s are not valid", ins.Symbol)
+		}
+	}
+	return nil
+}
+
+// market is the state of one instrument while the exchange runs
+type market struct {
+	Instrument
+	book *OrderBook
+	// trades made in the instrument and the last WindowSizeEE prices for the EE estimate
+	trades   int
+	eePrices []float64
+	// priceHistory has the last prices for the moving average pricing rule
+	priceHistory []float64
+}
+
+// setMarkets makes a book for every instrument, an exchange without instruments
+// trades only common.DefaultSymbol
+func (ex *Exchange) setMarkets() {
+	instruments := ex.Instruments
+	if len(instruments) == 0 {
+		instruments = []Instrument{{Symbol: common.DefaultSymbol}}
+	}
+
+	ex.markets = map[string]*market{}
+	ex.symbols = []string{}
+	for _, ins := range instruments {
+		m := &market{
+			Instrument:   ins,
+			book:         &OrderBook{},
+			eePrices:     make([]float64, ex.GAVector.WindowSizeEE),
+			priceHistory: []float64{},
+		}
+		m.book.Init()
+		ex.markets[ins.Symbol] = m
+		ex.symbols = append(ex.symbols, ins.Symbol)
+	}
+}
+
+// market returns the state of the instrument with the given symbol or nil if it is not traded
+func (ex *Exchange) market(symbol string) *market {
+	if symbol == "" {
+		symbol = common.DefaultSymbol
+	}
+	return ex.markets[symbol]
+}
+
+// book returns the order book of the instrument an order is for
+func (ex *Exchange) book(order *common.Order) (*OrderBook, error) {
+	m := ex.market(order.GetSymbol())
+	if m == nil {
+		return nil, fmt.Errorf("symbol %s is not traded in this exchange", order.GetSymbol())
+	}
+	return m.book, nil
+}
+
+// priceBounds returns the price range shouts in the instrument must be in
+func (ex *Exchange) priceBounds(symbol string) (float64, float64) {
+	m := ex.market(symbol)
+	if m == nil || (m.MinPrice == 0 && m.MaxPrice == 0) {
+		return ex.Info.MinPrice, ex.Info.MaxPrice
+	}
+	return m.MinPrice, m.MaxPrice
+}
+
+// setAgentOrders gives a trader new orders in one instrument, its orders in
+// other instruments are kept ahead of them
+func (ex *Exchange) setAgentOrders(traderID int, symbol string, orders []*bots.TraderOrder) {
+	all := []*bots.TraderOrder{}
+	for _, o := range ex.agents[traderID].GetExecutionOrder() {
+		if o.GetSymbol() != symbol {
+			all = append(all, o)
+		}
+	}
+	all = append(all, orders...)
+	ex.agents[traderID].SetOrders(all)
+	ex.recordUnits(traderID, all)
+}
@@ -0,0 +1,110 @@
+package exchange
+
+import (
+	"mexs/bots"
+	"mexs/common"
+	"mexs/results"
+	"testing"
+)
+
+// symbolTrader is a test trader with units of one instrument
+func symbolTrader(id int, side, symbol string, limit float64) bots.RobotTrader {
+	trader := testTrader(id, side, limit, 1)
+	trader.SetOrders([]*bots.TraderOrder{{LimitPrice: limit, Quantity: 1, Type: side, Symbol: symbol}})
+	return trader
+}
+
+func TestInstrumentsHaveTheirOwnBooks(t *testing.T) {
+	ex := &Exchange{Sink: results.Discard, Instruments: []Instrument{{Symbol: "A", MinPrice: 10, MaxPrice: 20}, {Symbol: "B"}}}
+	ex.Init(AuctionParameters{KPricing: 0.5, OrderQueuing: 1}, testInfo, nil, nil)
+	ex.Rules, _ = BuildRules([]string{"PRICE_RANGE"})
+	setTestTraders(ex, symbolTrader(0, "BID", "A", 20), symbolTrader(1, "ASK", "B", 5),
+		symbolTrader(2, "ASK", "A", 10), symbolTrader(3, "BID", "B", 100))
+	ex.OpenDay(0)
+
+	if ok, reason := ex.OrderComplies(&common.Order{TraderID: 0, OrderType: "BID", Price: 25, Quantity: 1, Symbol: "A"}, 0); ok {
+		t.Error("bid above the max price of its instrument was accepted")
+	} else if reason != ReasonPriceRange {
+		t.Errorf("bid above the max price was rejected with %s", reason)
+	}
+	if ok, _ := ex.OrderComplies(&common.Order{TraderID: 3, OrderType: "BID", Price: 25, Quantity: 1, Symbol: "B"}, 0); !ok {
+		t.Error("instrument without bounds did not use the bounds of the market")
+	}
+
+	place(t, ex, &common.Order{TraderID: 0, OrderType: "BID", Price: 18, Quantity: 1, Symbol: "A"})
+	place(t, ex, &common.Order{TraderID: 1, OrderType: "ASK", Price: 12, Quantity: 1, Symbol: "B"})
+	ex.MakeTrades(0, 0)
+	if trades := len(ex.market("A").book.tradeRecord) + len(ex.market("B").book.tradeRecord); trades != 0 {
+		t.Fatalf("orders of different instruments made %d trades", trades)
+	}
+
+	place(t, ex, &common.Order{TraderID: 2, OrderType: "ASK", Price: 14, Quantity: 1, Symbol: "A"})
+	place(t, ex, &common.Order{TraderID: 3, OrderType: "BID", Price: 30, Quantity: 1, Symbol: "B"})
+	ex.MakeTrades(1, 0)
+	for symbol, price := range map[string]float64{"A": 16, "B": 21} {
+		trades := ex.market(symbol).book.tradeRecord
+		if len(trades) != 1 || trades[0].Price != price || trades[0].Symbol != symbol {
+			t.Errorf("%s: trades are %+v, want one at %.2f", symbol, trades, price)
+		}
+	}
+
+	if err := ex.PlaceOrder(&common.Order{TraderID: 0, OrderType: "BID", Price: 15, Quantity: 1, Symbol: "C"}); err == nil {
+		t.Error("order for an instrument that is not traded was placed")
+	}
+}
+
+func TestAmendKeepsTheInstrumentOfTheOrder(t *testing.T) {
+	ex := &Exchange{Sink: results.Discard, Instruments: []Instrument{{Symbol: "A"}}}
+	ex.Init(AuctionParameters{KPricing: 0.5, OrderQueuing: 1}, testInfo, nil, nil)
+	setTestTraders(ex, symbolTrader(0, "BID", "A", 50), symbolTrader(1, "ASK", "A", 10))
+	ex.OpenDay(0)
+
+	bid := &common.Order{TraderID: 0, OrderType: "BID", Price: 20, Quantity: 1, Symbol: "A", SimTime: 3}
+	place(t, ex, bid)
+	place(t, ex, &common.Order{TraderID: 1, OrderType: "ASK", Price: 40, Quantity: 1, Symbol: "A"})
+	place(t, ex, &common.Order{TraderID: 0, OrderType: "AMEND", OrderID: bid.OrderID, Price: 44, Quantity: 1, Symbol: "A"})
+
+	amended, ok := ex.market("A").book.GetOrder(bid.OrderID)
+	if !ok {
+		t.Fatal("the amended bid is not in the book")
+	}
+	if amended.Symbol != "A" || amended.SimTime != 3 {
+		t.Errorf("the amended bid has symbol %q and sim time %.1f, want A and 3", amended.Symbol, amended.SimTime)
+	}
+
+	ex.MakeTrades(1, 0)
+	trades := ex.market("A").book.tradeRecord
+	if len(trades) != 1 || trades[0].Price != 42 || trades[0].Symbol != "A" {
+		t.Errorf("trades are %+v, want one of A at 42", trades)
+	}
+}
+
+func TestUnknownSymbolHasNoBook(t *testing.T) {
+	ex := &Exchange{Sink: results.Discard, Instruments: []Instrument{{Symbol: "A"}}}
+	ex.Init(AuctionParameters{OrderQueuing: 1}, testInfo, nil, nil)
+
+	if _, err := ex.book(&common.Order{OrderType: "BID", Symbol: "B"}); err == nil {
+		t.Error("symbol that is not traded has a book")
+	}
+	if _, err := ex.PriceMatch(&common.Order{OrderType: "BID"}, &common.Order{OrderType: "ASK"}); err == nil {
+		t.Error("orders of a symbol that is not traded were matched")
+	}
+}
+
+func TestValidateInstruments(t *testing.T) {
+	cases := []struct {
+		instruments []Instrument
+		valid       bool
+	}{
+		{[]Instrument{{Symbol: "A"}, {Symbol: "B", MinPrice: 1, MaxPrice: 2}}, true},
+		{[]Instrument{{Symbol: "A"}, {Symbol: "A"}}, false},
+		{[]Instrument{{}}, false},
+		{[]Instrument{{Symbol: "A", MinPrice: 5, MaxPrice: 1}}, false},
+	}
+
+	for i, c := range cases {
+		if err := ValidateInstruments(c.instruments); (err == nil) != c.valid {
+			t.Errorf("case %d: got error %v, valid %v", i, err, c.valid)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package exchange
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"mexs/bots"
+	"mexs/common"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Types of the events in the journal
+const (
+	// EventDayStart is a trading day opening with empty books
+	EventDayStart = "DAY_START"
+	// EventReplenish is a trader getting new units from the schedule
+	EventReplenish = "REPLENISH"
+	// EventSubmit is an order placed in the book
+	EventSubmit = "SUBMIT"
+	// EventReject is an order refused by the market rules or the book
+	EventReject = "REJECT"
+	// EventDrop is a resting order taken out of the book as its trader has no units left
+	EventDrop = "DROP"
+	// EventTrade is a fill between two resting orders
+	EventTrade = "TRADE"
+	// EventUpdate is the market update sent to the agents
+	EventUpdate = "UPDATE"
+	// EventDayEnd is a trading day closing
+	EventDayEnd = "DAY_END"
+)
+
+// JournalFile is the name of the journal in the folder of an experiment
+const JournalFile = "JOURNAL.jsonl"
+
+// JournalEvent is one entry of the journal, only the fields of its type are set
+type JournalEvent struct {
+	Seq      int     `json:"Seq"`
+	Type     string  `json:"Type"`
+	Day      int     `json:"Day"`
+	TimeStep int     `json:"TimeStep"`
+	SimTime  float64 `json:"SimTime"`
+	Symbol   string  `json:"Symbol,omitempty"`
+	TraderID int     `json:"TraderID"`
+	// Order is the order as the trader sent it in SUBMIT and REJECT
+	Order *common.Order `json:"Order,omitempty"`
+	// OrderID is the id the order got in the book in SUBMIT and the dropped one in DROP
+	OrderID int    `json:"OrderID,omitempty"`
+	Reason  string `json:"Reason,omitempty"`
+	// Symbols and OrderQueuing are the books opened in DAY_START and how many
+	// orders a trader can queue on each side of them
+	Symbols      []string           `json:"Symbols,omitempty"`
+	OrderQueuing int                `json:"OrderQueuing,omitempty"`
+	Units        []bots.TraderOrder `json:"Units,omitempty"`
+	Trade        *JournalTrade      `json:"Trade,omitempty"`
+	Update       *JournalUpdate     `json:"Update,omitempty"`
+}
+
+// JournalTrade is a trade in the journal, orders are referenced by their id in the book
+type JournalTrade struct {
+	TradeID     int     `json:"TradeID"`
+	BuyOrderID  int     `json:"BuyOrderID"`
+	SellOrderID int     `json:"SellOrderID"`
+	BuyerID     int     `json:"BuyerID"`
+	SellerID    int     `json:"SellerID"`
+	Price       float64 `json:"Price"`
+	Quantity    int     `json:"Quantity"`
+	Event       string  `json:"Event"`
+}
+
+// JournalUpdate is the top of the book when a market update is sent, -1 means the side is empty
+type JournalUpdate struct {
+	BestBid     float64 `json:"BestBid"`
+	BestAsk     float64 `json:"BestAsk"`
+	LastTradeID int     `json:"LastTradeID"`
+	// Sealed is true in auctions, where agents are not shown the book
+	Sealed bool `json:"Sealed,omitempty"`
+}
+
+func (e JournalEvent) String() string {
+	head := fmt.Sprintf("#%d day %d step %d [%.3f] %s", e.Seq, e.Day, e.TimeStep, e.SimTime, e.Type)
+	switch e.Type {
+	case EventDayStart:
+		return fmt.Sprintf("%s symbols %v", head, e.Symbols)
+	case EventReplenish:
+		return fmt.Sprintf("%s %s trader %d units %v", head, e.Symbol, e.TraderID, e.Units)
+	case EventSubmit:
+		return fmt.Sprintf("%s %s trader %d %s %.2f x %d as order %d", head, e.Symbol, e.TraderID,
+			e.Order.OrderType, e.Order.Price, e.Order.Quantity, e.OrderID)
+	case EventReject:
+		return fmt.Sprintf("%s %s trader %d %s %.2f x %d: %s", head, e.Symbol, e.TraderID,
+			e.Order.OrderType, e.Order.Price, e.Order.Quantity, e.Reason)
+	case EventDrop:
+		return fmt.Sprintf("%s %s trader %d order %d", head, e.Symbol, e.TraderID, e.OrderID)
+	case EventTrade:
+		return fmt.Sprintf("%s %s trade %d %d x %.2f buyer %d (order %d) seller %d (order %d) %s", head, e.Symbol,
+			e.Trade.TradeID, e.Trade.Quantity, e.Trade.Price, e.Trade.BuyerID, e.Trade.BuyOrderID,
+			e.Trade.SellerID, e.Trade.SellOrderID, e.Trade.Event)
+	case EventUpdate:
+		return fmt.Sprintf("%s %s bid %.2f ask %.2f last trade %d", head, e.Symbol, e.Update.BestBid,
+			e.Update.BestAsk, e.Update.LastTradeID)
+	}
+	return head
+}
+
+// Journal receives every event of an exchange in the order it happens, each experiment
+// id has its own append-only journal
+type Journal interface {
+	Record(eid string, e JournalEvent) error
+	// Close flushes anything the journal still holds
+	Close() error
+}
+
+// FileJournal writes the journal of each experiment as JSON lines to Root/eid/JOURNAL.jsonl
+type FileJournal struct {
+	Root string
+
+	mu    sync.Mutex
+	files map[string]*journalFile
+}
+
+type journalFile struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+func (j *FileJournal) Record(eid string, e JournalEvent) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, ok := j.files[eid]
+	if !ok {
+		path, err := JournalPath(j.Root, eid)
+		if err != nil {
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		if j.files == nil {
+			j.files = map[string]*journalFile{}
+		}
+		f = &journalFile{file: file, w: bufio.NewWriter(file)}
+		j.files[eid] = f
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	// the journal is flushed at the end of every day so it can be read while the run goes on
+	if e.Type == EventDayEnd {
+		return f.w.Flush()
+	}
+	return nil
+}
+
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var first error
+	for eid, f := range j.files {
+		if err := f.w.Flush(); err != nil && first == nil {
+			first = err
+		}
+		if err := f.file.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(j.files, eid)
+	}
+	return first
+}
+
+// JournalPath returns the path of the journal of experiment eid, making its folder if needed
+func JournalPath(root, eid string) (string, error) {
+	dir, err := filepath.Abs(filepath.Join(root, eid))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, JournalFile), nil
+}
+
+// ReadJournal reads all the events of a journal file in order
+func ReadJournal(path string) ([]JournalEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events := []JournalEvent{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e JournalEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d of %s: %s", len(events)+1, path, err.Error())
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// record adds an event of time step t to the journal, it is a no-op when there is no journal
+func (ex *Exchange) record(t int, e JournalEvent) {
+	if ex.Journal == nil {
+		return
+	}
+
+	ex.journalSeq++
+	e.Seq = ex.journalSeq
+	e.Day = ex.day.Day
+	e.TimeStep = t
+	e.SimTime = ex.clock
+	if err := ex.Journal.Record(ex.EID, e); err != nil {
+		log.WithFields(log.Fields{
+			"EID":   ex.EID,
+			"Type":  e.Type,
+			"error": err.Error(),
+		}).Error("Journal event could not be recorded")
+	}
+}
+
+// recordOrder adds a SUBMIT or REJECT event for an order, submitted is the order as the trader sent it
+func (ex *Exchange) recordOrder(t int, eventType string, submitted common.Order, orderID int, reason string) {
+	if ex.Journal == nil {
+		return
+	}
+
+	ex.record(t, JournalEvent{
+		Type:     eventType,
+		Symbol:   submitted.GetSymbol(),
+		TraderID: submitted.TraderID,
+		Order:    &submitted,
+		OrderID:  orderID,
+		Reason:   reason,
+	})
+}
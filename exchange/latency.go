@@ -0,0 +1,215 @@
+package exchange
+
+import (
+	"container/heap"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"mexs/common"
+)
+
+// Latency is a delay in time steps, it is either fixed or drawn for every message
+type Latency struct {
+	// Type is FIXED (default), UNIFORM or EXPONENTIAL
+	Type string `json:"Type,omitempty"`
+	// Mean is the fixed delay or the mean of the exponential one
+	Mean float64 `json:"Mean,omitempty"`
+	// Min and Max bound the uniform delay
+	Min float64 `json:"Min,omitempty"`
+	Max float64 `json:"Max,omitempty"`
+}
+
+// Validate checks the type and that no delay can be negative
+func (l Latency) Validate() error {
+	switch l.Type {
+	case "", "FIXED", "EXPONENTIAL":
+		if l.Mean < 0 {
+			return fmt.Errorf("latency mean %.2f is negative", l.Mean)
+		}
+	case "UNIFORM":
+		if l.Min < 0 || l.Max < l.Min {
+			return fmt.Errorf("uniform latency bounds [%.2f, %.2f] are not valid", l.Min, l.Max)
+		}
+	default:
+		return fmt.Errorf("unknown latency type %s", l.Type)
+	}
+	return nil
+}
+
+// AgentLatency is the delay of the orders an agent sends and of the market data it gets
+type AgentLatency struct {
+	Order Latency `json:"Order,omitempty"`
+	Data  Latency `json:"Data,omitempty"`
+}
+
+// LatencyConfig sets the latency of every agent, agents not in Agents use the default one
+type LatencyConfig struct {
+	AgentLatency
+	Agents map[int]AgentLatency `json:"Agents,omitempty"`
+	// Seed varies the delays drawn for the same run seed
+	Seed int64 `json:"Seed,omitempty"`
+}
+
+// Validate checks the latency of every agent
+func (c *LatencyConfig) Validate() error {
+	all := []AgentLatency{c.AgentLatency}
+	for _, a := range c.Agents {
+		all = append(all, a)
+	}
+
+	for _, a := range all {
+		if err := a.Order.Validate(); err != nil {
+			return err
+		}
+		if err := a.Data.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// of returns the latency of a trader
+func (c *LatencyConfig) of(traderID int) AgentLatency {
+	if a, ok := c.Agents[traderID]; ok {
+		return a
+	}
+	return c.AgentLatency
+}
+
+// message is an order or market update on its way, due is the clock it arrives at
+type message struct {
+	due      float64
+	seq      int
+	traderID int
+	order    *common.Order
+	update   common.MarketUpdate
+}
+
+// messageHeap keeps the messages in the order they arrive, messages due at the
+// same time keep the order they were sent in. It implements container/heap.Interface
+type messageHeap []message
+
+func (h messageHeap) Len() int {
+	return len(h)
+}
+
+func (h messageHeap) Less(i, j int) bool {
+	if h[i].due != h[j].due {
+		return h[i].due < h[j].due
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h messageHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *messageHeap) Push(x interface{}) {
+	*h = append(*h, x.(message))
+}
+
+func (h *messageHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	m := old[n-1]
+	*h = old[:n-1]
+	return m
+}
+
+// draw returns a delay for one message
+func (ex *Exchange) draw(l Latency) float64 {
+	switch l.Type {
+	case "UNIFORM":
+		return l.Min + ex.latencyRng.Float64()*(l.Max-l.Min)
+	case "EXPONENTIAL":
+		return ex.latencyRng.ExpFloat64() * l.Mean
+	}
+	return l.Mean
+}
+
+// orderDelay draws the time an order of the trader takes to reach the book
+func (ex *Exchange) orderDelay(traderID int) float64 {
+	if ex.Latency == nil {
+		return 0
+	}
+	return ex.draw(ex.Latency.of(traderID).Order)
+}
+
+// dataDelay draws the time a market update takes to reach the trader
+func (ex *Exchange) dataDelay(traderID int) float64 {
+	if ex.Latency == nil {
+		return 0
+	}
+	return ex.draw(ex.Latency.of(traderID).Data)
+}
+
+// resetMessages drops the orders and updates still on their way when a day ends
+func (ex *Exchange) resetMessages() {
+	ex.inflight = messageHeap{}
+	ex.feeds = messageHeap{}
+}
+
+// sendOrder puts an order on its way to the book
+func (ex *Exchange) sendOrder(order *common.Order, delay float64) {
+	ex.msgSeq++
+	heap.Push(&ex.inflight, message{
+		due:      ex.clock + delay,
+		seq:      ex.msgSeq,
+		traderID: order.TraderID,
+		order:    order,
+	})
+	log.WithFields(log.Fields{
+		"TID":   order.TraderID,
+		"Delay": delay,
+	}).Debug("Order sent")
+}
+
+// sendUpdate gives the update to the agent or puts it on its way if the agent has data latency
+func (ex *Exchange) sendUpdate(traderID int, update common.MarketUpdate) {
+	delay := ex.dataDelay(traderID)
+	if delay <= 0 {
+		ex.agents[traderID].MarketUpdate(update)
+		return
+	}
+
+	ex.msgSeq++
+	heap.Push(&ex.feeds, message{
+		due:      ex.clock + delay,
+		seq:      ex.msgSeq,
+		traderID: traderID,
+		update:   update,
+	})
+}
+
+// deliverOrders processes the orders that have reached the book by the current clock,
+// in continuous phases each one is matched as it arrives
+func (ex *Exchange) deliverOrders(t, d int) {
+	for ex.inflight.Len() > 0 && ex.inflight[0].due <= ex.clock {
+		m := heap.Pop(&ex.inflight).(message)
+		ex.receive(m.order, t, d)
+	}
+}
+
+// deliverUpdates hands the agents the market updates that have reached them, agents
+// that left the exchange do not get them
+func (ex *Exchange) deliverUpdates() {
+	for ex.feeds.Len() > 0 && ex.feeds[0].due <= ex.clock {
+		m := heap.Pop(&ex.feeds).(message)
+		if agent, ok := ex.agents[m.traderID]; ok {
+			agent.MarketUpdate(m.update)
+		}
+	}
+}
+
+// receive checks an order that reached the book and places it, it is false when
+// the order is rejected
+func (ex *Exchange) receive(order *common.Order, t, d int) bool {
+	if !ex.checkOrder(order, t, d) {
+		return false
+	}
+
+	ex.submit(order, t, d)
+	if !ex.sealedAt(t) {
+		ex.MakeTrades(t, d)
+	}
+	return true
+}
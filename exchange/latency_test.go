@@ -0,0 +1,83 @@
+package exchange
+
+import (
+	"mexs/common"
+	"mexs/results"
+	"testing"
+)
+
+func TestOrdersReachTheBookAfterTheirLatency(t *testing.T) {
+	ex := &Exchange{Latency: &LatencyConfig{
+		AgentLatency: AgentLatency{Order: Latency{Mean: 1.5}},
+		Agents:       map[int]AgentLatency{1: {}},
+	}}
+	journal := runTestDay(ex)
+
+	submits := journal.of(EventSubmit)
+	if len(submits) == 0 {
+		t.Fatal("no order was placed")
+	}
+	for _, e := range submits {
+		if e.TraderID != 1 && e.TimeStep-e.Order.TimeStep != 2 {
+			t.Errorf("order of trader %d sent at step %d reached the book at step %d", e.TraderID,
+				e.Order.TimeStep, e.TimeStep)
+		}
+		if e.TraderID == 1 && e.TimeStep != e.Order.TimeStep {
+			t.Errorf("order of trader 1 with no latency sent at step %d reached the book at step %d",
+				e.Order.TimeStep, e.TimeStep)
+		}
+	}
+}
+
+func TestMarketDataIsDelayed(t *testing.T) {
+	ex := &Exchange{Sink: results.Discard, Latency: &LatencyConfig{AgentLatency: AgentLatency{Data: Latency{Mean: 0.5}}}}
+	ex.Init(AuctionParameters{}, testInfo, nil, nil)
+	setTestTraders(ex, testTrader(0, "BID", 150, 1))
+
+	ex.clock = 2
+	ex.sendUpdate(0, common.MarketUpdate{})
+	if ex.feeds.Len() != 1 || ex.feeds[0].due != 2.5 {
+		t.Fatalf("update was not put on its way")
+	}
+	ex.deliverUpdates()
+	if ex.feeds.Len() != 1 {
+		t.Error("update was delivered before its latency")
+	}
+	ex.clock = 2.5
+	ex.deliverUpdates()
+	if ex.feeds.Len() != 0 {
+		t.Error("update was not delivered after its latency")
+	}
+}
+
+func TestLatencyDraws(t *testing.T) {
+	ex := &Exchange{Sink: results.Discard, Latency: &LatencyConfig{}}
+	ex.Init(AuctionParameters{}, testInfo, nil, nil)
+
+	if d := ex.draw(Latency{Mean: 2}); d != 2 {
+		t.Errorf("fixed latency drew %.3f", d)
+	}
+	for i := 0; i < 100; i++ {
+		if d := ex.draw(Latency{Type: "UNIFORM", Min: 1, Max: 3}); d < 1 || d > 3 {
+			t.Fatalf("uniform latency in [1, 3] drew %.3f", d)
+		}
+		if d := ex.draw(Latency{Type: "EXPONENTIAL", Mean: 1}); d < 0 {
+			t.Fatalf("exponential latency drew %.3f", d)
+		}
+	}
+
+	for i, c := range []struct {
+		latency Latency
+		valid   bool
+	}{
+		{Latency{Mean: 1}, true},
+		{Latency{Type: "UNIFORM", Min: 1, Max: 2}, true},
+		{Latency{Mean: -1}, false},
+		{Latency{Type: "UNIFORM", Min: 2, Max: 1}, false},
+		{Latency{Type: "NORMAL"}, false},
+	} {
+		if err := c.latency.Validate(); (err == nil) != c.valid {
+			t.Errorf("case %d: got error %v, valid %v", i, err, c.valid)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// MarketSelector picks the exchange each trader goes to at the start of a trading day
+// in a competition, it learns from the profit the traders made in the markets they picked
+type MarketSelector interface {
+	Name() string
+	// Select returns the index of the market trader traderID uses on day d
+	Select(traderID, d, markets int) int
+	// Reward is the profit the trader made in the market it picked, fees included
+	Reward(traderID, market int, profit float64)
+}
+
+// SelectorConfig is how the market selector is given in the configuration file
+type SelectorConfig struct {
+	// Type is RANDOM or EPSILON_GREEDY (default)
+	Type string `json:"Type,omitempty"`
+	// Epsilon is the chance of picking a market at random in EPSILON_GREEDY
+	Epsilon float64 `json:"Epsilon,omitempty"`
+}
+
+// NewMarketSelector builds the market selector in the configuration, rng is the source
+// of its random choices
+func NewMarketSelector(config SelectorConfig, rng *rand.Rand) (MarketSelector, error) {
+	switch config.Type {
+	case "RANDOM":
+		return &RandomSelector{rng: rng}, nil
+	case "", "EPSILON_GREEDY":
+		if config.Epsilon < 0 || config.Epsilon > 1 {
+			return nil, fmt.Errorf("epsilon %.2f is not in [0, 1]", config.Epsilon)
+		}
+		return &EpsilonGreedySelector{Epsilon: config.Epsilon, rng: rng}, nil
+	}
+	return nil, fmt.Errorf("unknown market selector %s", config.Type)
+}
+
+// RandomSelector sends every trader to a market picked uniformly at random each day
+type RandomSelector struct {
+	rng *rand.Rand
+}
+
+func (s *RandomSelector) Name() string {
+	return "RANDOM"
+}
+
+func (s *RandomSelector) Select(traderID, d, markets int) int {
+	return s.rng.Intn(markets)
+}
+
+func (s *RandomSelector) Reward(traderID, market int, profit float64) {}
+
+// EpsilonGreedySelector sends a trader to the market with the best mean daily profit
+// so far and to a random one with probability Epsilon. Markets a trader has
+// not tried yet are picked first
+type EpsilonGreedySelector struct {
+	Epsilon float64
+	// profits[id][m] is the total profit of trader id in market m
+	profits map[int][]float64
+	// visits[id][m] is the number of days trader id picked market m
+	visits map[int][]int
+	rng    *rand.Rand
+}
+
+func (s *EpsilonGreedySelector) Name() string {
+	return "EPSILON_GREEDY"
+}
+
+func (s *EpsilonGreedySelector) Select(traderID, d, markets int) int {
+	s.init(traderID, markets)
+	if s.rng.Float64() < s.Epsilon {
+		return s.rng.Intn(markets)
+	}
+
+	best := []int{}
+	bestValue := math.Inf(-1)
+	for m := 0; m < markets; m++ {
+		value := math.Inf(1)
+		if s.visits[traderID][m] > 0 {
+			value = s.profits[traderID][m] / float64(s.visits[traderID][m])
+		}
+
+		if value > bestValue {
+			best = []int{m}
+			bestValue = value
+		} else if value == bestValue {
+			best = append(best, m)
+		}
+	}
+	// Ties are broken at random so traders do not all crowd the first market
+	return best[s.rng.Intn(len(best))]
+}
+
+func (s *EpsilonGreedySelector) Reward(traderID, market int, profit float64) {
+	s.profits[traderID][market] += profit
+	s.visits[traderID][market]++
+}
+
+func (s *EpsilonGreedySelector) init(traderID, markets int) {
+	if s.profits == nil {
+		s.profits = map[int][]float64{}
+		s.visits = map[int][]int{}
+	}
+
+	if len(s.profits[traderID]) != markets {
+		s.profits[traderID] = make([]float64, markets)
+		s.visits[traderID] = make([]int, markets)
+	}
+}
@@ -0,0 +1,66 @@
+package exchange
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestEpsilonGreedyTriesEveryMarketThenExploits(t *testing.T) {
+	s, err := NewMarketSelector(SelectorConfig{}, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profits := []float64{1, 5, 2}
+	tried := map[int]bool{}
+	for d := 0; d < len(profits); d++ {
+		m := s.Select(7, d, len(profits))
+		if tried[m] {
+			t.Fatalf("day %d: market %d picked again before every market was tried", d, m)
+		}
+		tried[m] = true
+		s.Reward(7, m, profits[m])
+	}
+
+	for d := 3; d < 10; d++ {
+		if m := s.Select(7, d, len(profits)); m != 1 {
+			t.Errorf("day %d: picked market %d, want the most profitable market 1", d, m)
+		}
+	}
+	if m := s.Select(8, 0, len(profits)); m < 0 || m >= len(profits) {
+		t.Errorf("new trader picked market %d", m)
+	}
+}
+
+func TestEpsilonGreedyExploresWithEpsilon(t *testing.T) {
+	s, err := NewMarketSelector(SelectorConfig{Epsilon: 1}, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Select(0, 0, 2)
+	s.Reward(0, 0, 100)
+	s.Reward(0, 1, -100)
+
+	picks := map[int]int{}
+	for d := 0; d < 200; d++ {
+		picks[s.Select(0, d, 2)]++
+	}
+	if picks[1] == 0 {
+		t.Error("selector with epsilon 1 never explored the worse market")
+	}
+}
+
+func TestNewMarketSelector(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, c := range []SelectorConfig{{Type: "RANDOM"}, {Type: "EPSILON_GREEDY", Epsilon: 0.1}} {
+		s, err := NewMarketSelector(c, rng)
+		if err != nil || s.Name() != c.Type {
+			t.Errorf("%s: got %v, %v", c.Type, s, err)
+		}
+	}
+	for _, c := range []SelectorConfig{{Type: "GREEDY"}, {Epsilon: 1.5}, {Epsilon: -0.1}} {
+		if _, err := NewMarketSelector(c, rng); err == nil {
+			t.Errorf("%+v was accepted", c)
+		}
+	}
+}
@@ -1,50 +1,134 @@
 package exchange
 
 import (
-	"encoding/csv"
+	"container/heap"
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"mexs/common"
-	"os"
-	"path/filepath"
+	"mexs/results"
 	"sort"
 	"strconv"
 )
 
-//NOTE: !!! IMPORTANT ORDERBOOK ASSUMES ONE ORDER PER TRADER AT ANY GIVEN TIME !!!
-
 type OrderBookHalf struct {
 	// bookType ASK or BID
 	BookType string
-	// Map of traderID to orders for now only one bid
-	// per agent, this could be expanded using slices
+	// Map of orderID to orders, a trader can have many orders in the book
 	Orders map[int]*common.Order
 	// Current best price negative values mean that they are uninitialized
 	BestPrice float64
-	// traders offering best price uninitialized
-	BestOrders []*common.Order
 	// Max Depth ignored for now
 	MaxDepth int
+	// traderOrders maps a trader to its orders in arrival order
+	traderOrders map[int][]*common.Order
+	// queue keeps the orders in price-time priority
+	queue orderHeap
+	// entries maps orderID to its place in the queue
+	entries map[int]*bookEntry
+	// clock is the arrival number given to the next order, it is shared by both halves of
+	// the book so a bid and an ask can be told apart by their arrival
+	clock *int
+	// levels aggregates the resting orders at each price
+	levels map[float64]*priceLevel
+	// prices are the prices with resting orders from best to worst
+	prices []float64
+	// units is the total quantity resting in this half
+	units int
+}
+
+// priceLevel is the quantity and number of orders resting at one price
+type priceLevel struct {
+	quantity int
+	orders   int
 }
 
-func (ob *OrderBookHalf) init(bookType string, maxDepth int) {
+func (ob *OrderBookHalf) init(bookType string, maxDepth int, clock *int) {
 	ob.BookType = bookType
 	ob.MaxDepth = maxDepth
 	ob.Orders = make(map[int]*common.Order)
 	ob.BestPrice = -1
-	ob.BestOrders = make([]*common.Order, 0)
+	ob.traderOrders = make(map[int][]*common.Order)
+	ob.queue = orderHeap{highFirst: bookType == "BID"}
+	ob.entries = make(map[int]*bookEntry)
+	ob.clock = clock
+	ob.levels = make(map[float64]*priceLevel)
+	ob.prices = make([]float64, 0)
+	ob.units = 0
 }
 
+// OrdersToList returns the resting orders, the order of the list is not sorted
+// by priority but it is always the same for the same book
 func (ob *OrderBookHalf) OrdersToList() []*common.Order {
-	orders := []*common.Order{}
-	for _, k := range ob.Orders {
-		orders = append(orders, k)
+	orders := make([]*common.Order, len(ob.queue.entries))
+	for ix, e := range ob.queue.entries {
+		orders[ix] = e.order
 	}
 	return orders
 }
 
-func (ob *OrderBookHalf) AddOrder(order *common.Order) error {
+// DisclosedOrders returns the orders resting in the first levels price levels,
+// levels smaller than 1 return the whole book
+func (ob *OrderBookHalf) DisclosedOrders(levels int) []*common.Order {
+	if levels < 1 || levels >= len(ob.prices) {
+		return ob.OrdersToList()
+	}
+
+	worst := ob.prices[levels-1]
+	orders := make([]*common.Order, 0)
+	for _, e := range ob.queue.entries {
+		if !ob.better(worst, e.order.Price) {
+			orders = append(orders, e.order)
+		}
+	}
+	return orders
+}
+
+// Ladder returns the first levels price levels from best to worst price,
+// levels smaller than 1 return all of them
+func (ob *OrderBookHalf) Ladder(levels int) []common.DepthLevel {
+	if levels < 1 || levels > len(ob.prices) {
+		levels = len(ob.prices)
+	}
+
+	ladder := make([]common.DepthLevel, levels)
+	for ix, p := range ob.prices[:levels] {
+		level := ob.levels[p]
+		ladder[ix] = common.DepthLevel{
+			Price:    p,
+			Quantity: level.quantity,
+			Orders:   level.orders,
+		}
+	}
+	return ladder
+}
+
+// TraderOrders returns the orders of a trader from oldest to newest
+func (ob *OrderBookHalf) TraderOrders(traderID int) []*common.Order {
+	return ob.traderOrders[traderID]
+}
+
+// Best returns the order with the highest priority or nil if the half is empty
+func (ob *OrderBookHalf) Best() *common.Order {
+	return ob.queue.peek()
+}
+
+// Depth returns the number of orders and units resting in this half
+func (ob *OrderBookHalf) Depth() (int, int) {
+	return len(ob.entries), ob.units
+}
+
+// DepthAt returns the number of orders and units resting at a price
+func (ob *OrderBookHalf) DepthAt(price float64) (int, int) {
+	level, ok := ob.levels[price]
+	if !ok {
+		return 0, 0
+	}
+	return level.orders, level.quantity
+}
+
+// fits checks an order can rest in this half, it does not look at the orders in it
+func (ob *OrderBookHalf) fits(order *common.Order) error {
 	if !order.IsValid() || order.OrderType == "NAN" {
 		return errors.New("order could not be added")
 	}
@@ -53,111 +137,166 @@ func (ob *OrderBookHalf) AddOrder(order *common.Order) error {
 		return errors.New("order and book type do not match")
 	}
 
-	ob.Orders[order.TraderID] = order
+	if order.OrderID <= 0 {
+		return errors.New("order has no order id")
+	}
 	return nil
 }
 
-func (ob *OrderBookHalf) RemoveOrder(order *common.Order) error {
-	if !order.IsValid() || order.OrderType == "NAN" {
-		return errors.New("NAN order can not be removed")
+func (ob *OrderBookHalf) AddOrder(order *common.Order) error {
+	if err := ob.fits(order); err != nil {
+		return err
 	}
 
-	if order.OrderType != ob.BookType {
-		return errors.New("order and book type do not match")
+	if _, ok := ob.Orders[order.OrderID]; ok {
+		return errors.New(fmt.Sprintf("order id %d already in the book", order.OrderID))
 	}
 
-	delete(ob.Orders, order.TraderID)
+	entry := &bookEntry{order: order, seq: *ob.clock}
+	*ob.clock++
+	heap.Push(&ob.queue, entry)
+	ob.entries[order.OrderID] = entry
+	ob.Orders[order.OrderID] = order
+	ob.traderOrders[order.TraderID] = append(ob.traderOrders[order.TraderID], order)
+
+	level, ok := ob.levels[order.Price]
+	if !ok {
+		level = &priceLevel{}
+		ob.levels[order.Price] = level
+		ix := ob.priceIndex(order.Price)
+		ob.prices = append(ob.prices, 0)
+		copy(ob.prices[ix+1:], ob.prices[ix:])
+		ob.prices[ix] = order.Price
+	}
+	level.orders++
+	level.quantity += order.Quantity
+	ob.units += order.Quantity
+
+	ob.setBestPrice()
 	return nil
 }
 
-func (ob *OrderBookHalf) GetBestOrder() ([]*common.Order, error) {
-	ob.BestPrice = -1
-	ob.BestOrders = []*common.Order{}
-
-	if len(ob.Orders) == 0 {
-		return make([]*common.Order, 0), nil
+func (ob *OrderBookHalf) RemoveOrder(order *common.Order) error {
+	if !order.IsValid() || order.OrderType == "NAN" {
+		return errors.New("NAN order can not be removed")
 	}
 
-	bestOrder := make([]*common.Order, 0)
-	if ob.BookType == "ASK" {
-		// exchange max ask should be smaller than this value
-		var currentBestPrice float64 = 1000000
-		// There is a chance that more than one trader puts in same order if
-		// there is no shout improvement or minimum increment
+	if order.OrderType != ob.BookType {
+		return errors.New("order and book type do not match")
+	}
 
-		for _, v := range ob.Orders {
-			if v.Price < currentBestPrice {
-				bestOrder = []*common.Order{v}
-				currentBestPrice = v.Price
-			} else if v.Price == currentBestPrice {
-				bestOrder = append(bestOrder, v)
-			}
-		}
+	entry, ok := ob.entries[order.OrderID]
+	if !ok {
+		return errors.New(fmt.Sprintf("order id %d is not in the book", order.OrderID))
+	}
 
-	} else if ob.BookType == "BID" {
-		// all bids should be for a positive amount of money
-		var currentBestPrice float64 = -1
-		for _, v := range ob.Orders {
-			if v.Price > currentBestPrice {
-				bestOrder = []*common.Order{v}
-				currentBestPrice = v.Price
-			} else if v.Price == currentBestPrice {
-				bestOrder = append(bestOrder, v)
-			}
+	heap.Remove(&ob.queue, entry.index)
+	delete(ob.entries, order.OrderID)
+	delete(ob.Orders, order.OrderID)
+	queued := ob.traderOrders[order.TraderID]
+	for ix, o := range queued {
+		if o.OrderID == order.OrderID {
+			queued = append(queued[:ix:ix], queued[ix+1:]...)
+			break
 		}
+	}
 
+	if len(queued) == 0 {
+		delete(ob.traderOrders, order.TraderID)
+	} else {
+		ob.traderOrders[order.TraderID] = queued
 	}
 
-	if len(bestOrder) == 0 {
-		return bestOrder, errors.New("no best order could be found for unknown reason")
+	level := ob.levels[order.Price]
+	level.orders--
+	level.quantity -= order.Quantity
+	if level.orders == 0 {
+		delete(ob.levels, order.Price)
+		ix := ob.priceIndex(order.Price)
+		ob.prices = append(ob.prices[:ix], ob.prices[ix+1:]...)
 	}
+	ob.units -= order.Quantity
 
-	return bestOrder, nil
+	ob.setBestPrice()
+	return nil
 }
 
-func (ob *OrderBookHalf) SetBestData() error {
-	orders, err := ob.GetBestOrder()
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"OrderBookType": ob.BookType,
-		}).Error("Error ocurred:", err)
-		return err
+// Reduce takes quantity units out of a resting order without changing its priority,
+// the order must keep at least one unit
+func (ob *OrderBookHalf) Reduce(order *common.Order, quantity int) error {
+	if _, ok := ob.entries[order.OrderID]; !ok {
+		return errors.New(fmt.Sprintf("order id %d is not in the book", order.OrderID))
 	}
 
-	if len(orders) == 0 {
-		return nil
+	if quantity <= 0 || quantity >= order.Quantity {
+		return errors.New(fmt.Sprintf("order id %d can not be reduced by %d units", order.OrderID, quantity))
 	}
 
-	ob.BestPrice = orders[0].Price
-	sort.Sort(sort.Reverse(common.ByTimeStep(orders)))
-	ob.BestOrders = orders
+	order.Quantity -= quantity
+	ob.levels[order.Price].quantity -= quantity
+	ob.units -= quantity
 	return nil
 }
 
+// better is true when price a has priority over price b in this half
+func (ob *OrderBookHalf) better(a, b float64) bool {
+	if ob.BookType == "BID" {
+		return a > b
+	}
+	return a < b
+}
+
+// priceIndex returns the position of price in the sorted price levels or
+// where it should be inserted
+func (ob *OrderBookHalf) priceIndex(price float64) int {
+	return sort.Search(len(ob.prices), func(i int) bool {
+		return !ob.better(ob.prices[i], price)
+	})
+}
+
+func (ob *OrderBookHalf) setBestPrice() {
+	best := ob.queue.peek()
+	if best == nil {
+		ob.BestPrice = -1
+		return
+	}
+	ob.BestPrice = best.Price
+}
+
 type OrderBook struct {
 	askBook     OrderBookHalf
 	bidBook     OrderBookHalf
 	tradeRecord []*common.Trade
 	lastTrade   *common.Trade
+	// nextOrderID is the id given to the next order placed, ids are
+	// unique for the whole experiment
+	nextOrderID int
+	// arrivals counts the orders that entered either half of the book
+	arrivals int
 }
 
 func (ob *OrderBook) Reset() {
+	// Orders left in the book expire, agents holding them see no units left
+	for _, o := range ob.askBook.Orders {
+		o.Quantity = 0
+	}
+	for _, o := range ob.bidBook.Orders {
+		o.Quantity = 0
+	}
 	ob.askBook = OrderBookHalf{}
-	ob.askBook.init("ASK", 100)
+	ob.askBook.init("ASK", 100, &ob.arrivals)
 	ob.bidBook = OrderBookHalf{}
-	ob.bidBook.init("BID", 100)
-	ob.bidBook.SetBestData()
-	ob.askBook.SetBestData()
+	ob.bidBook.init("BID", 100, &ob.arrivals)
 	ob.tradeRecord = make([]*common.Trade, 0)
 }
 
 func (ob *OrderBook) Init() {
 	ob.askBook = OrderBookHalf{}
-	ob.askBook.init("ASK", 100)
+	ob.askBook.init("ASK", 100, &ob.arrivals)
 	ob.bidBook = OrderBookHalf{}
-	ob.bidBook.init("BID", 100)
+	ob.bidBook.init("BID", 100, &ob.arrivals)
 	ob.tradeRecord = make([]*common.Trade, 0)
+	ob.nextOrderID = 1
 	ob.lastTrade = &common.Trade{
 		TradeID:  -1,
 		TimeStep: -10,
@@ -174,17 +313,20 @@ func (ob *OrderBook) AddOrder(order *common.Order) error {
 		return errors.New("orders with NAN type can not be added")
 	}
 
-	if order.OrderType == "BID" {
-		ob.bidBook.AddOrder(order)
-		return nil
+	half, err := ob.half(order.OrderType)
+	if err != nil {
+		return err
 	}
 
-	if order.OrderType == "ASK" {
-		ob.askBook.AddOrder(order)
-		return nil
+	order.OrderID = ob.nextOrderID
+	err = half.AddOrder(order)
+	if err != nil {
+		order.OrderID = 0
+		return err
 	}
 
-	return errors.New("unknown order type")
+	ob.nextOrderID++
+	return nil
 }
 
 func (ob *OrderBook) RemoveOrder(order *common.Order) error {
@@ -196,16 +338,195 @@ func (ob *OrderBook) RemoveOrder(order *common.Order) error {
 		return errors.New("orders with NAN type can not be removed")
 	}
 
-	if order.OrderType == "BID" {
-		return ob.bidBook.RemoveOrder(order)
+	half, err := ob.half(order.OrderType)
+	if err != nil {
+		return errors.New("unknown order type cannot be removed")
+	}
+
+	return half.RemoveOrder(order)
+}
+
+// ReplaceOrder swaps the order with id orderID for a new one from the same trader
+// and side, the new order keeps the order id but loses its time priority
+func (ob *OrderBook) ReplaceOrder(orderID int, order *common.Order) error {
+	old, ok := ob.GetOrder(orderID)
+	if !ok {
+		return errors.New(fmt.Sprintf("order %d can not be replaced as it is not in the book", orderID))
+	}
+
+	if old.TraderID != order.TraderID || old.OrderType != order.OrderType {
+		return errors.New(fmt.Sprintf("order %d can only be replaced by an order of the same trader and type", orderID))
+	}
+
+	if !order.IsValid() {
+		return errors.New(fmt.Sprintf("order could not be added as it is not valid: %#v", order))
+	}
+
+	// the new order is checked before the old one is taken out so a failed
+	// replacement leaves the book as it was
+	half, err := ob.half(order.OrderType)
+	if err != nil {
+		return err
+	}
+	replacement := *order
+	replacement.OrderID = orderID
+	if err := half.fits(&replacement); err != nil {
+		return err
+	}
+
+	err = ob.RemoveOrder(old)
+	if err != nil {
+		return err
+	}
+
+	order.OrderID = orderID
+	return half.AddOrder(order)
+}
+
+// arrival is the arrival number of a resting order, ok is false when it is not in the book
+func (ob *OrderBook) arrival(order *common.Order) (int, bool) {
+	half, err := ob.half(order.OrderType)
+	if err != nil {
+		return 0, false
+	}
+	entry, ok := half.entries[order.OrderID]
+	if !ok || entry.order != order {
+		return 0, false
+	}
+	return entry.seq, true
+}
+
+// arrivedBefore is true when order a entered the book before order b. A replaced order
+// arrives again when it is replaced, orders not in the book are compared by order id
+func (ob *OrderBook) arrivedBefore(a, b *common.Order) bool {
+	seqA, okA := ob.arrival(a)
+	seqB, okB := ob.arrival(b)
+	if okA && okB {
+		return seqA < seqB
+	}
+	return a.OrderID < b.OrderID
+}
+
+// Place adds an order to the book, when the trader already has maxQueue orders on that
+// side its oldest order is replaced. Values of maxQueue below 1 are treated as 1.
+// Cancel, pull and amend requests are applied to the order they reference
+func (ob *OrderBook) Place(order *common.Order, maxQueue int) error {
+	switch order.OrderType {
+	case "CANCEL":
+		return ob.CancelOrder(order.OrderID)
+	case "PULL":
+		return ob.PullOrders(order.OrderID)
+	case "AMEND":
+		return ob.AmendOrder(order)
+	}
+
+	if maxQueue < 1 {
+		maxQueue = 1
+	}
+
+	queued := ob.TraderOrders(order.TraderID, order.OrderType)
+	if len(queued) >= maxQueue {
+		return ob.ReplaceOrder(queued[0].OrderID, order)
+	}
+
+	return ob.AddOrder(order)
+}
+
+// CancelOrder takes the order with id orderID out of the book
+func (ob *OrderBook) CancelOrder(orderID int) error {
+	order, ok := ob.GetOrder(orderID)
+	if !ok {
+		return errors.New(fmt.Sprintf("order %d can not be cancelled as it is not in the book", orderID))
 	}
 
-	if order.OrderType == "ASK" {
+	return ob.RemoveOrder(order)
+}
 
-		return ob.askBook.RemoveOrder(order)
+// PullOrders takes out of the book the order with id orderID and every other order its
+// trader has queued on the same side
+func (ob *OrderBook) PullOrders(orderID int) error {
+	order, ok := ob.GetOrder(orderID)
+	if !ok {
+		return errors.New(fmt.Sprintf("orders of order %d can not be pulled as it is not in the book", orderID))
 	}
 
-	return errors.New("unknown order type cannot be removed")
+	// the list of the trader changes as its orders are removed
+	queued := append([]*common.Order{}, ob.TraderOrders(order.TraderID, order.OrderType)...)
+	for _, o := range queued {
+		if err := ob.RemoveOrder(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AmendOrder changes price and quantity of the resting order referenced by an AMEND
+// request. Reducing the quantity keeps the time priority any other change does not
+func (ob *OrderBook) AmendOrder(amend *common.Order) error {
+	if !amend.IsValid() || amend.OrderType != "AMEND" {
+		return errors.New(fmt.Sprintf("amend request is not valid: %#v", amend))
+	}
+
+	old, ok := ob.GetOrder(amend.OrderID)
+	if !ok {
+		return errors.New(fmt.Sprintf("order %d can not be amended as it is not in the book", amend.OrderID))
+	}
+
+	if old.TraderID != amend.TraderID {
+		return errors.New(fmt.Sprintf("order %d can only be amended by its trader", amend.OrderID))
+	}
+
+	if old.Price == amend.Price && amend.Quantity == old.Quantity {
+		return nil
+	}
+
+	if old.Price == amend.Price && amend.Quantity < old.Quantity {
+		half, _ := ob.half(old.OrderType)
+		return half.Reduce(old, old.Quantity-amend.Quantity)
+	}
+
+	return ob.ReplaceOrder(old.OrderID, &common.Order{
+		TraderID:  old.TraderID,
+		OrderType: old.OrderType,
+		Symbol:    old.Symbol,
+		Price:     amend.Price,
+		Quantity:  amend.Quantity,
+		TimeStep:  amend.TimeStep,
+		Time:      amend.Time,
+		SimTime:   old.SimTime,
+	})
+}
+
+// GetOrder finds a resting order by its id in either side of the book
+func (ob *OrderBook) GetOrder(orderID int) (*common.Order, bool) {
+	if order, ok := ob.bidBook.Orders[orderID]; ok {
+		return order, true
+	}
+
+	order, ok := ob.askBook.Orders[orderID]
+	return order, ok
+}
+
+// TraderOrders returns the resting orders of a trader of the given type, oldest first
+func (ob *OrderBook) TraderOrders(traderID int, orderType string) []*common.Order {
+	half, err := ob.half(orderType)
+	if err != nil {
+		return []*common.Order{}
+	}
+
+	return half.TraderOrders(traderID)
+}
+
+func (ob *OrderBook) half(orderType string) (*OrderBookHalf, error) {
+	if orderType == "BID" {
+		return &ob.bidBook, nil
+	}
+
+	if orderType == "ASK" {
+		return &ob.askBook, nil
+	}
+
+	return nil, errors.New("unknown order type")
 }
 
 func (ob *OrderBook) GetLastTrade() *common.Trade {
@@ -220,35 +541,82 @@ func (ob *OrderBook) GetNextTradeID() int {
 }
 
 func (ob *OrderBook) FindPossibleTrade() (trade bool, bid, ask *common.Order, err error) {
-	askError := ob.askBook.SetBestData()
-	bidError := ob.bidBook.SetBestData()
-	if askError != nil {
-		return false, &common.Order{}, &common.Order{}, askError
+	bid = ob.bidBook.Best()
+	ask = ob.askBook.Best()
+	if bid == nil || ask == nil {
+		return false, &common.Order{}, &common.Order{}, nil
 	}
 
+	if bid.Price >= ask.Price {
+		// Possible trade can be made and is in a price-time priority basis
+		return true, bid, ask, nil
+	}
 
-	if bidError != nil {
-		return false, &common.Order{}, &common.Order{}, bidError
+	return false, &common.Order{}, &common.Order{}, nil
+}
+
+// UniformPrice finds the single price that maximises the units traded between
+// the resting bids and asks. All prices in [low, high] trade the same volume,
+// k picks the price in that range as in the k pricing rule p = k*high + (1-k)*low
+func (ob *OrderBook) UniformPrice(k float64) (float64, int) {
+	bids := ob.bidBook.Ladder(0)
+	asks := ob.askBook.Ladder(0)
+	if len(bids) == 0 || len(asks) == 0 || bids[0].Price < asks[0].Price {
+		return -1, 0
 	}
 
-	if ob.bidBook.BestPrice < 0 || ob.askBook.BestPrice < 0 {
-		return false, &common.Order{}, &common.Order{}, nil
+	candidates := make([]float64, 0, len(bids)+len(asks))
+	for _, l := range bids {
+		candidates = append(candidates, l.Price)
+	}
+	for _, l := range asks {
+		candidates = append(candidates, l.Price)
 	}
+	sort.Float64s(candidates)
 
-	if len(ob.bidBook.BestOrders) == 0 || len(ob.askBook.BestOrders) == 0 {
-		return false, &common.Order{}, &common.Order{}, nil
+	low, high := -1.0, -1.0
+	maxVolume := 0
+	for _, p := range candidates {
+		demand := 0
+		for _, l := range bids {
+			if l.Price < p {
+				break
+			}
+			demand += l.Quantity
+		}
+
+		supply := 0
+		for _, l := range asks {
+			if l.Price > p {
+				break
+			}
+			supply += l.Quantity
+		}
+
+		volume := minInt(demand, supply)
+		if volume > maxVolume {
+			maxVolume = volume
+			low = p
+			high = p
+		} else if volume == maxVolume && volume > 0 {
+			high = p
+		}
 	}
 
-	if ob.bidBook.BestPrice >= ob.askBook.BestPrice {
-		// Possible trade can be made and is in a FIFO basis
-		return true, ob.bidBook.BestOrders[0], ob.askBook.BestOrders[0], nil
+	if maxVolume == 0 {
+		return -1, 0
 	}
 
-	return false, &common.Order{}, &common.Order{}, nil
+	return k*high + (1-k)*low, maxVolume
 }
 
 func (ob *OrderBook) RecordTrade(trade *common.Trade) error {
-	err := ob.RemoveOrder(trade.BuyOrder)
+	if trade.Quantity <= 0 || trade.Quantity > trade.BuyOrder.Quantity ||
+		trade.Quantity > trade.SellOrder.Quantity {
+		return errors.New(fmt.Sprintf("trade quantity %d can not be filled", trade.Quantity))
+	}
+
+	err := ob.fillOrder(trade.BuyOrder, trade.Quantity)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"order": trade.BuyOrder,
@@ -256,59 +624,43 @@ func (ob *OrderBook) RecordTrade(trade *common.Trade) error {
 		return err
 	}
 
-	err = ob.RemoveOrder(trade.SellOrder)
+	err = ob.fillOrder(trade.SellOrder, trade.Quantity)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"order": trade.SellOrder,
 		}).Error("can not remove order so trade not made")
 		return err
 	}
-	ob.askBook.SetBestData()
-	ob.bidBook.SetBestData()
 
 	ob.tradeRecord = append(ob.tradeRecord, trade)
 	ob.lastTrade = trade
 	return nil
 }
 
-func (ob *OrderBook) TradesToCSV(experimentID string, tradingDay int) {
-	// CSV file format is as follows TradeID,TradingDay,TimeStep,Price,SellerID,BuyerID,SellerPrice,BuyerPrice
-	fileName, err := filepath.Abs(fmt.Sprintf("../mexs/logs/%s/TRADES.csv", experimentID))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day":  tradingDay,
-			"experimentID": experimentID,
-			"error":        err.Error(),
-		}).Error("File Path not found")
-		return
-	}
-
-	addHeader := true
-	if _, err := os.Stat(fileName); err == nil {
-		addHeader = false
+// fillOrder takes quantity units out of a resting order, the order stays in
+// the book with the remaining units and it is removed once fully filled
+func (ob *OrderBook) fillOrder(order *common.Order, quantity int) error {
+	if order.Quantity > quantity {
+		half, err := ob.half(order.OrderType)
+		if err != nil {
+			return err
+		}
+		return half.Reduce(order, quantity)
 	}
 
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	defer file.Close()
-
+	err := ob.RemoveOrder(order)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"Trading Day":  tradingDay,
-			"experimentID": experimentID,
-			"error":        err.Error(),
-		}).Error("Trade CSV file could not be made")
-		return
-	}
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	if addHeader {
-		writer.Write([]string{"ID", "TradingDay", "TimeStep", "Price", "SellerID", "BuyerID", "AskPrice", "BidPrice", "SL", "BL"})
+		return err
 	}
+	order.Quantity = 0
+	return nil
+}
 
+// WriteTrades saves the trades of the trading day to the TRADES table
+func (ob *OrderBook) WriteTrades(sink results.ResultSink, experimentID string, tradingDay int) {
+	rows := make([][]string, 0, len(ob.tradeRecord))
 	for _, trade := range ob.tradeRecord {
-		row := []string{
+		rows = append(rows, []string{
 			strconv.Itoa(trade.TradeID),
 			strconv.Itoa(tradingDay),
 			strconv.Itoa(trade.TimeStep),
@@ -319,16 +671,14 @@ func (ob *OrderBook) TradesToCSV(experimentID string, tradingDay int) {
 			fmt.Sprintf("%.5f", trade.BuyOrder.Price),
 			fmt.Sprintf("%.3f", trade.SLimit),
 			fmt.Sprintf("%.3f", trade.BLimit),
-		}
-		writer.Write(row)
+			strconv.Itoa(trade.Quantity),
+			trade.Event,
+			trade.Symbol,
+			fmt.Sprintf("%.5f", trade.SimTime),
+		})
 	}
 
-	log.Debug("Trades saved to file:", fileName)
+	results.Save(sink, experimentID, "TRADES", []string{"ID", "TradingDay", "TimeStep", "Price", "SellerID", "BuyerID",
+		"AskPrice", "BidPrice", "SL", "BL", "Quantity", "Event", "Symbol", "SimTime"}, rows)
+	log.Debug("Trades saved for day:", tradingDay)
 }
-
-func (ob *OrderBook) SetBest (){
-	ob.askBook.BestPrice = -1
-	ob.bidBook.BestPrice = -1
-	ob.askBook.SetBestData()
-	ob.bidBook.SetBestData()
-}
\ No newline at end of file
@@ -0,0 +1,230 @@
+package exchange
+
+import (
+	"mexs/common"
+	"testing"
+)
+
+func newTestBook() *OrderBook {
+	book := &OrderBook{}
+	book.Init()
+	return book
+}
+
+func bid(trader int, price float64, quantity int) *common.Order {
+	return &common.Order{TraderID: trader, OrderType: "BID", Price: price, Quantity: quantity}
+}
+
+func ask(trader int, price float64, quantity int) *common.Order {
+	return &common.Order{TraderID: trader, OrderType: "ASK", Price: price, Quantity: quantity}
+}
+
+func addOrders(t *testing.T, book *OrderBook, orders ...*common.Order) {
+	t.Helper()
+	for _, o := range orders {
+		if err := book.AddOrder(o); err != nil {
+			t.Fatalf("order %#v could not be added: %s", o, err.Error())
+		}
+	}
+}
+
+func TestReplaceOrderKeepsOldOrderOnFailure(t *testing.T) {
+	book := newTestBook()
+	old := bid(1, 50, 2)
+	addOrders(t, book, old)
+
+	if err := book.ReplaceOrder(old.OrderID, bid(1, 60, 0)); err == nil {
+		t.Fatal("an order with no units replaced a resting one")
+	}
+	if err := book.ReplaceOrder(old.OrderID, ask(1, 60, 1)); err == nil {
+		t.Fatal("an ask replaced a bid")
+	}
+	if o, ok := book.GetOrder(old.OrderID); !ok || o != old {
+		t.Fatalf("the old order is not in the book after a failed replacement")
+	}
+	if orders := book.TraderOrders(1, "BID"); len(orders) != 1 {
+		t.Fatalf("trader has %d bids, want 1", len(orders))
+	}
+}
+
+func TestPlaceQueuesOrdersAndReplacesTheOldest(t *testing.T) {
+	book := newTestBook()
+	first, second := bid(1, 40, 1), bid(1, 50, 1)
+	for _, o := range []*common.Order{first, second, ask(1, 90, 1), bid(2, 45, 1)} {
+		if err := book.Place(o, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if orders := book.TraderOrders(1, "BID"); len(orders) != 2 || orders[0] != first || orders[1] != second {
+		t.Fatalf("trader has bids %v, want both of its queued bids", orders)
+	}
+
+	third := bid(1, 60, 1)
+	if err := book.Place(third, 2); err != nil {
+		t.Fatal(err)
+	}
+	orders := book.TraderOrders(1, "BID")
+	if len(orders) != 2 || orders[0] != second || orders[1] != third {
+		t.Fatalf("trader has bids %v, want the second and third ones", orders)
+	}
+	if third.OrderID != first.OrderID {
+		t.Errorf("the replacement has order id %d, want the id %d of the oldest bid", third.OrderID, first.OrderID)
+	}
+	if o, ok := book.GetOrder(first.OrderID); !ok || o != third {
+		t.Error("the id of the oldest bid does not lead to its replacement")
+	}
+	if asks := book.TraderOrders(1, "ASK"); len(asks) != 1 {
+		t.Errorf("trader has %d asks, want 1", len(asks))
+	}
+	if bids := book.TraderOrders(2, "BID"); len(bids) != 1 {
+		t.Errorf("the other trader has %d bids, want 1", len(bids))
+	}
+}
+
+func TestPullOrdersCancelsEveryQueuedQuote(t *testing.T) {
+	book := newTestBook()
+	for _, price := range []float64{40, 50, 60} {
+		if err := book.Place(bid(1, price, 1), 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := bid(2, 45, 1)
+	addOrders(t, book, other)
+	sell := ask(1, 90, 1)
+	addOrders(t, book, sell)
+
+	last := book.TraderOrders(1, "BID")[2]
+	pull := &common.Order{OrderID: last.OrderID, TraderID: 1, OrderType: "PULL"}
+	if err := book.Place(pull, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if orders := book.TraderOrders(1, "BID"); len(orders) != 0 {
+		t.Errorf("trader still has %d bids after pulling them", len(orders))
+	}
+	if _, ok := book.GetOrder(other.OrderID); !ok {
+		t.Error("the bid of another trader was pulled")
+	}
+	if _, ok := book.GetOrder(sell.OrderID); !ok {
+		t.Error("the ask of the trader was pulled with its bids")
+	}
+}
+
+func TestBestOrderHasPriceTimePriority(t *testing.T) {
+	book := newTestBook()
+	first := bid(1, 50, 1)
+	better := bid(2, 55, 1)
+	second := bid(3, 55, 1)
+	addOrders(t, book, first, better, second, ask(4, 70, 1), ask(5, 60, 2), ask(6, 60, 1))
+
+	if best := book.bidBook.Best(); best != better {
+		t.Fatalf("best bid is order %d, want %d", best.OrderID, better.OrderID)
+	}
+	if book.bidBook.BestPrice != 55 || book.askBook.BestPrice != 60 {
+		t.Errorf("best prices are %.2f/%.2f, want 55/60", book.bidBook.BestPrice, book.askBook.BestPrice)
+	}
+	if best := book.askBook.Best(); best.TraderID != 5 {
+		t.Errorf("best ask is of trader %d, want the oldest ask at 60 of trader 5", best.TraderID)
+	}
+
+	if err := book.RemoveOrder(better); err != nil {
+		t.Fatal(err)
+	}
+	if best := book.bidBook.Best(); best != second {
+		t.Errorf("best bid is order %d after removing the best one, want %d", best.OrderID, second.OrderID)
+	}
+	if err := book.RemoveOrder(second); err != nil {
+		t.Fatal(err)
+	}
+	if book.bidBook.BestPrice != 50 {
+		t.Errorf("best bid price is %.2f, want 50", book.bidBook.BestPrice)
+	}
+	if err := book.RemoveOrder(first); err != nil {
+		t.Fatal(err)
+	}
+	if book.bidBook.Best() != nil || book.bidBook.BestPrice != -1 {
+		t.Error("empty half still has a best order")
+	}
+}
+
+func TestLadderAggregatesPriceLevels(t *testing.T) {
+	book := newTestBook()
+	addOrders(t, book, ask(1, 62, 1), ask(2, 60, 2), ask(3, 60, 3), ask(4, 61, 1))
+
+	want := []common.DepthLevel{{Price: 60, Quantity: 5, Orders: 2}, {Price: 61, Quantity: 1, Orders: 1}}
+	ladder := book.askBook.Ladder(2)
+	if len(ladder) != len(want) {
+		t.Fatalf("ladder has %d levels, want %d", len(ladder), len(want))
+	}
+	for i := range want {
+		if ladder[i] != want[i] {
+			t.Errorf("level %d is %+v, want %+v", i, ladder[i], want[i])
+		}
+	}
+	if levels := book.askBook.Ladder(0); len(levels) != 3 || levels[2].Price != 62 {
+		t.Errorf("whole ladder is %+v", levels)
+	}
+	if disclosed := book.askBook.DisclosedOrders(1); len(disclosed) != 2 {
+		t.Errorf("%d orders disclosed at the first level, want 2", len(disclosed))
+	}
+	if orders, units := book.askBook.Depth(); orders != 4 || units != 7 {
+		t.Errorf("depth is %d orders and %d units, want 4 and 7", orders, units)
+	}
+	if orders, units := book.askBook.DepthAt(59); orders != 0 || units != 0 {
+		t.Errorf("depth at an empty price is %d orders and %d units", orders, units)
+	}
+}
+
+func TestAddOrderGivesUniqueIDs(t *testing.T) {
+	book := newTestBook()
+	orders := []*common.Order{bid(1, 50, 1), ask(1, 60, 1), bid(2, 50, 1)}
+	addOrders(t, book, orders...)
+
+	seen := map[int]bool{}
+	for _, o := range orders {
+		if o.OrderID <= 0 || seen[o.OrderID] {
+			t.Errorf("order got id %d", o.OrderID)
+		}
+		seen[o.OrderID] = true
+	}
+	if err := book.bidBook.AddOrder(orders[0]); err == nil {
+		t.Error("an order was added twice")
+	}
+	if err := book.AddOrder(&common.Order{TraderID: 1, OrderType: "NAN"}); err == nil {
+		t.Error("a NAN order was added")
+	}
+}
+
+func TestRecordTradeFillsPartOfAnOrder(t *testing.T) {
+	book := newTestBook()
+	buy := bid(1, 60, 3)
+	sell := ask(2, 55, 1)
+	addOrders(t, book, buy, sell)
+
+	trade := &common.Trade{TradeID: book.GetNextTradeID(), BuyOrder: buy, SellOrder: sell, Price: 58, Quantity: 1}
+	if err := book.RecordTrade(trade); err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := book.GetOrder(buy.OrderID); !ok || o.Quantity != 2 {
+		t.Errorf("bid filled in part is not resting with 2 units")
+	}
+	if _, ok := book.GetOrder(sell.OrderID); ok || sell.Quantity != 0 {
+		t.Errorf("filled ask is still in the book with %d units", sell.Quantity)
+	}
+	if orders, units := book.bidBook.DepthAt(60); orders != 1 || units != 2 {
+		t.Errorf("bid level has %d orders and %d units, want 1 and 2", orders, units)
+	}
+
+	bigger := ask(3, 55, 5)
+	addOrders(t, book, bigger)
+	trade = &common.Trade{TradeID: book.GetNextTradeID(), BuyOrder: buy, SellOrder: bigger, Price: 58, Quantity: 3}
+	if err := book.RecordTrade(trade); err == nil {
+		t.Error("trade for more units than the bid has was recorded")
+	}
+	if buy.Quantity != 2 || bigger.Quantity != 5 {
+		t.Errorf("failed trade changed the orders to %d and %d units", buy.Quantity, bigger.Quantity)
+	}
+	if got := book.GetLastTrade(); got.Quantity != 1 {
+		t.Errorf("last trade is for %d units, want 1", got.Quantity)
+	}
+}
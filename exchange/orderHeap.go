@@ -0,0 +1,69 @@
+package exchange
+
+import (
+	"mexs/common"
+)
+
+// bookEntry wraps a resting order with the data needed to keep it in the heap
+type bookEntry struct {
+	order *common.Order
+	// seq is the arrival number of the order in the book, a replaced order gets a new one
+	seq int
+	// index is the position of the entry in the heap
+	index int
+}
+
+// orderHeap keeps orders in price-time priority, the best order is always at index 0.
+// For bids the highest price is best and for asks the lowest one, ties go to
+// the order that arrived first. It implements container/heap.Interface
+type orderHeap struct {
+	entries []*bookEntry
+	// highFirst is true for bids
+	highFirst bool
+}
+
+func (h *orderHeap) Len() int {
+	return len(h.entries)
+}
+
+func (h *orderHeap) Less(i, j int) bool {
+	pi := h.entries[i].order.Price
+	pj := h.entries[j].order.Price
+	if pi != pj {
+		if h.highFirst {
+			return pi > pj
+		}
+		return pi < pj
+	}
+
+	return h.entries[i].seq < h.entries[j].seq
+}
+
+func (h *orderHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].index = i
+	h.entries[j].index = j
+}
+
+func (h *orderHeap) Push(x interface{}) {
+	entry := x.(*bookEntry)
+	entry.index = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+
+func (h *orderHeap) Pop() interface{} {
+	n := len(h.entries)
+	entry := h.entries[n-1]
+	h.entries[n-1] = nil
+	h.entries = h.entries[:n-1]
+	entry.index = -1
+	return entry
+}
+
+// peek returns the best order or nil when the heap is empty
+func (h *orderHeap) peek() *common.Order {
+	if len(h.entries) == 0 {
+		return nil
+	}
+	return h.entries[0].order
+}
@@ -0,0 +1,153 @@
+package exchange
+
+import (
+	"fmt"
+	"mexs/common"
+)
+
+// PricingRule sets the transaction price of a bid and an ask that cross in the
+// continuous market. Call auctions clear at a uniform price and always use k pricing
+type PricingRule interface {
+	Name() string
+	Price(ex *Exchange, bid, ask *common.Order) float64
+}
+
+// DefaultPricingRule is used when the auction parameters do not name one
+const DefaultPricingRule = "K"
+
+// PricingRules are the names of all the pricing rules, the GA picks from them
+var PricingRules = []string{"K", "EARLIER", "LATER", "DYNAMIC_K", "MOVING_AVERAGE"}
+
+var pricingRules = map[string]PricingRule{
+	"K":              KPricingRule{},
+	"EARLIER":        EarlierShoutRule{},
+	"LATER":          LaterShoutRule{},
+	"DYNAMIC_K":      DynamicKRule{},
+	"MOVING_AVERAGE": MovingAverageRule{},
+}
+
+// GetPricingRule returns the pricing rule with the given name, an empty name is the default rule
+func GetPricingRule(name string) (PricingRule, error) {
+	if name == "" {
+		name = DefaultPricingRule
+	}
+
+	rule, ok := pricingRules[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pricing rule %s", name)
+	}
+	return rule, nil
+}
+
+// KPricingRule is pF = k *pB + (1-k)pA with k = KPricing
+type KPricingRule struct{}
+
+func (KPricingRule) Name() string {
+	return "K"
+}
+
+func (KPricingRule) Price(ex *Exchange, bid, ask *common.Order) float64 {
+	return kPrice(ex.GAVector.KPricing, bid, ask)
+}
+
+// EarlierShoutRule trades at the price of the standing order, the one that was in the book first
+type EarlierShoutRule struct{}
+
+func (EarlierShoutRule) Name() string {
+	return "EARLIER"
+}
+
+func (EarlierShoutRule) Price(ex *Exchange, bid, ask *common.Order) float64 {
+	if arrivedBefore(ex, bid, ask) {
+		return bid.Price
+	}
+	return ask.Price
+}
+
+// LaterShoutRule trades at the price of the incoming order, the one that arrived last
+type LaterShoutRule struct{}
+
+func (LaterShoutRule) Name() string {
+	return "LATER"
+}
+
+func (LaterShoutRule) Price(ex *Exchange, bid, ask *common.Order) float64 {
+	if arrivedBefore(ex, ask, bid) {
+		return bid.Price
+	}
+	return ask.Price
+}
+
+// arrivedBefore is true when order a entered the book of its instrument before order b,
+// orders of a symbol that is not traded are compared by order id
+func arrivedBefore(ex *Exchange, a, b *common.Order) bool {
+	book, err := ex.book(a)
+	if err != nil {
+		return a.OrderID < b.OrderID
+	}
+	return book.arrivedBefore(a, b)
+}
+
+// DynamicKRule picks k so the price is as close as possible to the EE estimate of the
+// equilibrium price, it uses KPricing until there are enough trades for an estimate
+type DynamicKRule struct{}
+
+func (DynamicKRule) Name() string {
+	return "DYNAMIC_K"
+}
+
+func (DynamicKRule) Price(ex *Exchange, bid, ask *common.Order) float64 {
+	pe, ok := ex.EquilibriumEstimate(bid.GetSymbol())
+	if !ok {
+		return kPrice(ex.GAVector.KPricing, bid, ask)
+	}
+	return clamp(pe, ask.Price, bid.Price)
+}
+
+// MovingAverageRule trades at the mean price of the last PricingWindow trades of the instrument kept
+// inside the spread, it uses KPricing until there are enough trades
+type MovingAverageRule struct{}
+
+func (MovingAverageRule) Name() string {
+	return "MOVING_AVERAGE"
+}
+
+func (MovingAverageRule) Price(ex *Exchange, bid, ask *common.Order) float64 {
+	n := ex.GAVector.PricingWindow
+	history := ex.market(bid.GetSymbol()).priceHistory
+	if n <= 0 || len(history) < n {
+		return kPrice(ex.GAVector.KPricing, bid, ask)
+	}
+
+	sum := 0.0
+	for _, p := range history[len(history)-n:] {
+		sum += p
+	}
+	return clamp(sum/float64(n), ask.Price, bid.Price)
+}
+
+func kPrice(k float64, bid, ask *common.Order) float64 {
+	return k*bid.Price + (1-k)*ask.Price
+}
+
+func clamp(v, low, high float64) float64 {
+	if v < low {
+		return low
+	} else if v > high {
+		return high
+	}
+	return v
+}
+
+// recordPrice keeps the prices needed by the moving average rule
+func (ex *Exchange) recordPrice(m *market, price float64) {
+	n := ex.GAVector.PricingWindow
+	if n <= 0 {
+		return
+	}
+
+	m.priceHistory = append(m.priceHistory, price)
+	if len(m.priceHistory) > n {
+		m.priceHistory = m.priceHistory[len(m.priceHistory)-n:]
+	}
+}
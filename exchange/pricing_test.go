@@ -0,0 +1,74 @@
+package exchange
+
+import (
+	"mexs/common"
+	"testing"
+)
+
+func TestShoutRulesUseArrivalOfReplacedOrders(t *testing.T) {
+	cases := []struct {
+		rule  string
+		price float64
+	}{
+		// the ask rested first, the bid arrived later when it was replaced
+		{"EARLIER", 100},
+		{"LATER", 120},
+	}
+
+	for _, c := range cases {
+		ex := newTestExchange(AuctionParameters{PricingRule: c.rule, OrderQueuing: 1})
+		bid := &common.Order{TraderID: 1, OrderType: "BID", Price: 50, Quantity: 1}
+		place(t, ex, bid)
+		place(t, ex, &common.Order{TraderID: 2, OrderType: "ASK", Price: 100, Quantity: 1})
+		replaced := &common.Order{TraderID: 1, OrderType: "BID", Price: 120, Quantity: 1}
+		place(t, ex, replaced)
+		if replaced.OrderID != bid.OrderID {
+			t.Fatalf("the replaced bid has order id %d, want %d", replaced.OrderID, bid.OrderID)
+		}
+
+		ok, b, a, _ := ex.market(common.DefaultSymbol).book.FindPossibleTrade()
+		if !ok {
+			t.Fatalf("%s: the replaced bid does not cross the ask", c.rule)
+		}
+		trade, err := ex.PriceMatch(b, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trade.Price != c.price {
+			t.Errorf("%s: price %.2f, want %.2f", c.rule, trade.Price, c.price)
+		}
+	}
+}
+
+func TestKPricingRule(t *testing.T) {
+	ex := newTestExchange(AuctionParameters{PricingRule: "K", KPricing: 0.25})
+	place(t, ex, &common.Order{TraderID: 1, OrderType: "BID", Price: 120, Quantity: 1})
+	place(t, ex, &common.Order{TraderID: 2, OrderType: "ASK", Price: 100, Quantity: 1})
+
+	ok, b, a, _ := ex.market(common.DefaultSymbol).book.FindPossibleTrade()
+	if !ok {
+		t.Fatal("the orders do not cross")
+	}
+	trade, err := ex.PriceMatch(b, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trade.Price != 105 {
+		t.Errorf("price %.2f, want 105", trade.Price)
+	}
+}
+
+func TestGetPricingRule(t *testing.T) {
+	for _, name := range PricingRules {
+		rule, err := GetPricingRule(name)
+		if err != nil || rule.Name() != name {
+			t.Errorf("rule %s: got %v, %v", name, rule, err)
+		}
+	}
+	if rule, err := GetPricingRule(""); err != nil || rule.Name() != DefaultPricingRule {
+		t.Errorf("empty name: got %v, %v", rule, err)
+	}
+	if _, err := GetPricingRule("NOPE"); err == nil {
+		t.Error("unknown rule gave no error")
+	}
+}
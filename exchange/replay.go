@@ -0,0 +1,190 @@
+package exchange
+
+import (
+	"fmt"
+	"io"
+	"mexs/common"
+	"sort"
+)
+
+// Replay rebuilds the order books of an exchange from its journal one event at a time.
+// Only the books are rebuilt, the agents are not run again
+type Replay struct {
+	Events []JournalEvent
+	// next is the index of the next event to apply
+	next     int
+	books    map[string]*OrderBook
+	symbols  []string
+	maxQueue int
+}
+
+// Init puts the replay before the first event of the journal
+func (r *Replay) Init(events []JournalEvent) {
+	r.Events = events
+	r.next = 0
+	r.books = map[string]*OrderBook{}
+	r.symbols = []string{}
+	r.maxQueue = 1
+}
+
+// Done is true once every event was applied
+func (r *Replay) Done() bool {
+	return r.next >= len(r.Events)
+}
+
+// Step applies the next event to the books and returns it, it fails if the books no
+// longer match the journal
+func (r *Replay) Step() (JournalEvent, error) {
+	if r.Done() {
+		return JournalEvent{}, io.EOF
+	}
+
+	e := r.Events[r.next]
+	r.next++
+	return e, r.apply(e)
+}
+
+// Peek returns the next event without applying it, it is false at the end of the journal
+func (r *Replay) Peek() (JournalEvent, bool) {
+	if r.Done() {
+		return JournalEvent{}, false
+	}
+	return r.Events[r.next], true
+}
+
+// SeekTo applies the events up to the end of time step t of day d
+func (r *Replay) SeekTo(d, t int) error {
+	for {
+		e, ok := r.Peek()
+		if !ok || e.After(d, t) {
+			return nil
+		}
+		if _, err := r.Step(); err != nil {
+			return err
+		}
+	}
+}
+
+// After is true if the event happened after time step t of day d
+func (e JournalEvent) After(d, t int) bool {
+	return e.Day > d || (e.Day == d && e.TimeStep > t)
+}
+
+// Symbols returns the instruments of the books in the order they were opened
+func (r *Replay) Symbols() []string {
+	return r.symbols
+}
+
+// Book returns the rebuilt book of an instrument, nil if it was not opened yet
+func (r *Replay) Book(symbol string) *OrderBook {
+	return r.books[symbol]
+}
+
+func (r *Replay) apply(e JournalEvent) error {
+	switch e.Type {
+	case EventDayStart:
+		for _, symbol := range e.Symbols {
+			if _, ok := r.books[symbol]; !ok {
+				book := &OrderBook{}
+				book.Init()
+				r.books[symbol] = book
+				r.symbols = append(r.symbols, symbol)
+			}
+			r.books[symbol].Reset()
+		}
+		r.maxQueue = e.OrderQueuing
+	case EventSubmit:
+		book, err := r.book(e)
+		if err != nil {
+			return err
+		}
+		order := *e.Order
+		if err := book.Place(&order, r.maxQueue); err != nil {
+			return fmt.Errorf("event %d: order could not be placed: %s", e.Seq, err.Error())
+		}
+		if order.OrderID != e.OrderID {
+			return fmt.Errorf("event %d: order got id %d in the replay and %d in the journal", e.Seq,
+				order.OrderID, e.OrderID)
+		}
+	case EventDrop:
+		book, err := r.book(e)
+		if err != nil {
+			return err
+		}
+		if err := book.CancelOrder(e.OrderID); err != nil {
+			return fmt.Errorf("event %d: %s", e.Seq, err.Error())
+		}
+	case EventTrade:
+		book, err := r.book(e)
+		if err != nil {
+			return err
+		}
+		bid, okBid := book.GetOrder(e.Trade.BuyOrderID)
+		ask, okAsk := book.GetOrder(e.Trade.SellOrderID)
+		if !okBid || !okAsk {
+			return fmt.Errorf("event %d: orders %d and %d of trade %d are not in the book", e.Seq,
+				e.Trade.BuyOrderID, e.Trade.SellOrderID, e.Trade.TradeID)
+		}
+		trade := &common.Trade{
+			TradeID:   e.Trade.TradeID,
+			Symbol:    e.Symbol,
+			BuyOrder:  bid,
+			SellOrder: ask,
+			Price:     e.Trade.Price,
+			Quantity:  e.Trade.Quantity,
+			TimeStep:  e.TimeStep,
+			Event:     e.Trade.Event,
+			SimTime:   e.SimTime,
+		}
+		if err := book.RecordTrade(trade); err != nil {
+			return fmt.Errorf("event %d: %s", e.Seq, err.Error())
+		}
+	case EventUpdate:
+		// updates check the rebuilt book has the top of book the agents saw
+		book, err := r.book(e)
+		if err != nil {
+			return err
+		}
+		if book.bidBook.BestPrice != e.Update.BestBid || book.askBook.BestPrice != e.Update.BestAsk {
+			return fmt.Errorf("event %d: replayed book is %.5f/%.5f and the journal has %.5f/%.5f", e.Seq,
+				book.bidBook.BestPrice, book.askBook.BestPrice, e.Update.BestBid, e.Update.BestAsk)
+		}
+	}
+	return nil
+}
+
+func (r *Replay) book(e JournalEvent) (*OrderBook, error) {
+	book, ok := r.books[e.Symbol]
+	if !ok {
+		return nil, fmt.Errorf("event %d: book %s was not opened", e.Seq, e.Symbol)
+	}
+	return book, nil
+}
+
+// WriteBook writes the resting orders of every book from best to worst price, orders
+// at the same price are in time priority
+func (r *Replay) WriteBook(w io.Writer) {
+	for _, symbol := range r.symbols {
+		book := r.books[symbol]
+		fmt.Fprintf(w, "%s: %d trades\n", symbol, len(book.tradeRecord))
+		for _, half := range []*OrderBookHalf{&book.askBook, &book.bidBook} {
+			fmt.Fprintf(w, "  %s\n", half.BookType)
+			for _, o := range half.sorted() {
+				fmt.Fprintf(w, "    %10.5f x %-4d order %-6d trader %-4d step %d\n", o.Price, o.Quantity,
+					o.OrderID, o.TraderID, o.TimeStep)
+			}
+		}
+	}
+}
+
+// sorted returns the resting orders in the order they would be matched
+func (ob *OrderBookHalf) sorted() []*common.Order {
+	orders := ob.OrdersToList()
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].Price != orders[j].Price {
+			return ob.better(orders[i].Price, orders[j].Price)
+		}
+		return ob.entries[orders[i].OrderID].seq < ob.entries[orders[j].OrderID].seq
+	})
+	return orders
+}
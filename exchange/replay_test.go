@@ -0,0 +1,122 @@
+package exchange
+
+import (
+	"bytes"
+	"mexs/common"
+	"testing"
+)
+
+// sameBooks checks the replayed book has the resting orders of the book of the exchange
+func sameBooks(t *testing.T, replayed, book *OrderBook) {
+	t.Helper()
+	for _, halves := range [][2]*OrderBookHalf{{&replayed.bidBook, &book.bidBook}, {&replayed.askBook, &book.askBook}} {
+		got, want := halves[0].sorted(), halves[1].sorted()
+		if len(got) != len(want) {
+			t.Fatalf("replayed %s book has %d orders, want %d", halves[1].BookType, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].OrderID != want[i].OrderID || got[i].Price != want[i].Price || got[i].Quantity != want[i].Quantity {
+				t.Errorf("replayed order %+v, want %+v", *got[i], *want[i])
+			}
+		}
+	}
+}
+
+func TestReplayRebuildsTheBook(t *testing.T) {
+	for name, ex := range map[string]*Exchange{
+		"steps": {},
+		"async": {Seed: 2, Async: &AsyncConfig{Rate: 1}},
+	} {
+		journal := runTestDay(ex)
+		if len(journal.of(EventTrade)) == 0 {
+			t.Fatalf("%s: no trade was made", name)
+		}
+
+		r := &Replay{}
+		r.Init(journal.events)
+		for !r.Done() {
+			if e, err := r.Step(); err != nil {
+				t.Fatalf("%s: %s failed: %s", name, e, err)
+			}
+		}
+		sameBooks(t, r.Book(common.DefaultSymbol), ex.market(common.DefaultSymbol).book)
+		if got := len(r.Book(common.DefaultSymbol).tradeRecord); got != len(journal.of(EventTrade)) {
+			t.Errorf("%s: replay made %d trades", name, got)
+		}
+
+		var out bytes.Buffer
+		r.WriteBook(&out)
+		if out.Len() == 0 {
+			t.Errorf("%s: replayed book was not written", name)
+		}
+	}
+}
+
+func TestReplaySeekStopsAtTheEndOfAStep(t *testing.T) {
+	journal := runTestDay(&Exchange{})
+	r := &Replay{}
+	r.Init(journal.events)
+	if err := r.SeekTo(0, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	next, ok := r.Peek()
+	if !ok || next.TimeStep != 5 {
+		t.Errorf("replay stopped before %+v, want the first event of step 5", next)
+	}
+	if r.Book("OTHER") != nil || len(r.Symbols()) != 1 {
+		t.Errorf("replay opened books %v", r.Symbols())
+	}
+}
+
+func TestReplayFindsJournalsThatDoNotMatch(t *testing.T) {
+	journal := runTestDay(&Exchange{})
+	events := append([]JournalEvent{}, journal.events...)
+	for i, e := range events {
+		if e.Type == EventUpdate && e.Update.BestBid != -1 {
+			update := *e.Update
+			update.BestBid++
+			events[i].Update = &update
+			break
+		}
+	}
+
+	r := &Replay{}
+	r.Init(events)
+	for !r.Done() {
+		if _, err := r.Step(); err != nil {
+			return
+		}
+	}
+	t.Error("a journal with a wrong best bid was replayed")
+}
+
+func TestFileJournalRoundTrip(t *testing.T) {
+	events := runTestDay(&Exchange{}).events
+	journal := &FileJournal{Root: t.TempDir()}
+	for _, e := range events {
+		if err := journal.Record("exp", e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := JournalPath(journal.Root, "exp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(events) {
+		t.Fatalf("read %d events, wrote %d", len(read), len(events))
+	}
+	for i := range events {
+		if read[i].String() != events[i].String() {
+			t.Errorf("read %s, wrote %s", read[i], events[i])
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package exchange
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"mexs/common"
+)
+
+// Reason codes given when an order passes or is rejected by the market rules
+const (
+	ReasonPasses           = "PASSES"
+	ReasonNotInBook        = "NOT_IN_BOOK"
+	ReasonNotOwner         = "NOT_OWNER"
+	ReasonPriceRange       = "PRICE_RANGE"
+	ReasonEEImprovement    = "EE_IMPROVEMENT"
+	ReasonMaxShift         = "MAX_SHIFT"
+	ReasonDominance        = "DOMINANCE"
+	ReasonShoutImprovement = "SHOUT_IMPROVEMENT"
+	ReasonUnknownSymbol    = "UNKNOWN_SYMBOL"
+)
+
+// MarketRule decides if an order can enter the market, when it is rejected the
+// reason code is returned with it
+type MarketRule interface {
+	Name() string
+	Check(ex *Exchange, order *common.Order, t int) (bool, string)
+}
+
+// DefaultRules is the list of rules used when the configuration does not give one
+var DefaultRules = []string{"PRICE_RANGE", "EE_SHOUT_IMPROVEMENT", "MAX_SHIFT", "DOMINANCE"}
+
+var marketRules = map[string]MarketRule{
+	"PRICE_RANGE":          PriceRangeRule{},
+	"EE_SHOUT_IMPROVEMENT": EERule{},
+	"MAX_SHIFT":            MaxShiftRule{},
+	"DOMINANCE":            DominanceRule{},
+	"SHOUT_IMPROVEMENT":    ShoutImprovementRule{},
+}
+
+// BuildRules returns the rules with the given names in the same order, they are
+// checked in that order and the first one to reject an order stops the check
+func BuildRules(names []string) ([]MarketRule, error) {
+	rules := make([]MarketRule, 0, len(names))
+	for _, name := range names {
+		rule, ok := marketRules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown market rule %s", name)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// PriceRangeRule only accepts prices between the min and max price of the market
+type PriceRangeRule struct{}
+
+func (PriceRangeRule) Name() string {
+	return "PRICE_RANGE"
+}
+
+func (PriceRangeRule) Check(ex *Exchange, order *common.Order, t int) (bool, string) {
+	minPrice, maxPrice := ex.priceBounds(order.GetSymbol())
+	if order.Price > maxPrice || order.Price < minPrice {
+		return false, ReasonPriceRange
+	}
+	return true, ReasonPasses
+}
+
+// EERule is the EE shout improvement rule from
+// https://www.researchgate.net/publication/221455475_Reducing_price_fluctuation_in_continuous_double_auctions_through_pricing_policy_and_shout_improvement
+// The rule keeps an estimate of the equilibrium price Pe
+// Pe = (1/m) * sum_0_m(Pi)
+// where m is the size of the sliding window
+// then all bids above Pe - delta are accepted
+// and all asks bellow Pe + delta are accepted
+// Tunable parameters are m and delta
+type EERule struct{}
+
+func (EERule) Name() string {
+	return "EE_SHOUT_IMPROVEMENT"
+}
+
+func (EERule) Check(ex *Exchange, order *common.Order, t int) (bool, string) {
+	pe, ok := ex.EquilibriumEstimate(order.GetSymbol())
+	if !ok {
+		// Not enough trades to estimate Pe so accept all bids and asks
+		return true, ReasonPasses
+	}
+
+	if order.OrderType == "BID" && order.Price >= (pe-ex.GAVector.DeltaEE) {
+		return true, ReasonPasses
+	} else if order.OrderType == "ASK" && order.Price <= (pe+ex.GAVector.DeltaEE) {
+		return true, ReasonPasses
+	}
+
+	return false, ReasonEEImprovement
+}
+
+// MaxShiftRule defines the maximum amount any trader can shift the price,
+// it is based on the last transaction
+type MaxShiftRule struct{}
+
+func (MaxShiftRule) Name() string {
+	return "MAX_SHIFT"
+}
+
+func (MaxShiftRule) Check(ex *Exchange, order *common.Order, t int) (bool, string) {
+	book, err := ex.book(order)
+	if err != nil {
+		return false, ReasonUnknownSymbol
+	}
+	if book.lastTrade.TradeID == -1 {
+		return true, ReasonPasses
+	}
+
+	if book.lastTrade.Price*ex.GAVector.MaxShift >
+		math.Abs(book.lastTrade.Price-order.Price) {
+		return true, ReasonPasses
+	}
+
+	log.WithFields(log.Fields{
+		"Max Shift":   ex.GAVector.MaxShift,
+		"Last Trade":  book.lastTrade.Price,
+		"Order Price": order.Price,
+	}).Debug("Order rejected as it not passes max shift rule")
+	return false, ReasonMaxShift
+}
+
+// DominanceRule is to ensure no trader can dominate by being the only one sending bids/asks
+// it is checked against the latest order the trader has on that side of the book, an
+// amendment is not checked against the order it changes
+type DominanceRule struct{}
+
+func (DominanceRule) Name() string {
+	return "DOMINANCE"
+}
+
+func (DominanceRule) Check(ex *Exchange, order *common.Order, t int) (bool, string) {
+	book, err := ex.book(order)
+	if err != nil {
+		return false, ReasonUnknownSymbol
+	}
+	queued := book.TraderOrders(order.TraderID, order.OrderType)
+	var lastO *common.Order
+	for i := len(queued) - 1; i >= 0; i-- {
+		// new shouts have no order id, amendments have the one of the order they change
+		if queued[i].OrderID != order.OrderID {
+			lastO = queued[i]
+			break
+		}
+	}
+	if lastO == nil {
+		return true, ReasonPasses
+	}
+
+	if lastO.TimeStep+ex.GAVector.Dominance > t {
+		log.WithFields(log.Fields{
+			"Dominance":         ex.GAVector.Dominance,
+			"Last Quote in":     lastO.TimeStep,
+			"Current Time step": t,
+		}).Debug("Order rejected as it not passes Dominance rule")
+		return false, ReasonDominance
+	}
+
+	return true, ReasonPasses
+}
+
+// ShoutImprovementRule is the NYSE style rule, a new bid has to improve the best
+// bid by at least MinIncrement and a new ask has to improve the best ask by it
+type ShoutImprovementRule struct{}
+
+func (ShoutImprovementRule) Name() string {
+	return "SHOUT_IMPROVEMENT"
+}
+
+func (ShoutImprovementRule) Check(ex *Exchange, order *common.Order, t int) (bool, string) {
+	book, err := ex.book(order)
+	if err != nil {
+		return false, ReasonUnknownSymbol
+	}
+	if order.OrderType == "BID" {
+		if book.bidBook.BestPrice != -1 &&
+			book.bidBook.BestPrice+ex.GAVector.MinIncrement > order.Price {
+			log.WithFields(log.Fields{
+				"Best price":        book.bidBook.BestPrice,
+				"Minimum Increment": ex.GAVector.MinIncrement,
+				"Bid":               order.Price,
+				"TID":               order.TraderID,
+			}).Debug("Bid was rejected as it does not improve enough on best bid")
+			return false, ReasonShoutImprovement
+		}
+	} else {
+		if book.askBook.BestPrice != -1 &&
+			book.askBook.BestPrice-ex.GAVector.MinIncrement < order.Price {
+			log.WithFields(log.Fields{
+				"Best ask":          book.askBook.BestPrice,
+				"Minimum Increment": ex.GAVector.MinIncrement,
+				"Ask":               order.Price,
+				"TID":               order.TraderID,
+			}).Debug("Ask was rejected as it does not improve enough on best ask")
+			return false, ReasonShoutImprovement
+		}
+	}
+
+	return true, ReasonPasses
+}
+
+// EquilibriumEstimate is the mean price of the last WindowSizeEE trades in the
+// instrument, it is false while there are not enough trades to fill the window
+func (ex *Exchange) EquilibriumEstimate(symbol string) (float64, bool) {
+	m := ex.market(symbol)
+	if m == nil || ex.GAVector.WindowSizeEE <= 0 || m.trades < ex.GAVector.WindowSizeEE {
+		return 0, false
+	}
+
+	sum := 0.0
+	for i := 0; i < ex.GAVector.WindowSizeEE; i++ {
+		sum += m.eePrices[i]
+	}
+	return sum / float64(ex.GAVector.WindowSizeEE), true
+}
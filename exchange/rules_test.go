@@ -0,0 +1,102 @@
+package exchange
+
+import (
+	"mexs/common"
+	"testing"
+)
+
+func TestDominanceIgnoresTheAmendedOrder(t *testing.T) {
+	ex := newTestExchange(AuctionParameters{Dominance: 5, OrderQueuing: 2})
+	ex.Rules, _ = BuildRules([]string{"DOMINANCE"})
+	resting := &common.Order{TraderID: 1, OrderType: "BID", Price: 50, Quantity: 1, TimeStep: 3}
+	place(t, ex, resting)
+
+	amend := &common.Order{OrderID: resting.OrderID, TraderID: 1, OrderType: "AMEND", Price: 55, Quantity: 1, TimeStep: 4}
+	if ok, reason := ex.OrderComplies(amend, 4); !ok {
+		t.Errorf("the amendment of the only order was rejected: %s", reason)
+	}
+
+	shout := &common.Order{TraderID: 1, OrderType: "BID", Price: 55, Quantity: 1, TimeStep: 4}
+	if ok, reason := ex.OrderComplies(shout, 4); ok || reason != ReasonDominance {
+		t.Errorf("a new bid inside the dominance window got %v, %s", ok, reason)
+	}
+
+	place(t, ex, &common.Order{TraderID: 1, OrderType: "BID", Price: 40, Quantity: 1, TimeStep: 4})
+	if ok, reason := ex.OrderComplies(amend, 6); ok || reason != ReasonDominance {
+		t.Errorf("an amendment with a later order inside the window got %v, %s", ok, reason)
+	}
+}
+
+func TestRuleChainStopsAtFirstRejection(t *testing.T) {
+	ex := newTestExchange(AuctionParameters{MinIncrement: 5, OrderQueuing: 2})
+	var err error
+	ex.Rules, err = BuildRules([]string{"PRICE_RANGE", "SHOUT_IMPROVEMENT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	place(t, ex, &common.Order{TraderID: 1, OrderType: "BID", Price: 100, Quantity: 1})
+	place(t, ex, &common.Order{TraderID: 2, OrderType: "ASK", Price: 150, Quantity: 1})
+
+	cases := []struct {
+		order  *common.Order
+		reason string
+	}{
+		{&common.Order{TraderID: 3, OrderType: "BID", Price: 104, Quantity: 1}, ReasonShoutImprovement},
+		{&common.Order{TraderID: 3, OrderType: "BID", Price: 105, Quantity: 1}, ReasonPasses},
+		{&common.Order{TraderID: 3, OrderType: "ASK", Price: 146, Quantity: 1}, ReasonShoutImprovement},
+		{&common.Order{TraderID: 3, OrderType: "ASK", Price: 145, Quantity: 1}, ReasonPasses},
+		{&common.Order{TraderID: 3, OrderType: "BID", Price: 250, Quantity: 1}, ReasonPriceRange},
+		{&common.Order{TraderID: 3, OrderType: "ASK", Price: 0.5, Quantity: 1}, ReasonPriceRange},
+		{&common.Order{TraderID: 3, OrderType: "BID", Price: 120, Quantity: 1, Symbol: "OTHER"}, ReasonUnknownSymbol},
+		{&common.Order{OrderID: 99, TraderID: 3, OrderType: "CANCEL"}, ReasonNotInBook},
+		{&common.Order{OrderID: 1, TraderID: 3, OrderType: "CANCEL"}, ReasonNotOwner},
+	}
+	for i, c := range cases {
+		ok, reason := ex.OrderComplies(c.order, 0)
+		if reason != c.reason || ok != (c.reason == ReasonPasses) {
+			t.Errorf("case %d: got %v, %s, want %s", i, ok, reason, c.reason)
+		}
+	}
+
+	if _, err := BuildRules([]string{"PRICE_RANGE", "NOPE"}); err == nil {
+		t.Error("unknown rule was built")
+	}
+}
+
+func TestMaxShiftAndEERulesFollowTrades(t *testing.T) {
+	ex := newTestExchange(AuctionParameters{KPricing: 0.5, MaxShift: 0.1, WindowSizeEE: 2, DeltaEE: 5, OrderQueuing: 1})
+	ex.Rules, _ = BuildRules([]string{"EE_SHOUT_IMPROVEMENT", "MAX_SHIFT"})
+	setTestTraders(ex, testTrader(0, "BID", 150, 2), testTrader(1, "ASK", 50, 2))
+	ex.OpenDay(0)
+
+	far := &common.Order{TraderID: 0, OrderType: "BID", Price: 150, Quantity: 1}
+	if ok, reason := ex.OrderComplies(far, 0); !ok {
+		t.Fatalf("order before any trade was rejected: %s", reason)
+	}
+
+	for _, price := range []float64{100, 110} {
+		place(t, ex, &common.Order{TraderID: 0, OrderType: "BID", Price: price, Quantity: 1})
+		place(t, ex, &common.Order{TraderID: 1, OrderType: "ASK", Price: price, Quantity: 1})
+		ex.MakeTrades(0, 0)
+	}
+	if pe, ok := ex.EquilibriumEstimate(common.DefaultSymbol); !ok || pe != 105 {
+		t.Fatalf("equilibrium estimate is %.2f, %v, want 105", pe, ok)
+	}
+
+	cases := []struct {
+		order  *common.Order
+		reason string
+	}{
+		{&common.Order{TraderID: 0, OrderType: "BID", Price: 99, Quantity: 1}, ReasonEEImprovement},
+		{&common.Order{TraderID: 0, OrderType: "BID", Price: 100, Quantity: 1}, ReasonPasses},
+		{&common.Order{TraderID: 1, OrderType: "ASK", Price: 111, Quantity: 1}, ReasonEEImprovement},
+		{&common.Order{TraderID: 0, OrderType: "BID", Price: 121, Quantity: 1}, ReasonMaxShift},
+		{&common.Order{TraderID: 1, OrderType: "ASK", Price: 100, Quantity: 1}, ReasonPasses},
+	}
+	for i, c := range cases {
+		ok, reason := ex.OrderComplies(c.order, 1)
+		if reason != c.reason || ok != (c.reason == ReasonPasses) {
+			t.Errorf("case %d: got %v, %s, want %s", i, ok, reason, c.reason)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package exchange
+
+import (
+	"mexs/bots"
+	"sort"
+)
+
+// DayStats sums up one trading day of an exchange
+type DayStats struct {
+	Day     int
+	Traders int
+	Trades  int
+	Volume  int
+	// Surplus is the sum of the surplus of all trades using the traders' limit prices
+	Surplus float64
+	// MaxSurplus is the surplus at the competitive equilibrium of the traders in the
+	// exchange, it uses the units each trader held at the start of the day or the
+	// last ones it was given during the day
+	MaxSurplus float64
+	Revenue    float64
+}
+
+// Efficiency is the allocative efficiency of the day, 0 when no surplus was possible
+func (s DayStats) Efficiency() float64 {
+	if s.MaxSurplus <= 0 {
+		return 0
+	}
+	return s.Surplus / s.MaxSurplus
+}
+
+// Stats returns the stats of the current trading day, they are complete after CloseDay
+func (ex *Exchange) Stats() DayStats {
+	return ex.day
+}
+
+// MarketResult is what a market run produced, StartMarket returns it so the trades
+// do not have to be read back from the results
+type MarketResult struct {
+	EID string
+	// Trades of every day, each day has the trades of every instrument in turn in the
+	// order they were made
+	Trades []TradeResult
+	// Days has the stats of every trading day
+	Days []DayStats
+}
+
+// TradeResult is a trade of a market run with the limit prices of its traders
+type TradeResult struct {
+	ID       int
+	Day      int
+	TimeStep int
+	Symbol   string
+	Price    float64
+	Quantity int
+	SellerID int
+	BuyerID  int
+	AskPrice float64
+	BidPrice float64
+	// SLimit and BLimit are the limit prices of the units traded
+	SLimit  float64
+	BLimit  float64
+	Event   string
+	SimTime float64
+}
+
+// Result returns what the exchange produced so far, it is complete once the last day is closed
+func (ex *Exchange) Result() MarketResult {
+	return ex.result
+}
+
+// recordResult adds the trades and stats of trading day d to the result of the run
+func (ex *Exchange) recordResult(d int) {
+	for _, symbol := range ex.symbols {
+		for _, t := range ex.markets[symbol].book.tradeRecord {
+			ex.result.Trades = append(ex.result.Trades, TradeResult{
+				ID:       t.TradeID,
+				Day:      d,
+				TimeStep: t.TimeStep,
+				Symbol:   t.Symbol,
+				Price:    t.Price,
+				Quantity: t.Quantity,
+				SellerID: t.SellOrder.TraderID,
+				BuyerID:  t.BuyOrder.TraderID,
+				AskPrice: t.SellOrder.Price,
+				BidPrice: t.BuyOrder.Price,
+				SLimit:   t.SLimit,
+				BLimit:   t.BLimit,
+				Event:    t.Event,
+				SimTime:  t.SimTime,
+			})
+		}
+	}
+	ex.result.Days = append(ex.result.Days, ex.day)
+}
+
+// recordUnits keeps the units given to a trader to work out the maximum surplus of the day
+func (ex *Exchange) recordUnits(traderID int, orders []*bots.TraderOrder) {
+	units := make([]bots.TraderOrder, len(orders))
+	for i, o := range orders {
+		units[i] = *o
+	}
+	ex.dayUnits[traderID] = units
+}
+
+// maxSurplus adds up the surplus at equilibrium of every instrument
+func (ex *Exchange) maxSurplus() float64 {
+	bids := map[string][]float64{}
+	asks := map[string][]float64{}
+	for _, orders := range ex.dayUnits {
+		for _, o := range orders {
+			symbol := o.GetSymbol()
+			for q := 0; q < o.Quantity; q++ {
+				if o.IsBid() {
+					bids[symbol] = append(bids[symbol], o.LimitPrice)
+				} else {
+					asks[symbol] = append(asks[symbol], o.LimitPrice)
+				}
+			}
+		}
+	}
+
+	// instruments are added in the order they are listed so the sum is the same every run
+	surplus := 0.0
+	for _, symbol := range ex.symbols {
+		surplus += equilibriumSurplus(bids[symbol], asks[symbol])
+	}
+	return surplus
+}
+
+// equilibriumSurplus matches the highest buyer limit prices with the lowest seller
+// ones for as long as they cross
+func equilibriumSurplus(bids, asks []float64) float64 {
+	sort.Sort(sort.Reverse(sort.Float64Slice(bids)))
+	sort.Float64s(asks)
+	surplus := 0.0
+	for i := 0; i < len(bids) && i < len(asks) && bids[i] > asks[i]; i++ {
+		surplus += bids[i] - asks[i]
+	}
+	return surplus
+}
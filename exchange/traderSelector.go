@@ -0,0 +1,166 @@
+package exchange
+
+import (
+	"fmt"
+)
+
+// selectionTries is the number of traders asked in a time step until one sends a valid order
+const selectionTries = 5
+
+// TraderSelector picks the traders asked for an order in each time step of step mode,
+// in discrete event mode agents come to the market on their own
+type TraderSelector interface {
+	Name() string
+	// Select returns the traders asked for an order in time step t in the order they
+	// are asked and how many orders can be accepted, asking stops once they are
+	Select(ex *Exchange, t int) ([]int, int)
+}
+
+// TraderSelectorConfig is how the trader selector is given in the configuration file
+type TraderSelectorConfig struct {
+	// Type is RANDOM, BID_ASK_RATIO (default), ROUND_ROBIN, ALL or ACTIVITY
+	Type string `json:"Type,omitempty"`
+	// Weights overrides the activity of some agents in ACTIVITY, keys are trader ids
+	Weights map[int]float64 `json:"Weights,omitempty"`
+}
+
+// NewTraderSelector builds the trader selector in the configuration
+func NewTraderSelector(config TraderSelectorConfig) (TraderSelector, error) {
+	switch config.Type {
+	case "RANDOM":
+		return &UniformSelector{}, nil
+	case "", "BID_ASK_RATIO":
+		return &RatioSelector{}, nil
+	case "ROUND_ROBIN":
+		return &RoundRobinSelector{}, nil
+	case "ALL":
+		return &AllSelector{}, nil
+	case "ACTIVITY":
+		for id, w := range config.Weights {
+			if w < 0 {
+				return nil, fmt.Errorf("weight %.2f of trader %d is negative", w, id)
+			}
+		}
+		return &ActivitySelector{Weights: config.Weights}, nil
+	}
+	return nil, fmt.Errorf("unknown trader selector %s", config.Type)
+}
+
+// UniformSelector asks traders picked uniformly at random over all the agents
+type UniformSelector struct{}
+
+func (s *UniformSelector) Name() string {
+	return "RANDOM"
+}
+
+func (s *UniformSelector) Select(ex *Exchange, t int) ([]int, int) {
+	if len(ex.agentIDs) == 0 {
+		return []int{}, 0
+	}
+
+	ids := make([]int, selectionTries)
+	for i := range ids {
+		ids[i] = ex.agentIDs[ex.rng.Intn(len(ex.agentIDs))]
+	}
+	return ids, 1
+}
+
+// RatioSelector picks the side of the market that keeps the bids/(bids + asks) of the
+// day closest to the BidAskRatio of the exchange and asks random traders of that side
+type RatioSelector struct{}
+
+func (s *RatioSelector) Name() string {
+	return "BID_ASK_RATIO"
+}
+
+func (s *RatioSelector) Select(ex *Exchange, t int) ([]int, int) {
+	traderType := ex.nextBuyerOrSeller(t)
+	ids := []int{}
+	for i := 0; i < selectionTries; i++ {
+		if id := ex.getRandomTrader(traderType); id != -1 {
+			ids = append(ids, id)
+		}
+	}
+	return ids, 1
+}
+
+// RoundRobinSelector asks the agents one per time step in id order
+type RoundRobinSelector struct {
+	next int
+}
+
+func (s *RoundRobinSelector) Name() string {
+	return "ROUND_ROBIN"
+}
+
+func (s *RoundRobinSelector) Select(ex *Exchange, t int) ([]int, int) {
+	if len(ex.agentIDs) == 0 {
+		return []int{}, 0
+	}
+
+	id := ex.agentIDs[s.next%len(ex.agentIDs)]
+	s.next = (s.next + 1) % len(ex.agentIDs)
+	return []int{id}, 1
+}
+
+// AllSelector asks every agent for an order in each time step, the order they
+// are asked in is shuffled every step so no agent is always first
+type AllSelector struct{}
+
+func (s *AllSelector) Name() string {
+	return "ALL"
+}
+
+func (s *AllSelector) Select(ex *Exchange, t int) ([]int, int) {
+	ids := make([]int, len(ex.agentIDs))
+	copy(ids, ex.agentIDs)
+	ex.rng.Shuffle(len(ids), func(i, j int) {
+		ids[i], ids[j] = ids[j], ids[i]
+	})
+	return ids, len(ids)
+}
+
+// ActivitySelector asks traders picked at random with a chance proportional to their
+// activity, the units they still have to trade unless Weights gives it
+type ActivitySelector struct {
+	Weights map[int]float64
+}
+
+func (s *ActivitySelector) Name() string {
+	return "ACTIVITY"
+}
+
+func (s *ActivitySelector) Select(ex *Exchange, t int) ([]int, int) {
+	weights := make([]float64, len(ex.agentIDs))
+	total := 0.0
+	for i, id := range ex.agentIDs {
+		weights[i] = s.activity(ex, id)
+		total += weights[i]
+	}
+	if total <= 0 {
+		return []int{}, 0
+	}
+
+	ids := make([]int, selectionTries)
+	for i := range ids {
+		x := ex.rng.Float64() * total
+		j := 0
+		for ; j < len(weights)-1 && x >= weights[j]; j++ {
+			x -= weights[j]
+		}
+		ids[i] = ex.agentIDs[j]
+	}
+	return ids, 1
+}
+
+func (s *ActivitySelector) activity(ex *Exchange, traderID int) float64 {
+	if w, ok := s.Weights[traderID]; ok {
+		return w
+	}
+
+	units := 0
+	for _, o := range ex.agents[traderID].GetExecutionOrder() {
+		units += o.Quantity
+	}
+	return float64(units)
+}
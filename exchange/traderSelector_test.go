@@ -0,0 +1,127 @@
+package exchange
+
+import (
+	"mexs/results"
+	"reflect"
+	"testing"
+)
+
+// selectorExchange is an exchange with sellers 0 and 1 and buyers 2 and 3, each with units units
+func selectorExchange(units int) *Exchange {
+	ex := &Exchange{Sink: results.Discard}
+	ex.Init(AuctionParameters{BidAskRatio: 0.5}, testInfo, []int{0, 1}, []int{2, 3})
+	setTestTraders(ex, testTrader(0, "ASK", 50, units), testTrader(1, "ASK", 50, units),
+		testTrader(2, "BID", 150, units), testTrader(3, "BID", 150, units))
+	return ex
+}
+
+func TestNewTraderSelector(t *testing.T) {
+	for _, name := range []string{"RANDOM", "BID_ASK_RATIO", "ROUND_ROBIN", "ALL", "ACTIVITY"} {
+		s, err := NewTraderSelector(TraderSelectorConfig{Type: name})
+		if err != nil || s.Name() != name {
+			t.Errorf("selector %s: got %v, %v", name, s, err)
+		}
+	}
+	if s, err := NewTraderSelector(TraderSelectorConfig{}); err != nil || s.Name() != "BID_ASK_RATIO" {
+		t.Errorf("default selector: got %v, %v", s, err)
+	}
+	if _, err := NewTraderSelector(TraderSelectorConfig{Type: "NOPE"}); err == nil {
+		t.Error("unknown selector gave no error")
+	}
+	if _, err := NewTraderSelector(TraderSelectorConfig{Type: "ACTIVITY", Weights: map[int]float64{1: -1}}); err == nil {
+		t.Error("negative weight gave no error")
+	}
+}
+
+func TestUniformSelectorAsksAnyAgent(t *testing.T) {
+	ex := selectorExchange(1)
+	ids, limit := (&UniformSelector{}).Select(ex, 0)
+	if len(ids) != selectionTries || limit != 1 {
+		t.Fatalf("asked %v for %d orders", ids, limit)
+	}
+	for _, id := range ids {
+		if id < 0 || id > 3 {
+			t.Errorf("trader %d is not in the market", id)
+		}
+	}
+
+	if ids, _ := (&UniformSelector{}).Select(&Exchange{}, 0); len(ids) != 0 {
+		t.Errorf("asked %v in a market with no traders", ids)
+	}
+}
+
+func TestRatioSelectorAsksTheSideBehindTheRatio(t *testing.T) {
+	ex := selectorExchange(1)
+	cases := []struct {
+		bids, asks int
+		side       []int
+	}{
+		{1, 3, []int{2, 3}},
+		{3, 1, []int{0, 1}},
+	}
+
+	for _, c := range cases {
+		ex.bids, ex.asks = c.bids, c.asks
+		ids, limit := (&RatioSelector{}).Select(ex, 0)
+		if len(ids) != selectionTries || limit != 1 {
+			t.Fatalf("asked %v for %d orders", ids, limit)
+		}
+		for _, id := range ids {
+			if id != c.side[0] && id != c.side[1] {
+				t.Errorf("%d bids and %d asks: trader %d was asked, want one of %v", c.bids, c.asks, id, c.side)
+			}
+		}
+	}
+}
+
+func TestRoundRobinSelectorAsksAgentsInTurn(t *testing.T) {
+	ex := selectorExchange(1)
+	s := &RoundRobinSelector{}
+	for _, want := range []int{0, 1, 2, 3, 0} {
+		if ids, limit := s.Select(ex, 0); len(ids) != 1 || ids[0] != want || limit != 1 {
+			t.Errorf("asked %v for %d orders, want trader %d", ids, limit, want)
+		}
+	}
+}
+
+func TestAllSelectorAsksEveryAgent(t *testing.T) {
+	ex := selectorExchange(1)
+	ids, limit := (&AllSelector{}).Select(ex, 0)
+	if limit != len(ids) {
+		t.Errorf("%d orders accepted from %d traders", limit, len(ids))
+	}
+	seen := map[int]bool{}
+	for _, id := range ids {
+		seen[id] = true
+	}
+	if len(ids) != 4 || !reflect.DeepEqual(seen, map[int]bool{0: true, 1: true, 2: true, 3: true}) {
+		t.Errorf("asked %v, want every trader once", ids)
+	}
+}
+
+func TestActivitySelectorFollowsActivity(t *testing.T) {
+	// without weights only traders with units left are asked
+	ex := selectorExchange(0)
+	setTestTraders(ex, testTrader(0, "ASK", 50, 0), testTrader(1, "ASK", 50, 2))
+	ids, limit := (&ActivitySelector{}).Select(ex, 0)
+	if len(ids) != selectionTries || limit != 1 {
+		t.Fatalf("asked %v for %d orders", ids, limit)
+	}
+	for _, id := range ids {
+		if id != 1 {
+			t.Errorf("trader %d with no units left was asked", id)
+		}
+	}
+
+	// weights override the activity of the traders
+	ids, _ = (&ActivitySelector{Weights: map[int]float64{0: 1, 1: 0}}).Select(ex, 0)
+	for _, id := range ids {
+		if id != 0 {
+			t.Errorf("trader %d with no weight was asked", id)
+		}
+	}
+
+	if ids, limit := (&ActivitySelector{Weights: map[int]float64{0: 0, 1: 0}}).Select(ex, 0); len(ids) != 0 || limit != 0 {
+		t.Errorf("asked %v with no activity in the market", ids)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"mexs/exchange"
+)
+
+// Mutation distributions of a gene
+const (
+	// MutationUniform adds a change drawn from [-Step, Step], integer genes move by 1 to Step
+	MutationUniform = "UNIFORM"
+	// MutationGaussian adds a change drawn from a normal distribution with deviation Step
+	MutationGaussian = "GAUSSIAN"
+	// MutationReset draws a new value from [Min, Max], or from Options for the pricing rule
+	MutationReset = "RESET"
+)
+
+// Mutations are the valid mutation distributions
+var Mutations = []string{MutationUniform, MutationGaussian, MutationReset}
+
+// GeneSpec is how one gene of the auction is initialised and evolved
+type GeneSpec struct {
+	// Evolve is false for genes that keep the value of the GA section of the config file
+	Evolve bool    `json:"Evolve"`
+	Min    float64 `json:"Min"`
+	Max    float64 `json:"Max"`
+	// Mutation is one of Mutations and Step its size
+	Mutation string  `json:"Mutation"`
+	Step     float64 `json:"Step"`
+	// Crossover is the chance the child gets the gene of the better parent, else it gets
+	// the one of the other parent
+	Crossover float64 `json:"Crossover"`
+	// Options are the values of the pricing rule gene, Min, Max and Step are not used by it
+	Options []string `json:"Options,omitempty"`
+}
+
+// GeneSchema has the spec of every gene of exchange.AuctionParameters the GA evolves,
+// OrderQueuing is always taken from the config file
+type GeneSchema struct {
+	BidAskRatio   GeneSpec `json:"BidAskRatio"`
+	KPricing      GeneSpec `json:"KPricing"`
+	MinIncrement  GeneSpec `json:"MinIncrement"`
+	MaxShift      GeneSpec `json:"MaxShift"`
+	Dominance     GeneSpec `json:"Dominance"`
+	WindowSizeEE  GeneSpec `json:"WindowSizeEE"`
+	DeltaEE       GeneSpec `json:"DeltaEE"`
+	PricingRule   GeneSpec `json:"PricingRule"`
+	PricingWindow GeneSpec `json:"PricingWindow"`
+}
+
+// DefaultGenes is the gene space used for the genes the config file does not give
+func DefaultGenes() GeneSchema {
+	return GeneSchema{
+		BidAskRatio:   GeneSpec{Evolve: true, Min: 0.1, Max: 0.9, Mutation: MutationUniform, Step: 0.05, Crossover: 0.5},
+		KPricing:      GeneSpec{Evolve: true, Min: 0, Max: 1, Mutation: MutationUniform, Step: 0.05, Crossover: 0.5},
+		MinIncrement:  GeneSpec{Evolve: true, Min: 0, Max: 20, Mutation: MutationUniform, Step: 0.5, Crossover: 0.5},
+		MaxShift:      GeneSpec{Evolve: true, Min: 0.05, Max: 10, Mutation: MutationUniform, Step: 0.2, Crossover: 0.5},
+		Dominance:     GeneSpec{Evolve: true, Min: 0, Max: 10, Mutation: MutationUniform, Step: 1, Crossover: 0.5},
+		WindowSizeEE:  GeneSpec{Evolve: true, Min: 1, Max: 20, Mutation: MutationUniform, Step: 1, Crossover: 0.5},
+		DeltaEE:       GeneSpec{Evolve: true, Min: 0, Max: 200, Mutation: MutationUniform, Step: 1, Crossover: 0.5},
+		PricingRule:   GeneSpec{Evolve: true, Mutation: MutationReset, Crossover: 0.5, Options: exchange.PricingRules},
+		PricingWindow: GeneSpec{Evolve: true, Min: 1, Max: 50, Mutation: MutationUniform, Step: 1, Crossover: 0.5},
+	}
+}
+
+// intGenes are the genes with integer values
+var intGenes = map[string]bool{"Dominance": true, "WindowSizeEE": true, "PricingWindow": true}
+
+// specs returns the genes by name
+func (s *GeneSchema) specs() map[string]*GeneSpec {
+	return map[string]*GeneSpec{
+		"BidAskRatio":   &s.BidAskRatio,
+		"KPricing":      &s.KPricing,
+		"MinIncrement":  &s.MinIncrement,
+		"MaxShift":      &s.MaxShift,
+		"Dominance":     &s.Dominance,
+		"WindowSizeEE":  &s.WindowSizeEE,
+		"DeltaEE":       &s.DeltaEE,
+		"PricingRule":   &s.PricingRule,
+		"PricingWindow": &s.PricingWindow,
+	}
+}
+
+// Validate checks every gene has a valid range, mutation and crossover
+func (s GeneSchema) Validate() error {
+	for name, g := range s.specs() {
+		if g.Crossover < 0 || g.Crossover > 1 {
+			return fmt.Errorf("gene %s: crossover %.2f is not in [0, 1]", name, g.Crossover)
+		}
+		if name == "PricingRule" {
+			if len(g.Options) == 0 {
+				return fmt.Errorf("gene %s: no options", name)
+			}
+			for _, o := range g.Options {
+				if _, err := exchange.GetPricingRule(o); err != nil {
+					return fmt.Errorf("gene %s: %s", name, err.Error())
+				}
+			}
+			continue
+		}
+		if g.Min > g.Max {
+			return fmt.Errorf("gene %s: min %.2f is above max %.2f", name, g.Min, g.Max)
+		}
+		if intGenes[name] && math.Floor(g.Max) < math.Ceil(g.Min) {
+			return fmt.Errorf("gene %s: there is no integer in [%.2f, %.2f]", name, g.Min, g.Max)
+		}
+		if g.Step < 0 {
+			return fmt.Errorf("gene %s: step %.2f is negative", name, g.Step)
+		}
+		switch g.Mutation {
+		case MutationUniform, MutationGaussian, MutationReset:
+		default:
+			return fmt.Errorf("gene %s: unknown mutation %s, valid options are %v", name, g.Mutation, Mutations)
+		}
+	}
+	return nil
+}
+
+// Apply fixes the genes that are not evolved to their value in base and puts the others in
+// their range
+func (s GeneSchema) Apply(p, base exchange.AuctionParameters) exchange.AuctionParameters {
+	p.BidAskRatio = s.BidAskRatio.fixFloat(p.BidAskRatio, base.BidAskRatio)
+	p.KPricing = s.KPricing.fixFloat(p.KPricing, base.KPricing)
+	p.MinIncrement = s.MinIncrement.fixFloat(p.MinIncrement, base.MinIncrement)
+	p.MaxShift = s.MaxShift.fixFloat(p.MaxShift, base.MaxShift)
+	p.Dominance = s.Dominance.fixInt(p.Dominance, base.Dominance)
+	p.WindowSizeEE = s.WindowSizeEE.fixInt(p.WindowSizeEE, base.WindowSizeEE)
+	p.DeltaEE = s.DeltaEE.fixFloat(p.DeltaEE, base.DeltaEE)
+	p.PricingWindow = s.PricingWindow.fixInt(p.PricingWindow, base.PricingWindow)
+
+	if !s.PricingRule.Evolve {
+		p.PricingRule = base.PricingRule
+	} else if !s.PricingRule.hasOption(p.PricingRule) {
+		p.PricingRule = s.PricingRule.Options[0]
+	}
+	return p
+}
+
+// at returns the auction with every gene at fraction f of its range, the pricing rule is
+// the first option
+func (s GeneSchema) at(f float64) exchange.AuctionParameters {
+	return exchange.AuctionParameters{
+		BidAskRatio:   s.BidAskRatio.floatAt(f),
+		KPricing:      s.KPricing.floatAt(f),
+		MinIncrement:  s.MinIncrement.floatAt(f),
+		MaxShift:      s.MaxShift.floatAt(f),
+		Dominance:     s.Dominance.intAt(f),
+		WindowSizeEE:  s.WindowSizeEE.intAt(f),
+		DeltaEE:       s.DeltaEE.floatAt(f),
+		PricingRule:   s.PricingRule.Options[0],
+		PricingWindow: s.PricingWindow.intAt(f),
+	}
+}
+
+// draw returns an auction with every gene drawn uniformly from its range or options
+func (s GeneSchema) draw(rng *rand.Rand) exchange.AuctionParameters {
+	return exchange.AuctionParameters{
+		BidAskRatio:   s.BidAskRatio.drawFloat(rng),
+		KPricing:      s.KPricing.drawFloat(rng),
+		MinIncrement:  s.MinIncrement.drawFloat(rng),
+		MaxShift:      s.MaxShift.drawFloat(rng),
+		Dominance:     s.Dominance.drawInt(rng),
+		WindowSizeEE:  s.WindowSizeEE.drawInt(rng),
+		DeltaEE:       s.DeltaEE.drawFloat(rng),
+		PricingRule:   s.PricingRule.drawChoice(rng),
+		PricingWindow: s.PricingWindow.drawInt(rng),
+	}
+}
+
+func (g GeneSpec) floatAt(f float64) float64 {
+	return g.Min + f*(g.Max-g.Min)
+}
+
+func (g GeneSpec) intAt(f float64) int {
+	return g.clampInt(int(math.Round(g.floatAt(f))))
+}
+
+func (g GeneSpec) drawFloat(rng *rand.Rand) float64 {
+	return g.Min + rng.Float64()*(g.Max-g.Min)
+}
+
+// drawInt draws one of the integers in [Min, Max]
+func (g GeneSpec) drawInt(rng *rand.Rand) int {
+	return g.clampInt(int(math.Ceil(g.Min)) + rng.Intn(int(math.Floor(g.Max)-math.Ceil(g.Min))+1))
+}
+
+func (g GeneSpec) drawChoice(rng *rand.Rand) string {
+	return g.Options[rng.Intn(len(g.Options))]
+}
+
+func (g GeneSpec) fixFloat(v, base float64) float64 {
+	if !g.Evolve {
+		return base
+	}
+	return math.Min(math.Max(v, g.Min), g.Max)
+}
+
+func (g GeneSpec) fixInt(v, base int) int {
+	if !g.Evolve {
+		return base
+	}
+	return g.clampInt(v)
+}
+
+func (g GeneSpec) clampInt(v int) int {
+	if v < int(math.Ceil(g.Min)) {
+		return int(math.Ceil(g.Min))
+	} else if v > int(math.Floor(g.Max)) {
+		return int(math.Floor(g.Max))
+	}
+	return v
+}
+
+func (g GeneSpec) hasOption(o string) bool {
+	for _, option := range g.Options {
+		if option == o {
+			return true
+		}
+	}
+	return false
+}
+
+// mutateFloat is the gene of a child of mom, the better parent, and dad
+func (g GeneSpec) mutateFloat(rng *rand.Rand, mom, dad, mRate float64) float64 {
+	if !g.Evolve {
+		return mom
+	}
+
+	v := dad
+	if rng.Float64() < g.Crossover {
+		v = mom
+	}
+	if mRate > rng.Float64() {
+		switch g.Mutation {
+		case MutationGaussian:
+			v += rng.NormFloat64() * g.Step
+		case MutationReset:
+			v = g.drawFloat(rng)
+		default:
+			v += rng.Float64()*2*g.Step - g.Step
+		}
+	}
+	return math.Min(math.Max(v, g.Min), g.Max)
+}
+
+// mutateInt is mutateFloat for integer genes, UNIFORM mutations move the gene by 1 to Step
+func (g GeneSpec) mutateInt(rng *rand.Rand, mom, dad int, mRate float64) int {
+	if !g.Evolve {
+		return mom
+	}
+
+	v := dad
+	if rng.Float64() < g.Crossover {
+		v = mom
+	}
+	if mRate > rng.Float64() {
+		switch g.Mutation {
+		case MutationGaussian:
+			v += int(math.Round(rng.NormFloat64() * g.Step))
+		case MutationReset:
+			v = g.drawInt(rng)
+		default:
+			change := rng.Intn(int(math.Max(math.Round(g.Step), 1))) + 1
+			if rng.Float64() < 0.5 {
+				change = -change
+			}
+			v += change
+		}
+	}
+	return g.clampInt(v)
+}
+
+// mutateChoice takes the gene of one of the parents, on mutation any option can be picked
+func (g GeneSpec) mutateChoice(rng *rand.Rand, mom, dad string, mRate float64) string {
+	if !g.Evolve {
+		return mom
+	}
+
+	if mRate > rng.Float64() {
+		return g.drawChoice(rng)
+	}
+	if rng.Float64() < g.Crossover {
+		return mom
+	}
+	return dad
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math/rand"
+	"mexs/exchange"
+	"testing"
+)
+
+func testGenes() GeneSchema {
+	genes := DefaultGenes()
+	genes.KPricing = GeneSpec{Evolve: true, Min: 0.2, Max: 0.4, Mutation: MutationGaussian, Step: 0.1, Crossover: 0.5}
+	genes.WindowSizeEE = GeneSpec{Evolve: true, Min: 3, Max: 7, Mutation: MutationReset, Crossover: 0.5}
+	genes.PricingRule.Options = []string{"EARLIER", "LATER"}
+	return genes
+}
+
+// inRange checks every evolved gene of p is inside the range or options of its spec
+func inRange(t *testing.T, genes GeneSchema, p exchange.AuctionParameters) {
+	t.Helper()
+	floats := map[string]float64{
+		"BidAskRatio":  p.BidAskRatio,
+		"KPricing":     p.KPricing,
+		"MinIncrement": p.MinIncrement,
+		"MaxShift":     p.MaxShift,
+		"DeltaEE":      p.DeltaEE,
+	}
+	ints := map[string]int{
+		"Dominance":     p.Dominance,
+		"WindowSizeEE":  p.WindowSizeEE,
+		"PricingWindow": p.PricingWindow,
+	}
+	specs := genes.specs()
+	for name, v := range floats {
+		if g := specs[name]; v < g.Min || v > g.Max {
+			t.Errorf("%s %.3f is not in [%.3f, %.3f]", name, v, g.Min, g.Max)
+		}
+	}
+	for name, v := range ints {
+		if g := specs[name]; float64(v) < g.Min || float64(v) > g.Max {
+			t.Errorf("%s %d is not in [%.3f, %.3f]", name, v, g.Min, g.Max)
+		}
+	}
+	if !genes.PricingRule.hasOption(p.PricingRule) {
+		t.Errorf("pricing rule %s is not one of %v", p.PricingRule, genes.PricingRule.Options)
+	}
+}
+
+func TestInitChromozoneUsesTheGeneSpace(t *testing.T) {
+	genes := testGenes()
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		inRange(t, genes, initChromozone("RANDOM", genes, rng))
+	}
+
+	low := initChromozone("LOW", genes, rng)
+	high := initChromozone("HIGH", genes, rng)
+	if low.KPricing != 0.2 || low.WindowSizeEE != 3 || low.BidAskRatio != genes.BidAskRatio.Min {
+		t.Errorf("LOW is not at the bottom of the ranges: %+v", low)
+	}
+	if high.KPricing != 0.4 || high.WindowSizeEE != 7 || high.DeltaEE != genes.DeltaEE.Max {
+		t.Errorf("HIGH is not at the top of the ranges: %+v", high)
+	}
+	inRange(t, genes, low)
+	inRange(t, genes, high)
+	inRange(t, genes, initChromozone("NORMAL", genes, rng))
+}
+
+func TestMutationsStayInTheGeneSpace(t *testing.T) {
+	genes := testGenes()
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		mom := genes.draw(rng)
+		dad := genes.draw(rng)
+		child := exchange.AuctionParameters{
+			BidAskRatio:   genes.BidAskRatio.mutateFloat(rng, mom.BidAskRatio, dad.BidAskRatio, 1),
+			KPricing:      genes.KPricing.mutateFloat(rng, mom.KPricing, dad.KPricing, 1),
+			MinIncrement:  genes.MinIncrement.mutateFloat(rng, mom.MinIncrement, dad.MinIncrement, 1),
+			MaxShift:      genes.MaxShift.mutateFloat(rng, mom.MaxShift, dad.MaxShift, 1),
+			Dominance:     genes.Dominance.mutateInt(rng, mom.Dominance, dad.Dominance, 1),
+			WindowSizeEE:  genes.WindowSizeEE.mutateInt(rng, mom.WindowSizeEE, dad.WindowSizeEE, 1),
+			DeltaEE:       genes.DeltaEE.mutateFloat(rng, mom.DeltaEE, dad.DeltaEE, 1),
+			PricingRule:   genes.PricingRule.mutateChoice(rng, mom.PricingRule, dad.PricingRule, 1),
+			PricingWindow: genes.PricingWindow.mutateInt(rng, mom.PricingWindow, dad.PricingWindow, 1),
+		}
+		inRange(t, genes, child)
+	}
+}
+
+func TestApplyKeepsGenesThatAreNotEvolved(t *testing.T) {
+	genes := testGenes()
+	genes.KPricing.Evolve = false
+	genes.PricingRule.Evolve = false
+	base := exchange.AuctionParameters{KPricing: 0.9, PricingRule: "K", OrderQueuing: 2}
+
+	p := InitializeChromozones("RANDOM", genes, base, rand.New(rand.NewSource(3)))
+	if p.KPricing != 0.9 || p.PricingRule != "K" || p.OrderQueuing != 2 {
+		t.Errorf("genes that are not evolved changed: %+v", p)
+	}
+}
+
+func TestValidateGenes(t *testing.T) {
+	if err := DefaultGenes().Validate(); err != nil {
+		t.Fatalf("default genes are not valid: %s", err.Error())
+	}
+
+	cases := map[string]func(g *GeneSchema){
+		"min above max": func(g *GeneSchema) { g.KPricing.Min = 2 },
+		"no integer": func(g *GeneSchema) {
+			g.Dominance = GeneSpec{Evolve: true, Min: 1.2, Max: 1.8, Mutation: MutationUniform}
+		},
+		"negative step":     func(g *GeneSchema) { g.DeltaEE.Step = -1 },
+		"unknown mutation":  func(g *GeneSchema) { g.MaxShift.Mutation = "FLIP" },
+		"crossover above 1": func(g *GeneSchema) { g.BidAskRatio.Crossover = 1.5 },
+		"no options":        func(g *GeneSchema) { g.PricingRule.Options = nil },
+		"unknown option":    func(g *GeneSchema) { g.PricingRule.Options = []string{"K", "NOPE"} },
+	}
+	for name, change := range cases {
+		genes := DefaultGenes()
+		change(&genes)
+		if err := genes.Validate(); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -2,22 +2,24 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"io/ioutil"
+	"math"
 	"mexs/bots"
 	"mexs/common"
 	"mexs/exchange"
+	"mexs/results"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 )
 
-
-
-
-
 type ConfigFile struct {
 	EID       string                     `json:"EID"`
 	GA        exchange.AuctionParameters `json:"GA"`
@@ -32,13 +34,72 @@ type ConfigFile struct {
 	Info         common.MarketInfo `json:"MarketInfo"`
 	Gens         int               `json:"Gens,omitempty"`
 	Individuals  int               `json:"Individuals,omitempty"`
-	FitnessFN    string            `json:"FitnessFn, omitempty"`
-	CInit        string            `json:"CInit, omitempty"`
-	EQ           float64           `json:"EQ, omitempty"`
-	EP           float64           `json:"EP, omitempty"`
-	SandDs map[int]exchange.SandD
-	Sched []exchange.SchedToPrices `json:"Schedule, omitempty"`
-	SchedTimes []SchedTimes `json:"SchedTimes, omitempty"`
+	FitnessFN    string            `json:"FitnessFn,omitempty"`
+	CInit        string            `json:"CInit,omitempty"`
+	EQ           float64           `json:"EQ,omitempty"`
+	EP           float64           `json:"EP,omitempty"`
+	SandDs       map[int]exchange.SandD
+	Sched        []exchange.SchedToPrices `json:"Schedule,omitempty"`
+	SchedTimes   []SchedTimes             `json:"SchedTimes,omitempty"`
+	// MarketType is CDA (default), CALL or HYBRID
+	MarketType string `json:"MarketType,omitempty"`
+	// CallPeriod is the number of time steps between call market clearings
+	CallPeriod int `json:"CallPeriod,omitempty"`
+	// Phases of the trading day for HYBRID markets
+	Phases []exchange.TradingPhase `json:"Phases,omitempty"`
+	// Rules are the names of the market rules checked on every shout in order
+	Rules []string `json:"Rules,omitempty"`
+	// Fees charged by the exchange to the traders
+	Fees exchange.Fees `json:"Fees,omitempty"`
+	// Markets run in competition over the same traders instead of the single market above
+	Markets []MarketSetup `json:"Markets,omitempty"`
+	// Selector is how traders pick a market each day when there are Markets
+	Selector exchange.SelectorConfig `json:"Selector,omitempty"`
+	// Instruments traded in each exchange, when empty a single good is traded
+	Instruments []InstrumentConfig `json:"Instruments,omitempty"`
+	// Async runs the exchanges as discrete event simulations with Poisson arrivals
+	Async *exchange.AsyncConfig `json:"Async,omitempty"`
+	// Latency delays the orders and market data of the agents, per agent or for all of them
+	Latency *exchange.LatencyConfig `json:"Latency,omitempty"`
+	// TraderSelector is how the traders asked for an order each time step are picked
+	TraderSelector exchange.TraderSelectorConfig `json:"TraderSelector,omitempty"`
+	// Seed of the run, every random source is derived from it. 0 draws a new one
+	Seed int64 `json:"Seed,omitempty"`
+	// SkipMarketLogs stops the markets run by the GA writing their results, the GA
+	// tables are still written
+	SkipMarketLogs bool `json:"SkipMarketLogs,omitempty"`
+	// Workers is the number of markets of a GA generation run at the same time, 0 uses every CPU
+	Workers int `json:"Workers,omitempty"`
+	// CheckpointEvery is the number of generations between checkpoints of the GA, 0 writes none
+	CheckpointEvery int `json:"CheckpointEvery,omitempty"`
+	// Genes is the gene space of the GA, genes that are left out keep DefaultGenes
+	Genes GeneSchema `json:"Genes"`
+}
+
+// InstrumentConfig is one of the goods traded in a multi-instrument market
+type InstrumentConfig struct {
+	Symbol   string  `json:"Symbol"`
+	MinPrice float64 `json:"MinPrice,omitempty"`
+	MaxPrice float64 `json:"MaxPrice,omitempty"`
+	// ScheduleType, Sched and SchedTimes are the supply and demand schedule of the
+	// instrument, an empty ScheduleType uses the schedule of the config file
+	ScheduleType string                   `json:"ScheduleType,omitempty"`
+	Sched        []exchange.SchedToPrices `json:"Schedule,omitempty"`
+	SchedTimes   []SchedTimes             `json:"SchedTimes,omitempty"`
+}
+
+// MarketSetup is the design of one of the exchanges in a competition
+type MarketSetup struct {
+	// Name of the exchange, it is also its log folder inside the experiment
+	Name       string                     `json:"Name,omitempty"`
+	GA         exchange.AuctionParameters `json:"GA"`
+	MarketType string                     `json:"MarketType,omitempty"`
+	CallPeriod int                        `json:"CallPeriod,omitempty"`
+	Phases     []exchange.TradingPhase    `json:"Phases,omitempty"`
+	Rules      []string                   `json:"Rules,omitempty"`
+	Fees       exchange.Fees              `json:"Fees,omitempty"`
+	// rules are built from Rules by checkMarket
+	rules []exchange.MarketRule
 }
 
 func init() {
@@ -117,6 +178,72 @@ func main() {
 			Usage: "Set log level [Debug, Info, Warn, Error]",
 			Value: "Info",
 		},
+		cli.Int64Flag{
+			Name:  "seed",
+			Usage: "Seed of the run, overrides the one in the config file",
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Usage: "Folder the results of the experiments are written to",
+			Value: results.DefaultRoot,
+		},
+		cli.StringFlag{
+			Name:  "output-format",
+			Usage: "Format of the results [" + strings.Join(results.Formats, ", ") + "]",
+			Value: "csv",
+		},
+		cli.IntFlag{
+			Name:  "workers",
+			Usage: "Number of markets of a GA generation run at the same time, overrides the config file",
+		},
+		cli.BoolFlag{
+			Name:  "journal",
+			Usage: "Record every event of the exchanges to a JOURNAL.jsonl in the output folder of the experiment",
+		},
+		cli.IntFlag{
+			Name:  "checkpoint-every",
+			Usage: "Number of generations between checkpoints of the GA, overrides the config file",
+		},
+		cli.StringFlag{
+			Name:  "resume",
+			Usage: "Folder of a GA with a checkpoint to continue from, the config file is taken from the checkpoint",
+		},
+		cli.IntFlag{
+			Name:  "runs",
+			Usage: "Number of runs of ItRun and ItGA, 0 keeps the default of the command (500 and 100)",
+		},
+		cli.IntFlag{
+			Name:  "parallel",
+			Usage: "Number of runs of ItRun and ItGA run at the same time",
+			Value: 1,
+		},
+	}
+
+	remoteFlags := []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "worker-addr",
+			Usage: "Address of a worker started with the worker command, repeat it for every worker",
+		},
+		cli.StringFlag{
+			Name:  "mode",
+			Usage: "What the coordinator runs [GA, ItRun, ItGA]",
+			Value: "GA",
+		},
+		cli.IntFlag{
+			Name:  "jobs-per-worker",
+			Usage: "Number of markets sent to each worker at the same time",
+			Value: 1,
+		},
+		cli.IntFlag{
+			Name:  "retries",
+			Usage: "Number of times a market is sent again when a worker fails to run it",
+			Value: 3,
+		},
+		cli.DurationFlag{
+			Name:  "job-timeout",
+			Usage: "Time a worker has to run a market before it is counted as failed",
+			Value: 10 * time.Minute,
+		},
 	}
 
 	app.Commands = []cli.Command{
@@ -140,10 +267,53 @@ func main() {
 		},
 		cli.Command{
 			Name:   "ItGA",
-			Usage:  "Runs GA experiment 100 times",
+			Usage:  "Runs the GA experiment multiple times",
 			Action: itGA,
 			Flags:  app.Flags,
 		},
+		cli.Command{
+			Name:   "coordinator",
+			Usage:  "Runs an experiment with its markets sent to worker processes, the workers write the market tables to their own --output",
+			Action: coordinator,
+			Flags:  append(remoteFlags, app.Flags...),
+		},
+		cli.Command{
+			Name:   "worker",
+			Usage:  "Runs the markets sent by a coordinator",
+			Action: worker,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "listen",
+					Usage: "Address the worker listens on",
+					Value: ":8090",
+				},
+			}, app.Flags...),
+		},
+		cli.Command{
+			Name:   "replay",
+			Usage:  "Rebuilds the order books of an experiment from its journal",
+			Action: replay,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "journal-file",
+					Usage: "Journal to replay, the JOURNAL.jsonl in the output folder of an experiment",
+				},
+				cli.IntFlag{
+					Name:  "day",
+					Usage: "Trading day the books are printed at, -1 replays the whole journal",
+					Value: -1,
+				},
+				cli.IntFlag{
+					Name:  "time-step",
+					Usage: "Time step the books are printed at, -1 is the end of the day",
+					Value: -1,
+				},
+				cli.BoolFlag{
+					Name:  "step",
+					Usage: "Print every event as it is replayed",
+				},
+			},
+		},
 	}
 
 	app.Name = "Minimal Exchange Simulator"
@@ -152,41 +322,65 @@ func main() {
 }
 
 type ExperimentConfig struct {
-	GA          exchange.AuctionParameters
-	EID         string
-	Ts          int
-	Days        int
-	SellersIDs  []int
-	BuyersIDs   []int
-	Agents      map[int]bots.RobotTrader
-	Schedule    exchange.AllocationSchedule
-	MarketInfo  common.MarketInfo
-	Sps         []float64
-	Bps         []float64
-	Gens        int    `json:"Gens,omitempty"`
-	Individuals int    `json:"Individuals,omitempty"`
-	FitnessFN   string `json:"FitnessFN, omitempty"`
-	CInit       string `json:"CInit, omitempty"`
-	EP          float64
-	EQ          float64
-	SandDs map[int]exchange.SandD
-	SLP []exchange.AgentLimitPrices `json:"SLimitPrices, omitempty"`
-	BLP []exchange.AgentLimitPrices `json:"BLimitPrices, omitempty"`
-	AlgoS        []string          `json:"AlgoS"`
-	AlgoB        []string          `json:"AlgoB"`
+	GA             exchange.AuctionParameters
+	EID            string
+	Ts             int
+	Days           int
+	SellersIDs     []int
+	BuyersIDs      []int
+	Agents         map[int]bots.RobotTrader
+	Schedule       exchange.AllocationSchedule
+	MarketInfo     common.MarketInfo
+	Sps            []float64
+	Bps            []float64
+	Gens           int    `json:"Gens,omitempty"`
+	Individuals    int    `json:"Individuals,omitempty"`
+	FitnessFN      string `json:"FitnessFN,omitempty"`
+	CInit          string `json:"CInit,omitempty"`
+	EP             float64
+	EQ             float64
+	SandDs         map[int]exchange.SandD
+	SLP            []exchange.AgentLimitPrices `json:"SLimitPrices,omitempty"`
+	BLP            []exchange.AgentLimitPrices `json:"BLimitPrices,omitempty"`
+	AlgoS          []string                    `json:"AlgoS"`
+	AlgoB          []string                    `json:"AlgoB"`
+	MarketType     string
+	CallPeriod     int
+	Phases         []exchange.TradingPhase
+	Rules          []exchange.MarketRule
+	Fees           exchange.Fees
+	Markets        []MarketSetup
+	Selector       exchange.SelectorConfig
+	Instruments    []exchange.Instrument
+	Async          *exchange.AsyncConfig
+	Latency        *exchange.LatencyConfig
+	TraderSelector exchange.TraderSelectorConfig
+	Seed           int64
+	// Journal records the events of the exchanges, nil when --journal is not given
+	Journal         exchange.Journal
+	SkipMarketLogs  bool
+	Workers         int
+	CheckpointEvery int
+	Genes           GeneSchema
+	// Output is the folder given with --output
+	Output string
+	// Source is the config file the experiment was built from, it is what remote workers get
+	Source ConfigFile
+	// Runner runs the markets of the GA and ItRun, they run in this process when nil
+	Runner MarketRunner
 }
 
 type SchedTimes struct {
-	Days []int `json:"Days"`
+	Days      []int `json:"Days"`
 	TimeSteps []int `json:"TimeSteps"`
-	SchedID int `json:"SchedID"`
+	SchedID   int   `json:"SchedID"`
 }
 
 func checkFlags(c *cli.Context) ExperimentConfig {
 	configFile := strings.TrimSpace(c.String("config-file"))
 	if configFile != "NIL" {
 		return getConfigFile(configFile, c)
-	} else{
+	} else {
 		log.Panic("A configuration file is required to be passed in use flag --config-file")
 		return ExperimentConfig{}
 	}
@@ -261,7 +455,7 @@ func checkFlags(c *cli.Context) ExperimentConfig {
 }
 
 func MakeTraders(limitPrices []float64, idStart, n int, traderType, traderAlgo string,
-	traders map[int]bots.RobotTrader, info common.MarketInfo) (map[int]bots.RobotTrader, []int) {
+	traders map[int]bots.RobotTrader, info common.MarketInfo, seed int64) (map[int]bots.RobotTrader, []int) {
 	ids := make([]int, n)
 	tType := "SELLER"
 	if traderType == "BUYER" {
@@ -271,25 +465,25 @@ func MakeTraders(limitPrices []float64, idStart, n int, traderType, traderAlgo s
 	if traderAlgo == "ZIP" {
 		for i := 0; i < n; i++ {
 			zip := &bots.ZIPTrader{}
-			zip.InitRobotCore(i+idStart, tType, info)
+			zip.InitRobotCore(i+idStart, tType, info, common.NewRand(seed, "agent", i+idStart))
 			traders[zip.Info.TraderID] = zip
 			ids[i] = zip.Info.TraderID
 		}
 	} else if traderAlgo == "ZIC" {
 		for i := 0; i < n; i++ {
 			zip := &bots.ZICTrader{}
-			zip.InitRobotCore(i+idStart, tType, info)
+			zip.InitRobotCore(i+idStart, tType, info, common.NewRand(seed, "agent", i+idStart))
 			traders[zip.Info.TraderID] = zip
 			ids[i] = zip.Info.TraderID
 		}
 	} else if traderAlgo == "AA" {
 		for i := 0; i < n; i++ {
 			t := &bots.AATrader{}
-			t.InitRobotCore(i+idStart, tType, info)
+			t.InitRobotCore(i+idStart, tType, info, common.NewRand(seed, "agent", i+idStart))
 			traders[t.Info.TraderID] = t
 			ids[i] = t.Info.TraderID
 		}
-	}else {
+	} else {
 		log.Panic("Invalid algo type:", traderAlgo)
 	}
 
@@ -304,9 +498,46 @@ func getConfigFile(fileName string, c *cli.Context) ExperimentConfig {
 
 	// Parse json into ConfigFile struct
 	byteValue, _ := ioutil.ReadAll(jsonFile)
-	var configFile ConfigFile
+	// the genes in the file are decoded over the default ones so a gene can be given in part
+	configFile := ConfigFile{Genes: DefaultGenes()}
 	json.Unmarshal(byteValue, &configFile)
 
+	setOutputs(c)
+
+	// Generate experiment id
+	if configFile.EID == "" {
+		configFile.EID = strings.TrimSpace(c.String("eid"))
+	}
+
+	// The seed in the command line wins over the config file, without any a new one is drawn
+	if c.Int64("seed") != 0 {
+		configFile.Seed = c.Int64("seed")
+	}
+	if configFile.Seed == 0 {
+		configFile.Seed = time.Now().UnixNano()
+	}
+	recordSeed(results.Default, configFile.EID, configFile.Seed)
+
+	// The workers in the command line win over the config file, without any every CPU is used
+	if c.Int("workers") > 0 {
+		configFile.Workers = c.Int("workers")
+	}
+	if configFile.Workers <= 0 {
+		configFile.Workers = runtime.NumCPU()
+	}
+
+	if c.Int("checkpoint-every") > 0 {
+		configFile.CheckpointEvery = c.Int("checkpoint-every")
+	}
+
+	config := buildConfig(configFile)
+	config.Journal = newJournal(c)
+	config.Output = strings.TrimSpace(c.String("output"))
+	return config
+}
+
+// setOutputs sets the log level and the result sink given in the command line
+func setOutputs(c *cli.Context) {
 	// Set log level only set through command line
 	log.SetLevel(log.InfoLevel)
 	logLevel := strings.TrimSpace(c.String("log-level"))
@@ -323,26 +554,42 @@ func getConfigFile(fileName string, c *cli.Context) ExperimentConfig {
 		log.SetLevel(log.InfoLevel)
 	}
 
-	// Generate experiment id
-	if configFile.EID == "" {
-		configFile.EID = strings.TrimSpace(c.String("eid"))
+	sink, err := results.NewSink(strings.TrimSpace(c.String("output-format")), strings.TrimSpace(c.String("output")))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Valid options": results.Formats,
+			"error":         err.Error(),
+		}).Panic("The output is not valid")
 	}
+	results.Default = sink
+}
+
+// newJournal is the journal of the experiments when --journal is given, nil otherwise
+func newJournal(c *cli.Context) exchange.Journal {
+	if c.Bool("journal") {
+		return &exchange.FileJournal{Root: strings.TrimSpace(c.String("output"))}
+	}
+	return nil
+}
 
+// buildConfig checks the config file and builds the experiment it describes, it panics
+// if the experiment can not be run
+func buildConfig(configFile ConfigFile) ExperimentConfig {
 	// Create the agents for the experiment
 	traders := make(map[int]bots.RobotTrader)
 	for i, id := range configFile.SellerIDs {
 		switch configFile.AlgoS[i] {
 		case "ZIP":
 			zipT := &bots.ZIPTrader{}
-			zipT.InitRobotCore(id, "SELLER", configFile.Info)
+			zipT.InitRobotCore(id, "SELLER", configFile.Info, common.NewRand(configFile.Seed, "agent", id))
 			traders[zipT.Info.TraderID] = zipT
 		case "ZIC":
 			zic := &bots.ZICTrader{}
-			zic.InitRobotCore(id, "SELLER", configFile.Info)
+			zic.InitRobotCore(id, "SELLER", configFile.Info, common.NewRand(configFile.Seed, "agent", id))
 			traders[zic.Info.TraderID] = zic
 		case "AA":
 			aa := &bots.AATrader{}
-			aa.InitRobotCore(id, "SELLER", configFile.Info)
+			aa.InitRobotCore(id, "SELLER", configFile.Info, common.NewRand(configFile.Seed, "agent", id))
 			traders[aa.Info.TraderID] = aa
 		default:
 			log.Panic("SHIIT")
@@ -353,23 +600,105 @@ func getConfigFile(fileName string, c *cli.Context) ExperimentConfig {
 		switch configFile.AlgoB[i] {
 		case "ZIP":
 			zipT := &bots.ZIPTrader{}
-			zipT.InitRobotCore(id, "BUYER", configFile.Info)
+			zipT.InitRobotCore(id, "BUYER", configFile.Info, common.NewRand(configFile.Seed, "agent", id))
 			traders[zipT.Info.TraderID] = zipT
 		case "ZIC":
 			zic := &bots.ZICTrader{}
-			zic.InitRobotCore(id, "BUYER", configFile.Info)
+			zic.InitRobotCore(id, "BUYER", configFile.Info, common.NewRand(configFile.Seed, "agent", id))
 			traders[zic.Info.TraderID] = zic
 		case "AA":
 			aa := &bots.AATrader{}
-			aa.InitRobotCore(id, "BUYER", configFile.Info)
+			aa.InitRobotCore(id, "BUYER", configFile.Info, common.NewRand(configFile.Seed, "agent", id))
 			traders[aa.Info.TraderID] = aa
 		default:
 			log.Panic("SHIIT")
 		}
 	}
 
-	sched, sand := generateSchedule(configFile.ScheduleType,configFile.SellerIDs, configFile.BuyerIDs, configFile.Sched,
+	// The market settings at the top of the file are the single exchange of the experiment
+	market := MarketSetup{
+		GA:         configFile.GA,
+		MarketType: configFile.MarketType,
+		CallPeriod: configFile.CallPeriod,
+		Phases:     configFile.Phases,
+		Rules:      configFile.Rules,
+		Fees:       configFile.Fees,
+	}
+	checkMarket(&market, configFile.Info.MarketEnd)
+
+	names := map[string]bool{}
+	for i := range configFile.Markets {
+		m := &configFile.Markets[i]
+		if m.Name == "" {
+			m.Name = "EX_" + strconv.Itoa(i)
+		}
+		if names[m.Name] {
+			log.WithFields(log.Fields{
+				"Name": m.Name,
+			}).Panic("Two markets have the same name")
+		}
+		names[m.Name] = true
+		// Markets without their own auction parameters use the ones in GA
+		if m.GA == (exchange.AuctionParameters{}) {
+			m.GA = configFile.GA
+		}
+		checkMarket(m, configFile.Info.MarketEnd)
+	}
+
+	if _, err := exchange.NewMarketSelector(configFile.Selector, nil); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Panic("The market selector is not valid")
+	}
+
+	if _, err := exchange.NewTraderSelector(configFile.TraderSelector); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Panic("The trader selector is not valid")
+	}
+
+	sched, sand := generateSchedule(configFile.ScheduleType, configFile.SellerIDs, configFile.BuyerIDs, configFile.Sched,
 		configFile.Days, configFile.SchedTimes)
+
+	instruments := make([]exchange.Instrument, len(configFile.Instruments))
+	for i, ic := range configFile.Instruments {
+		instruments[i] = exchange.Instrument{
+			Symbol:   ic.Symbol,
+			MinPrice: ic.MinPrice,
+			MaxPrice: ic.MaxPrice,
+		}
+		if ic.ScheduleType != "" {
+			instruments[i].Alloc, instruments[i].SandDs = generateSchedule(ic.ScheduleType, configFile.SellerIDs,
+				configFile.BuyerIDs, ic.Sched, configFile.Days, ic.SchedTimes)
+		}
+	}
+	if err := exchange.ValidateInstruments(instruments); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Panic("The instruments are not valid")
+	}
+
+	if configFile.Async != nil {
+		if err := configFile.Async.Validate(); err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Panic("The asynchronous mode is not valid")
+		}
+	}
+
+	if configFile.Latency != nil {
+		if err := configFile.Latency.Validate(); err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Panic("The latency is not valid")
+		}
+	}
+
+	if err := configFile.Genes.Validate(); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Panic("The gene space of the GA is not valid")
+	}
 	return ExperimentConfig{
 		EID:        configFile.EID,
 		GA:         configFile.GA,
@@ -380,28 +709,165 @@ func getConfigFile(fileName string, c *cli.Context) ExperimentConfig {
 		MarketInfo: configFile.Info,
 		Agents:     traders,
 		// For now only standard schedule accepted
-		Schedule:    sched,
-		SandDs: sand,
-		Gens:        configFile.Gens,
-		Individuals: configFile.Individuals,
-		FitnessFN:   configFile.FitnessFN,
-		CInit:       configFile.CInit,
-		EQ:          configFile.EQ,
-		EP:          configFile.EP,
-		AlgoS: configFile.AlgoS,
-		AlgoB: configFile.AlgoB,
+		Schedule:        sched,
+		SandDs:          sand,
+		Gens:            configFile.Gens,
+		Individuals:     configFile.Individuals,
+		FitnessFN:       configFile.FitnessFN,
+		CInit:           configFile.CInit,
+		EQ:              configFile.EQ,
+		EP:              configFile.EP,
+		AlgoS:           configFile.AlgoS,
+		AlgoB:           configFile.AlgoB,
+		MarketType:      market.MarketType,
+		CallPeriod:      market.CallPeriod,
+		Phases:          market.Phases,
+		Rules:           market.rules,
+		Fees:            market.Fees,
+		Markets:         configFile.Markets,
+		Selector:        configFile.Selector,
+		Instruments:     instruments,
+		Async:           configFile.Async,
+		Latency:         configFile.Latency,
+		TraderSelector:  configFile.TraderSelector,
+		Seed:            configFile.Seed,
+		SkipMarketLogs:  configFile.SkipMarketLogs,
+		Workers:         configFile.Workers,
+		CheckpointEvery: configFile.CheckpointEvery,
+		Genes:           configFile.Genes,
+		Source:          configFile,
+	}
+}
+
+// checkMarket validates the design of a market and fills in its defaults, it panics
+// if the market can not be run
+func checkMarket(m *MarketSetup, marketEnd int) {
+	switch m.MarketType {
+	case "":
+		m.MarketType = "CDA"
+	case "CDA", "CALL":
+	case "HYBRID":
+		if err := exchange.ValidatePhases(m.Phases, marketEnd); err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Panic("The trading phases are not valid")
+		}
+	default:
+		log.WithFields(log.Fields{
+			"Valid options": "[CDA, CALL, HYBRID]",
+			"Given option":  m.MarketType,
+		}).Panic("The market type is unsupported")
+	}
+
+	// Phases are only used by HYBRID markets
+	if m.MarketType != "HYBRID" {
+		m.Phases = nil
+	}
+
+	if _, err := exchange.GetPricingRule(m.GA.PricingRule); err != nil {
+		log.WithFields(log.Fields{
+			"Valid options": exchange.PricingRules,
+			"error":         err.Error(),
+		}).Panic("The pricing rule is not valid")
+	}
+
+	if m.Rules == nil {
+		m.Rules = exchange.DefaultRules
+	}
+	rules, err := exchange.BuildRules(m.Rules)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Panic("The market rules are not valid")
+	}
+	m.rules = rules
+
+	if err := m.Fees.Validate(); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Panic("The exchange fees are not valid")
+	}
+}
+
+// newExchange creates an exchange with the market setup of the experiment
+func newExchange(config ExperimentConfig) *exchange.Exchange {
+	// every exchange gets its own selector as some of them keep state
+	selector, _ := exchange.NewTraderSelector(config.TraderSelector)
+	return &exchange.Exchange{
+		MarketType:     config.MarketType,
+		CallPeriod:     config.CallPeriod,
+		Phases:         config.Phases,
+		Rules:          config.Rules,
+		Fees:           config.Fees,
+		Instruments:    config.Instruments,
+		Async:          config.Async,
+		Latency:        config.Latency,
+		TraderSelector: selector,
+		Seed:           config.Seed,
+		Journal:        config.Journal,
+	}
+}
+
+// recordSeed saves the seed of a run to its SEED table, passing it back with --seed
+// replays the run
+func recordSeed(sink results.ResultSink, eid string, seed int64) {
+	results.Save(sink, eid, "SEED", []string{"Seed"}, [][]string{{strconv.FormatInt(seed, 10)}})
+}
+
+// closeOutputs flushes the results and the journal of the experiment
+func closeOutputs(config ExperimentConfig) {
+	results.Default.Close()
+	if config.Journal != nil {
+		config.Journal.Close()
 	}
 }
 
 func experiment(c *cli.Context) {
 	eConfig := checkFlags(c)
+	defer closeOutputs(eConfig)
 	log.Debug("Number of traders is:", len(eConfig.Agents))
-	ex := exchange.Exchange{LogAll:true}
+	if len(eConfig.Markets) > 0 {
+		competition(eConfig)
+		return
+	}
+
+	ex := newExchange(eConfig)
+	ex.LogAll = true
 	ex.Init(eConfig.GA, eConfig.MarketInfo, eConfig.SellersIDs, eConfig.BuyersIDs)
 	ex.SetTraders(eConfig.Agents)
 	ex.StartMarket(eConfig.EID, eConfig.Schedule, eConfig.SandDs)
 }
 
+// competition runs the markets in the config in lockstep, traders pick one of them each day
+func competition(eConfig ExperimentConfig) {
+	selector, _ := exchange.NewMarketSelector(eConfig.Selector, common.NewRand(eConfig.Seed, "selector", 0))
+	comp := &exchange.Competition{
+		EID:      eConfig.EID,
+		Selector: selector,
+	}
+	for i, m := range eConfig.Markets {
+		traderSelector, _ := exchange.NewTraderSelector(eConfig.TraderSelector)
+		ex := &exchange.Exchange{
+			LogAll:         true,
+			MarketType:     m.MarketType,
+			CallPeriod:     m.CallPeriod,
+			Phases:         m.Phases,
+			Rules:          m.rules,
+			Fees:           m.Fees,
+			Instruments:    eConfig.Instruments,
+			Async:          eConfig.Async,
+			Latency:        eConfig.Latency,
+			TraderSelector: traderSelector,
+			Seed:           common.DeriveSeed(eConfig.Seed, "market", i),
+			Journal:        eConfig.Journal,
+		}
+		ex.Init(m.GA, eConfig.MarketInfo, []int{}, []int{})
+		comp.Exchanges = append(comp.Exchanges, ex)
+		comp.Names = append(comp.Names, m.Name)
+	}
+	comp.SetTraders(eConfig.Agents, eConfig.SellersIDs, eConfig.BuyersIDs)
+	comp.Start(eConfig.Schedule, eConfig.SandDs)
+}
 
 // Create schedule based on config file
 // For now only standard supported
@@ -414,34 +880,33 @@ func generateSchedule(schedType string, sellerIDs, buyerIDs []int, schedAndPrice
 		return generateStandardSched(sellerIDs, buyerIDs, schedAndPrices[0], days)
 	case "CUSTOM":
 		m := mapifySchedToPrice(schedAndPrices)
-		return generateCustomSched(sellerIDs, buyerIDs,m, schedTimes, days)
+		return generateCustomSched(sellerIDs, buyerIDs, m, schedTimes, days)
 	default:
 		log.WithFields(log.Fields{
 			"Valid options": "[STANDARD]",
-			"Given option": schedType,
+			"Given option":  schedType,
 		}).Panic("The schedule type is unsupported")
 		return exchange.AllocationSchedule{}, make(map[int]exchange.SandD)
 	}
 }
 
 // Standard schedule has only one set of limit prices that are refilled each day
-func generateStandardSched(sellerIDs, buyerIDs []int, schedAndPrices exchange.SchedToPrices, days int)(exchange.AllocationSchedule, map[int]exchange.SandD) {
+func generateStandardSched(sellerIDs, buyerIDs []int, schedAndPrices exchange.SchedToPrices, days int) (exchange.AllocationSchedule, map[int]exchange.SandD) {
 	allocSched := exchange.AllocationSchedule{
 		Schedule: make(map[int]map[int]int),
 	}
 
-	for d:=0; d < days; d++ {
+	for d := 0; d < days; d++ {
 		allocSched.Schedule[d] = make(map[int]int)
 		allocSched.Schedule[d][0] = schedAndPrices.SID
 	}
 
-
 	sandd := exchange.SandD{
-		ID: schedAndPrices.SID,
+		ID:   schedAndPrices.SID,
 		SIDs: sellerIDs,
 		BIDs: buyerIDs,
-		Sps: schedAndPrices.SLimitPrices,
-		Bps: schedAndPrices.BLimitPrices,
+		Sps:  schedAndPrices.SLimitPrices,
+		Bps:  schedAndPrices.BLimitPrices,
 	}
 
 	sMap := make(map[int]exchange.SandD)
@@ -450,13 +915,13 @@ func generateStandardSched(sellerIDs, buyerIDs []int, schedAndPrices exchange.Sc
 	return allocSched, sMap
 }
 
-func generateCustomSched(sellerIDs, buyerIDs []int, schedAndPrices map[int]exchange.SchedToPrices, schedTimes []SchedTimes, days int)(exchange.AllocationSchedule, map[int]exchange.SandD) {
+func generateCustomSched(sellerIDs, buyerIDs []int, schedAndPrices map[int]exchange.SchedToPrices, schedTimes []SchedTimes, days int) (exchange.AllocationSchedule, map[int]exchange.SandD) {
 
 	allocSched := exchange.AllocationSchedule{
 		Schedule: make(map[int]map[int]int),
 	}
 
-	for d:=0; d< days; d++ {
+	for d := 0; d < days; d++ {
 		allocSched.Schedule[d] = make(map[int]int)
 	}
 
@@ -469,18 +934,18 @@ func generateCustomSched(sellerIDs, buyerIDs []int, schedAndPrices map[int]excha
 		}
 
 		sMap[st.SchedID] = exchange.SandD{
-			ID: st.SchedID,
+			ID:   st.SchedID,
 			SIDs: sellerIDs,
 			BIDs: buyerIDs,
-			Sps: schedAndPrices[st.SchedID].SLimitPrices,
-			Bps: schedAndPrices[st.SchedID].BLimitPrices,
+			Sps:  schedAndPrices[st.SchedID].SLimitPrices,
+			Bps:  schedAndPrices[st.SchedID].BLimitPrices,
 		}
 	}
 
 	return allocSched, sMap
 }
 
-func mapifySchedToPrice (s []exchange.SchedToPrices) (map[int]exchange.SchedToPrices){
+func mapifySchedToPrice(s []exchange.SchedToPrices) map[int]exchange.SchedToPrices {
 	r := make(map[int]exchange.SchedToPrices)
 	for _, v := range s {
 		r[v.SID] = v
@@ -495,52 +960,113 @@ func (a float64arr) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a float64arr) Less(i, j int) bool { return a[i] < a[j] }
 
 func startGA(c *cli.Context) {
+	if dir := strings.TrimSpace(c.String("resume")); dir != "" {
+		resumeGA(c, dir)
+		return
+	}
+
 	config := checkFlags(c)
+	defer closeOutputs(config)
+	runGA(config)
+}
 
-	ga := &GA{
+// runGA evolves the auction of the experiment
+func runGA(config ExperimentConfig) *GA {
+	ga := newGA(config)
+	ga.Start()
+	return ga
+}
+
+func newGA(config ExperimentConfig) *GA {
+	return &GA{
 		N:                   config.Individuals,
 		Gens:                config.Gens,
 		Config:              config,
 		CurrentGen:          0,
 		EquilibriumQuantity: config.EQ,
 		EquilibriumPrice:    config.EP,
-		MutationRate: 0.1,
+		CheckpointEvery:     config.CheckpointEvery,
+		CheckpointDir:       filepath.Join(config.Output, config.EID),
 	}
+}
 
-	ga.Start()
+// resumeGA continues the GA checkpointed in dir, its results are added to the ones the
+// GA wrote before it stopped
+func resumeGA(c *cli.Context, dir string) {
+	cp, err := ReadCheckpoint(dir)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Folder": dir,
+			"error":  err.Error(),
+		}).Panic("The checkpoint could not be read")
+	}
+
+	setOutputs(c)
+	if c.Int("workers") > 0 {
+		cp.Config.Workers = c.Int("workers")
+	}
+	if c.Int("checkpoint-every") > 0 {
+		cp.Config.CheckpointEvery = c.Int("checkpoint-every")
+	}
+	config := buildConfig(cp.Config)
+	config.Journal = newJournal(c)
+	config.Output = strings.TrimSpace(c.String("output"))
+	defer closeOutputs(config)
+
+	ga := newGA(config)
+	// the checkpoints of the resumed run replace the one it started from
+	ga.CheckpointDir = dir
+	ga.Resume(cp)
 }
 
 func itRun(c *cli.Context) {
-	runs := 500
-	for i := 0; i < runs; i++ {
-		log.Warn("Run:", i)
-		config := checkFlags(c)
-		ex := exchange.Exchange{LogAll:true}
-		ex.Init(config.GA, config.MarketInfo, config.SellersIDs, config.BuyersIDs)
-		ex.SetTraders(ReMakeAgents(config))
-		ex.StartMarket(config.EID+"_"+strconv.Itoa(i), config.Schedule, config.SandDs)
-	}
+	base := checkFlags(c)
+	defer closeOutputs(base)
+	runIterations(base, batchRuns(c, 500), c.Int("parallel"))
 }
 
-func itGA(c *cli.Context) {
-	runs := 100
-	for i:= 0; i < runs; i++ {
-		log.Warn("Run: ", i)
-		config := checkFlags(c)
-		config.EID = config.EID +"/run_"+strconv.Itoa(i)
-		ga := &GA{
-			N:                   config.Individuals,
-			Gens:                config.Gens,
-			Config:              config,
-			CurrentGen:          0,
-			EquilibriumQuantity: config.EQ,
-			EquilibriumPrice:    config.EP,
-			MutationRate: 0.06,
+// runIterations runs the market of the experiment runs times and writes their summary
+func runIterations(base ExperimentConfig, runs, parallel int) {
+	summaries := runBatch(base, runs, parallel, func(i int) string {
+		return base.EID + "_" + strconv.Itoa(i)
+	}, func(config ExperimentConfig) exchange.MarketResult {
+		job := MarketJob{EID: config.EID, Params: config.GA, Seed: config.Seed, LogAll: true}
+		markets, err := runnerOf(config, 1, results.Default).Run(config, []MarketJob{job})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"EID":   config.EID,
+				"error": err.Error(),
+			}).Panic("The market could not be run")
 		}
-		ga.Start()
-	}
+		return markets[0]
+	})
+	writeSummary(base.EID, summaries)
 }
 
+func itGA(c *cli.Context) {
+	base := checkFlags(c)
+	defer closeOutputs(base)
+	runGAs(base, batchRuns(c, 100), c.Int("parallel"))
+}
+
+// runGAs runs the GA of the experiment runs times, the summary is made with the market
+// of the elite of the last generation of each run
+func runGAs(base ExperimentConfig, runs, parallel int) {
+	summaries := runBatch(base, runs, parallel, func(i int) string {
+		return base.EID + "/run_" + strconv.Itoa(i)
+	}, func(config ExperimentConfig) exchange.MarketResult {
+		return runGA(config).Elite
+	})
+	writeSummary(base.EID, summaries)
+}
+
+// batchRuns is the number of runs given with --runs, def when it is not set
+func batchRuns(c *cli.Context, def int) int {
+	if c.Int("runs") > 0 {
+		return c.Int("runs")
+	}
+	return def
+}
 
 func ReMakeAgents(Config ExperimentConfig) map[int]bots.RobotTrader {
 	traders := make(map[int]bots.RobotTrader)
@@ -548,15 +1074,15 @@ func ReMakeAgents(Config ExperimentConfig) map[int]bots.RobotTrader {
 		switch Config.AlgoS[i] {
 		case "ZIP":
 			zipT := &bots.ZIPTrader{}
-			zipT.InitRobotCore(id, "SELLER", Config.MarketInfo)
+			zipT.InitRobotCore(id, "SELLER", Config.MarketInfo, common.NewRand(Config.Seed, "agent", id))
 			traders[zipT.Info.TraderID] = zipT
 		case "ZIC":
 			zic := &bots.ZICTrader{}
-			zic.InitRobotCore(id, "SELLER", Config.MarketInfo)
+			zic.InitRobotCore(id, "SELLER", Config.MarketInfo, common.NewRand(Config.Seed, "agent", id))
 			traders[zic.Info.TraderID] = zic
 		case "AA":
 			aa := &bots.AATrader{}
-			aa.InitRobotCore(id, "SELLER", Config.MarketInfo)
+			aa.InitRobotCore(id, "SELLER", Config.MarketInfo, common.NewRand(Config.Seed, "agent", id))
 			traders[aa.Info.TraderID] = aa
 		default:
 			log.Panic("SHIIT")
@@ -567,19 +1093,60 @@ func ReMakeAgents(Config ExperimentConfig) map[int]bots.RobotTrader {
 		switch Config.AlgoB[i] {
 		case "ZIP":
 			zipT := &bots.ZIPTrader{}
-			zipT.InitRobotCore(id, "BUYER", Config.MarketInfo)
+			zipT.InitRobotCore(id, "BUYER", Config.MarketInfo, common.NewRand(Config.Seed, "agent", id))
 			traders[zipT.Info.TraderID] = zipT
 		case "ZIC":
 			zic := &bots.ZICTrader{}
-			zic.InitRobotCore(id, "BUYER", Config.MarketInfo)
+			zic.InitRobotCore(id, "BUYER", Config.MarketInfo, common.NewRand(Config.Seed, "agent", id))
 			traders[zic.Info.TraderID] = zic
 		case "AA":
 			aa := &bots.AATrader{}
-			aa.InitRobotCore(id, "BUYER", Config.MarketInfo)
+			aa.InitRobotCore(id, "BUYER", Config.MarketInfo, common.NewRand(Config.Seed, "agent", id))
 			traders[aa.Info.TraderID] = aa
 		default:
 			log.Panic("SHIIT")
 		}
 	}
 	return traders
-}
\ No newline at end of file
+}
+
+// replay rebuilds the order books of an experiment from its journal and prints them at
+// the end of the given day and time step, with --step every event is printed on the way
+func replay(c *cli.Context) {
+	path := strings.TrimSpace(c.String("journal-file"))
+	if path == "" {
+		log.Panic("A journal is required to be passed in use flag --journal-file")
+	}
+	events, err := exchange.ReadJournal(path)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Panic("The journal could not be read")
+	}
+
+	day, t := c.Int("day"), c.Int("time-step")
+	if day < 0 {
+		day = math.MaxInt32
+	}
+	if t < 0 {
+		t = math.MaxInt32
+	}
+
+	r := &exchange.Replay{}
+	r.Init(events)
+	for {
+		e, ok := r.Peek()
+		if !ok || e.After(day, t) {
+			break
+		}
+		if _, err := r.Step(); err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Panic("The journal could not be replayed")
+		}
+		if c.Bool("step") {
+			fmt.Println(e)
+		}
+	}
+	r.WriteBook(os.Stdout)
+}
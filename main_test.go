@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mexs/results"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	results.Default = results.Discard
+	// the test binary is also the worker process started by startWorkerProcess
+	if addr := os.Getenv(testWorkerEnv); addr != "" {
+		os.Args = []string{"mexs", "worker", "--listen", addr, "--output", os.Getenv(testWorkerOutputEnv)}
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testConfigFile is the simple test config of the repo shortened to one day of 50 steps
+func testConfigFile(t *testing.T) ConfigFile {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("configFiles", "SimpleTest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := ConfigFile{Genes: DefaultGenes()}
+	if err := json.Unmarshal(data, &configFile); err != nil {
+		t.Fatal(err)
+	}
+
+	configFile.EID = "test"
+	configFile.Seed = 1
+	configFile.GA.BidAskRatio = 0.5
+	configFile.Ts = 50
+	configFile.Days = 1
+	configFile.Info.MarketEnd = 50
+	configFile.Info.TradingDays = 1
+	configFile.Gens = 3
+	configFile.Individuals = 4
+	configFile.Workers = 2
+	configFile.SkipMarketLogs = true
+	return configFile
+}
+
+func testConfig(t *testing.T) ExperimentConfig {
+	t.Helper()
+	return buildConfig(testConfigFile(t))
+}
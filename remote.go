@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"mexs/exchange"
+	"mexs/results"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Protocol between the coordinator and the workers, the coordinator POSTs a workerRequest
+// as JSON to /run and the worker answers with the exchange.MarketResult of the market.
+// A 4xx answer means the job can not be run, statusJobFailed that the market failed and
+// would fail again anywhere, anything else that fails is tried again
+const (
+	workerRunPath    = "/run"
+	workerHealthPath = "/health"
+	statusJobFailed  = http.StatusUnprocessableEntity
+)
+
+// errNoWorkers is the error of the jobs left when every worker stopped answering
+var errNoWorkers = errors.New("no worker is answering")
+
+// workerRequest is a job sent to a worker with the config file of its experiment
+type workerRequest struct {
+	Config ConfigFile
+	Job    MarketJob
+}
+
+// RemoteRunner sends the markets to worker processes over HTTP. A job that fails is sent
+// again to any worker up to Retries times, a worker that fails more than Retries jobs in
+// a row gets no more jobs. The workers write the tables of the markets to their own
+// --output, only what the coordinator builds from the results sent back, as the GA
+// tables and the run summary, goes to the output of the coordinator
+type RemoteRunner struct {
+	Addrs []string
+	// Slots is the number of jobs each worker is sent at the same time
+	Slots   int
+	Retries int
+	Client  *http.Client
+
+	once  sync.Once
+	tasks chan *remoteTask
+	mu    sync.Mutex
+	alive int
+}
+
+type remoteTask struct {
+	req      workerRequest
+	attempts int
+	done     chan remoteResult
+}
+
+type remoteResult struct {
+	market exchange.MarketResult
+	err    error
+}
+
+func (r *RemoteRunner) Run(config ExperimentConfig, jobs []MarketJob) ([]exchange.MarketResult, error) {
+	r.once.Do(r.start)
+
+	tasks := make([]*remoteTask, len(jobs))
+	for i, job := range jobs {
+		tasks[i] = &remoteTask{
+			req:  workerRequest{Config: config.Source, Job: job},
+			done: make(chan remoteResult, 1),
+		}
+	}
+	go func() {
+		for _, t := range tasks {
+			r.tasks <- t
+		}
+	}()
+
+	markets := make([]exchange.MarketResult, len(jobs))
+	var first error
+	for i, t := range tasks {
+		res := <-t.done
+		if res.err != nil && first == nil {
+			first = fmt.Errorf("job %s: %s", t.req.Job.EID, res.err.Error())
+		}
+		markets[i] = res.market
+	}
+	return markets, first
+}
+
+// start runs a dispatcher for every slot of every worker, they share the queue of tasks
+func (r *RemoteRunner) start() {
+	r.tasks = make(chan *remoteTask)
+	if r.Client == nil {
+		r.Client = http.DefaultClient
+	}
+	slots := r.Slots
+	if slots < 1 {
+		slots = 1
+	}
+
+	r.alive = len(r.Addrs) * slots
+	if r.alive == 0 {
+		go r.drain()
+	}
+	for _, addr := range r.Addrs {
+		for s := 0; s < slots; s++ {
+			go r.dispatch(addr)
+		}
+	}
+}
+
+// dispatch sends tasks to the worker at addr until it fails too many times in a row
+func (r *RemoteRunner) dispatch(addr string) {
+	failures := 0
+	for t := range r.tasks {
+		market, retry, err := r.post(addr, t.req)
+		if err == nil {
+			failures = 0
+			t.done <- remoteResult{market: market}
+			continue
+		}
+
+		t.attempts++
+		log.WithFields(log.Fields{
+			"Worker":  addr,
+			"EID":     t.req.Job.EID,
+			"Attempt": t.attempts,
+			"error":   err.Error(),
+		}).Warn("Job failed on worker")
+		if !retry || t.attempts > r.Retries {
+			t.done <- remoteResult{err: err}
+		} else {
+			go func(t *remoteTask) {
+				r.tasks <- t
+			}(t)
+		}
+		// the job can not be run anywhere, the worker itself is fine
+		if !retry {
+			continue
+		}
+
+		failures++
+		if failures > r.Retries {
+			log.WithFields(log.Fields{
+				"Worker":   addr,
+				"Failures": failures,
+			}).Error("Worker is not answering, no more jobs are sent to it")
+			break
+		}
+		// give the worker some time to come back before sending it another job
+		time.Sleep(time.Duration(failures) * 500 * time.Millisecond)
+	}
+
+	r.mu.Lock()
+	r.alive--
+	last := r.alive == 0
+	r.mu.Unlock()
+	if last {
+		r.drain()
+	}
+}
+
+// drain fails every task once no dispatcher is left
+func (r *RemoteRunner) drain() {
+	for t := range r.tasks {
+		t.done <- remoteResult{err: errNoWorkers}
+	}
+}
+
+// post runs a job on the worker at addr, retry is false when the worker refused the job
+func (r *RemoteRunner) post(addr string, req workerRequest) (exchange.MarketResult, bool, error) {
+	var market exchange.MarketResult
+	body, err := json.Marshal(req)
+	if err != nil {
+		return market, false, err
+	}
+
+	resp, err := r.Client.Post(workerURL(addr, workerRunPath), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return market, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err := fmt.Errorf("worker answered %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		return market, resp.StatusCode >= 500, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&market); err != nil {
+		return market, true, err
+	}
+	return market, false, nil
+}
+
+// workerURL is the url of path on the worker at addr, addr is host:port or a full url
+func workerURL(addr, path string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimRight(addr, "/") + path
+}
+
+// workerServer runs the jobs it is sent, at most as many at the same time as it has slots
+type workerServer struct {
+	slots   chan struct{}
+	journal exchange.Journal
+}
+
+func (w *workerServer) run(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "jobs are sent with POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var wr workerRequest
+	if err := json.NewDecoder(req.Body).Decode(&wr); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var config ExperimentConfig
+	if err := catchPanic(func() { config = buildConfig(wr.Config) }); err != nil {
+		http.Error(rw, "the config is not valid: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	config.Journal = w.journal
+
+	w.slots <- struct{}{}
+	defer func() { <-w.slots }()
+
+	log.WithFields(log.Fields{
+		"EID":  wr.Job.EID,
+		"Seed": wr.Job.Seed,
+	}).Info("Running job")
+	var market exchange.MarketResult
+	if err := catchPanic(func() { market = runMarket(config, wr.Job, results.Default) }); err != nil {
+		log.WithFields(log.Fields{
+			"EID":   wr.Job.EID,
+			"error": err.Error(),
+		}).Error("Job failed")
+		// the market runs the same on every worker so the job is not tried again
+		http.Error(rw, err.Error(), statusJobFailed)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(market); err != nil {
+		log.WithFields(log.Fields{
+			"EID":   wr.Job.EID,
+			"error": err.Error(),
+		}).Error("Result of the job could not be sent")
+	}
+}
+
+// catchPanic runs fn and returns the panic it raised as an error
+func catchPanic(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if entry, ok := r.(*log.Entry); ok {
+				err = errors.New(entry.Message)
+				return
+			}
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+// worker serves jobs over HTTP until it is interrupted, its results go to its own output
+func worker(c *cli.Context) {
+	setOutputs(c)
+	journal := newJournal(c)
+	defer closeOutputs(ExperimentConfig{Journal: journal})
+
+	slots := c.Int("workers")
+	if slots <= 0 {
+		slots = runtime.NumCPU()
+	}
+	w := &workerServer{slots: make(chan struct{}, slots), journal: journal}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(workerRunPath, w.run)
+	mux.HandleFunc(workerHealthPath, func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprintln(rw, "ok")
+	})
+	server := &http.Server{Addr: c.String("listen"), Handler: mux}
+
+	// the outputs are closed on the way out so nothing is lost when the worker is stopped
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		server.Close()
+	}()
+
+	log.WithFields(log.Fields{
+		"Address": server.Addr,
+		"Slots":   slots,
+	}).Warn("Worker listening")
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Panic("The worker could not listen")
+	}
+}
+
+// coordinator runs the GA, ItRun or ItGA of the config file with its markets run by the
+// workers given with --worker-addr
+func coordinator(c *cli.Context) {
+	addrs := c.StringSlice("worker-addr")
+	if len(addrs) == 0 {
+		log.Panic("The coordinator needs at least one worker, use flag --worker-addr")
+	}
+
+	config := checkFlags(c)
+	defer closeOutputs(config)
+	runner := &RemoteRunner{
+		Addrs:   addrs,
+		Slots:   c.Int("jobs-per-worker"),
+		Retries: c.Int("retries"),
+		Client:  &http.Client{Timeout: c.Duration("job-timeout")},
+	}
+	config.Runner = runner
+
+	// without --parallel the runs keep every slot of the workers busy
+	parallel := c.Int("parallel")
+	if !c.IsSet("parallel") {
+		parallel = len(addrs) * runner.Slots
+	}
+
+	switch c.String("mode") {
+	case "GA":
+		runGA(config)
+	case "ItRun":
+		runIterations(config, batchRuns(c, 500), parallel)
+	case "ItGA":
+		runGAs(config, batchRuns(c, 100), parallel)
+	default:
+		log.WithFields(log.Fields{
+			"Valid options": "[GA, ItRun, ItGA]",
+			"Given option":  c.String("mode"),
+		}).Panic("The coordinator mode is unsupported")
+	}
+}
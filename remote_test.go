@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"mexs/results"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testJobs(config ExperimentConfig, n int) []MarketJob {
+	jobs := make([]MarketJob, n)
+	for i := range jobs {
+		jobs[i] = MarketJob{
+			EID:      fmt.Sprintf("%s_%d", config.EID, i),
+			Params:   config.GA,
+			Seed:     int64(i + 1),
+			SkipLogs: true,
+		}
+	}
+	return jobs
+}
+
+// testWorker is a worker server that counts the jobs it answered, once it answered
+// dieAfter jobs it drops every connection without an answer
+type testWorker struct {
+	server   *httptest.Server
+	dieAfter int32
+	jobs     int32
+	dropped  int32
+}
+
+func startWorker(t *testing.T, dieAfter int32) *testWorker {
+	w := &testWorker{dieAfter: dieAfter}
+	ws := &workerServer{slots: make(chan struct{}, 1)}
+	w.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if w.dieAfter > 0 && atomic.LoadInt32(&w.jobs) >= w.dieAfter {
+			atomic.AddInt32(&w.dropped, 1)
+			if conn, _, err := rw.(http.Hijacker).Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		}
+		ws.run(rw, req)
+		atomic.AddInt32(&w.jobs, 1)
+	}))
+	t.Cleanup(w.server.Close)
+	return w
+}
+
+func TestRemoteRunnerRetriesJobsOfADeadWorker(t *testing.T) {
+	config := testConfig(t)
+	jobs := testJobs(config, 8)
+	want, _ := (&localRunner{Workers: 2, Sink: results.Discard}).Run(config, jobs)
+
+	// the first worker dies as soon as it has answered one job
+	dying := startWorker(t, 1)
+	workers := []*testWorker{dying, startWorker(t, 0), startWorker(t, 0)}
+	addrs := make([]string, len(workers))
+	for i, w := range workers {
+		addrs[i] = w.server.URL
+	}
+
+	runner := &RemoteRunner{Addrs: addrs, Slots: 1, Retries: 1, Client: &http.Client{Timeout: 10 * time.Second}}
+	got, err := runner.Run(config, jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("the markets run by the workers differ from the ones run here")
+	}
+
+	if jobs := atomic.LoadInt32(&dying.jobs); jobs != 1 {
+		t.Errorf("the dead worker answered %d jobs, want 1", jobs)
+	}
+	if atomic.LoadInt32(&dying.dropped) == 0 {
+		t.Error("no job was sent to the dead worker")
+	}
+	if served := atomic.LoadInt32(&workers[1].jobs) + atomic.LoadInt32(&workers[2].jobs); served != int32(len(jobs)-1) {
+		t.Errorf("the other workers answered %d jobs, want %d", served, len(jobs)-1)
+	}
+}
+
+func TestRemoteRunnerDoesNotBlameWorkerForFailedMarket(t *testing.T) {
+	config := testConfig(t)
+	w := startWorker(t, 0)
+	runner := &RemoteRunner{Addrs: []string{w.server.URL}, Slots: 1, Retries: 0, Client: &http.Client{Timeout: 10 * time.Second}}
+
+	bad := testJobs(config, 1)
+	bad[0].Params.PricingRule = "NOPE"
+	if _, err := runner.Run(config, bad); err == nil {
+		t.Fatal("a market that can not run gave no error")
+	}
+	if jobs := atomic.LoadInt32(&w.jobs); jobs != 1 {
+		t.Errorf("the failed market was sent %d times, want 1", jobs)
+	}
+
+	// the worker is still used after the failed market
+	if _, err := runner.Run(config, testJobs(config, 2)); err != nil {
+		t.Errorf("the worker got no more jobs after a failed market: %s", err.Error())
+	}
+}
+
+// testWorkerEnv is the address the test binary listens on when it is run as a worker
+// process, testWorkerOutputEnv the output folder of the worker
+const (
+	testWorkerEnv       = "MEXS_TEST_WORKER"
+	testWorkerOutputEnv = "MEXS_TEST_WORKER_OUTPUT"
+)
+
+// startWorkerProcess runs the test binary as a worker process and waits until it answers
+func startWorkerProcess(t *testing.T) (*exec.Cmd, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), testWorkerEnv+"="+addr, testWorkerOutputEnv+"="+t.TempDir())
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	for i := 0; i < 100; i++ {
+		if resp, err := http.Get(workerURL(addr, workerHealthPath)); err == nil {
+			resp.Body.Close()
+			return cmd, addr
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("the worker process at %s did not start", addr)
+	return nil, ""
+}
+
+func TestRemoteRunnerWithWorkerProcesses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts worker processes")
+	}
+	config := testConfig(t)
+	jobs := testJobs(config, 8)
+	want, _ := (&localRunner{Workers: 2, Sink: results.Discard}).Run(config, jobs)
+
+	addrs := make([]string, 3)
+	cmds := make([]*exec.Cmd, len(addrs))
+	for i := range addrs {
+		cmds[i], addrs[i] = startWorkerProcess(t)
+	}
+	// the first worker is killed once it is up, its jobs go to the other workers
+	cmds[0].Process.Kill()
+	cmds[0].Wait()
+
+	runner := &RemoteRunner{Addrs: addrs, Slots: 2, Retries: 3, Client: &http.Client{Timeout: time.Minute}}
+	got, err := runner.Run(config, jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("the markets run by the worker processes differ from the ones run here")
+	}
+}
+
+func TestWorkerURL(t *testing.T) {
+	cases := map[string]string{
+		"localhost:8080":         "http://localhost:8080/run",
+		"http://10.0.0.1:9000/":  "http://10.0.0.1:9000/run",
+		"https://worker.example": "https://worker.example/run",
+	}
+	for addr, want := range cases {
+		if got := workerURL(addr, workerRunPath); got != want {
+			t.Errorf("workerURL(%s) = %s, want %s", addr, got, want)
+		}
+	}
+}
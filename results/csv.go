@@ -0,0 +1,72 @@
+package results
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CSVSink writes every table to Root/<eid>/<table>.csv, the header is only written
+// when the file is made so runs with the same id append to the same files
+type CSVSink struct {
+	Root string
+
+	// mu keeps writes from markets run in parallel from mixing in the same file
+	mu sync.Mutex
+}
+
+func (s *CSVSink) Write(eid, table string, columns []string, rows [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fileName, err := tablePath(s.Root, eid, table, ".csv")
+	if err != nil {
+		return err
+	}
+
+	addHeader := true
+	if _, err := os.Stat(fileName); err == nil {
+		addHeader = false
+	}
+
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if addHeader {
+		writer.Write(columns)
+	}
+	writer.WriteAll(rows)
+	return writer.Error()
+}
+
+func (s *CSVSink) Close() error {
+	return nil
+}
+
+func (s *CSVSink) Remove(eid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.RemoveAll(s.Dir(eid))
+}
+
+// Dir is the folder the tables of experiment eid are written to
+func (s *CSVSink) Dir(eid string) string {
+	return filepath.Join(s.Root, eid)
+}
+
+// tablePath makes the folder of experiment eid and returns the absolute path of a table file
+func tablePath(root, eid, table, ext string) (string, error) {
+	dir, err := filepath.Abs(filepath.Join(root, eid))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, table+ext), nil
+}
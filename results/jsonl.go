@@ -0,0 +1,91 @@
+package results
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONLSink writes every table to Root/<eid>/<table>.jsonl with one JSON object per row,
+// fields that hold a number are written as JSON numbers
+type JSONLSink struct {
+	Root string
+
+	// mu keeps writes from markets run in parallel from mixing in the same file
+	mu sync.Mutex
+}
+
+func (s *JSONLSink) Write(eid, table string, columns []string, rows [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fileName, err := tablePath(s.Root, eid, table, ".jsonl")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, row := range rows {
+		line, err := jsonRow(columns, row)
+		if err != nil {
+			return err
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+	}
+	return writer.Flush()
+}
+
+func (s *JSONLSink) Close() error {
+	return nil
+}
+
+func (s *JSONLSink) Remove(eid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.RemoveAll(filepath.Join(s.Root, eid))
+}
+
+// jsonRow encodes a row as a JSON object with the fields in the order of the columns
+func jsonRow(columns, row []string) ([]byte, error) {
+	line := []byte{'{'}
+	for i, column := range columns {
+		if i >= len(row) {
+			break
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(jsonValue(row[i]))
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			line = append(line, ',')
+		}
+		line = append(line, key...)
+		line = append(line, ':')
+		line = append(line, value...)
+	}
+	return append(line, '}'), nil
+}
+
+// jsonValue keeps the exact digits of numbers and leaves anything else as a string
+func jsonValue(v string) interface{} {
+	if v == "" || !(v[0] == '-' || (v[0] >= '0' && v[0] <= '9')) {
+		return v
+	}
+	if !json.Valid([]byte(v)) {
+		return v
+	}
+	return json.Number(v)
+}
@@ -0,0 +1,85 @@
+package results
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Table is the content of one table kept by a MemorySink
+type Table struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// MemorySink keeps every table in memory, it is safe to use from several goroutines
+type MemorySink struct {
+	mu     sync.Mutex
+	tables map[string]map[string]*Table
+}
+
+func (s *MemorySink) Write(eid, table string, columns []string, rows [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tables == nil {
+		s.tables = map[string]map[string]*Table{}
+	}
+	if s.tables[eid] == nil {
+		s.tables[eid] = map[string]*Table{}
+	}
+	t, ok := s.tables[eid][table]
+	if !ok {
+		t = &Table{Columns: append([]string{}, columns...)}
+		s.tables[eid][table] = t
+	}
+	for _, row := range rows {
+		t.Rows = append(t.Rows, append([]string{}, row...))
+	}
+	return nil
+}
+
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+func (s *MemorySink) Remove(eid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.tables {
+		if id == eid || strings.HasPrefix(id, eid+"/") {
+			delete(s.tables, id)
+		}
+	}
+	return nil
+}
+
+// Table returns a copy of a table of experiment eid, it is false when nothing was written to it
+func (s *MemorySink) Table(eid, table string) (Table, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tables[eid][table]
+	if !ok {
+		return Table{}, false
+	}
+	rows := make([][]string, len(t.Rows))
+	for i, row := range t.Rows {
+		rows[i] = append([]string{}, row...)
+	}
+	return Table{Columns: append([]string{}, t.Columns...), Rows: rows}, true
+}
+
+// Experiments returns the ids of the experiments with results, sorted
+func (s *MemorySink) Experiments() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.tables))
+	for eid := range s.tables {
+		ids = append(ids, eid)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,85 @@
+package results
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+// ResultSink receives everything the simulation logs. Results are tables of rows,
+// each experiment id has its own set of tables
+type ResultSink interface {
+	// Write appends rows to a table of experiment eid, columns are the names of the fields
+	// of each row and are the same on every call for a table
+	Write(eid, table string, columns []string, rows [][]string) error
+	// Close flushes anything the sink still holds
+	Close() error
+}
+
+// TableReader is a sink the tables it was given can be read back from
+type TableReader interface {
+	// Table returns the rows of a table of experiment eid, it is false when nothing was written to it
+	Table(eid, table string) (Table, bool)
+}
+
+// Remover is a sink the results of an experiment can be deleted from
+type Remover interface {
+	// Remove deletes every table of experiment eid and of the experiments nested in it
+	Remove(eid string) error
+}
+
+// Discard is a sink that drops everything written to it
+var Discard ResultSink = discardSink{}
+
+type discardSink struct{}
+
+func (discardSink) Write(eid, table string, columns []string, rows [][]string) error {
+	return nil
+}
+
+func (discardSink) Close() error {
+	return nil
+}
+
+// DefaultRoot is the folder the results are written to when no output root is given
+const DefaultRoot = "logs"
+
+// Default is the sink used by exchanges, traders and the GA when they are not given one
+var Default ResultSink = &CSVSink{Root: DefaultRoot}
+
+// Formats are the sinks that can be picked from the command line
+var Formats = []string{"csv", "jsonl", "memory"}
+
+// extraFormats are the sinks only built with some build tags, they are made from the output root
+var extraFormats = map[string]func(root string) ResultSink{}
+
+// NewSink returns the sink for a format writing under root
+func NewSink(format, root string) (ResultSink, error) {
+	if root == "" {
+		root = DefaultRoot
+	}
+
+	switch format {
+	case "", "csv":
+		return &CSVSink{Root: root}, nil
+	case "jsonl":
+		return &JSONLSink{Root: root}, nil
+	case "memory":
+		return &MemorySink{}, nil
+	}
+	if newSink, ok := extraFormats[format]; ok {
+		return newSink(root), nil
+	}
+	return nil, fmt.Errorf("unknown output format %s", format)
+}
+
+// Save writes rows to a sink and logs the error if it fails, results are not worth
+// stopping an experiment for
+func Save(sink ResultSink, eid, table string, columns []string, rows [][]string) {
+	if err := sink.Write(eid, table, columns, rows); err != nil {
+		log.WithFields(log.Fields{
+			"experimentID": eid,
+			"table":        table,
+			"error":        err.Error(),
+		}).Error("Results could not be saved")
+	}
+}
@@ -0,0 +1,121 @@
+package results
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testColumns = []string{"ID", "Price", "Event"}
+
+func TestMemorySinkKeepsRowsOfEachTable(t *testing.T) {
+	s := &MemorySink{}
+	s.Write("exp", "TRADES", testColumns, [][]string{{"1", "100.5", "CDA"}})
+	s.Write("exp", "TRADES", testColumns, [][]string{{"2", "101", "CALL"}})
+	s.Write("exp/GEN_0", "TRADES", testColumns, [][]string{{"1", "99", "CDA"}})
+
+	table, ok := s.Table("exp", "TRADES")
+	if !ok {
+		t.Fatal("table was not kept")
+	}
+	want := Table{Columns: testColumns, Rows: [][]string{{"1", "100.5", "CDA"}, {"2", "101", "CALL"}}}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("table is %v, want %v", table, want)
+	}
+	table.Rows[0][0] = "changed"
+	if again, _ := s.Table("exp", "TRADES"); again.Rows[0][0] != "1" {
+		t.Error("Table did not return a copy")
+	}
+	if _, ok := s.Table("exp", "AGENTS"); ok {
+		t.Error("table that was never written was found")
+	}
+	if ids := s.Experiments(); !reflect.DeepEqual(ids, []string{"exp", "exp/GEN_0"}) {
+		t.Errorf("experiments are %v", ids)
+	}
+}
+
+func TestCSVSinkWritesHeaderOnce(t *testing.T) {
+	s := &CSVSink{Root: t.TempDir()}
+	for _, row := range [][]string{{"1", "100.5", "CDA"}, {"2", "101", "CALL"}} {
+		if err := s.Write("exp", "TRADES", testColumns, [][]string{row}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir("exp"), "TRADES.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ID,Price,Event\n1,100.5,CDA\n2,101,CALL\n"
+	if string(data) != want {
+		t.Errorf("csv is %q, want %q", data, want)
+	}
+}
+
+func TestJSONLSinkWritesNumbers(t *testing.T) {
+	s := &JSONLSink{Root: t.TempDir()}
+	if err := s.Write("exp", "TRADES", testColumns, [][]string{{"1", "100.50", "CDA"}, {"-2", "1e", ""}}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.Root, "exp", "TRADES.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"ID":1,"Price":100.50,"Event":"CDA"}` + "\n" + `{"ID":-2,"Price":"1e","Event":""}` + "\n"
+	if string(data) != want {
+		t.Errorf("jsonl is %q, want %q", data, want)
+	}
+}
+
+func TestRemoveDeletesNestedExperiments(t *testing.T) {
+	csvSink := &CSVSink{Root: t.TempDir()}
+	jsonlSink := &JSONLSink{Root: t.TempDir()}
+	sinks := map[string]ResultSink{"csv": csvSink, "jsonl": jsonlSink, "memory": &MemorySink{}}
+	exists := map[string]func(eid string) bool{
+		"csv": func(eid string) bool {
+			_, err := os.Stat(filepath.Join(csvSink.Dir(eid), "TRADES.csv"))
+			return err == nil
+		},
+		"jsonl": func(eid string) bool {
+			_, err := os.Stat(filepath.Join(jsonlSink.Root, eid, "TRADES.jsonl"))
+			return err == nil
+		},
+		"memory": func(eid string) bool {
+			_, ok := sinks["memory"].(*MemorySink).Table(eid, "TRADES")
+			return ok
+		},
+	}
+
+	for name, s := range sinks {
+		for _, eid := range []string{"exp", "exp/GEN_1", "exp/GEN_1/IND_0", "exp/GEN_10"} {
+			if err := s.Write(eid, "TRADES", testColumns, [][]string{{"1", "100", "CDA"}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.(Remover).Remove("exp/GEN_1"); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		for eid, kept := range map[string]bool{"exp": true, "exp/GEN_1": false, "exp/GEN_1/IND_0": false, "exp/GEN_10": true} {
+			if exists[name](eid) != kept {
+				t.Errorf("%s: results of %s kept is %v, want %v", name, eid, !kept, kept)
+			}
+		}
+		if err := s.(Remover).Remove("missing"); err != nil {
+			t.Errorf("%s: removing an experiment with no results failed: %s", name, err)
+		}
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	for _, format := range Formats {
+		if _, err := NewSink(format, t.TempDir()); err != nil {
+			t.Errorf("%s: %s", format, err)
+		}
+	}
+	if _, err := NewSink("xml", ""); err == nil {
+		t.Error("unknown format was accepted")
+	}
+}
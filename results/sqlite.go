@@ -0,0 +1,378 @@
+//go:build sqlite
+// +build sqlite
+
+package results
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The SQLite sink is only built with the sqlite build tag as it needs cgo and the
+// github.com/mattn/go-sqlite3 driver, go build -tags sqlite adds the sqlite format
+func init() {
+	extraFormats["sqlite"] = func(root string) ResultSink {
+		return &SQLiteSink{Path: filepath.Join(root, "results.db")}
+	}
+	Formats = append(Formats, "sqlite")
+}
+
+// sqlTables are the SQL names of the tables written by the simulator, other tables
+// keep their name in lower case
+var sqlTables = map[string]string{
+	"TRADES":      "trades",
+	"ALLORDERS":   "orders",
+	"schedule":    "schedules",
+	"LimitPrices": "limit_prices",
+	"chromozones": "chromosomes",
+	"elite":       "elite",
+	"REVENUE":     "revenue",
+	"COMPETITION": "competition",
+	"SEED":        "seeds",
+}
+
+// SQLiteSink keeps the results of every experiment in a single SQLite database. Each
+// experiment id is a row of the runs table keyed by experiment, generation and
+// individual, every other table has a run_id column pointing to it so runs can be
+// compared with one query, e.g.
+//
+//	SELECT r.gen, r.ind, avg(t.price) FROM trades t JOIN runs r ON r.id = t.run_id
+//	WHERE r.experiment = 'ga1' GROUP BY r.gen, r.ind
+type SQLiteSink struct {
+	Path string
+
+	mu   sync.Mutex
+	db   *sql.DB
+	runs map[string]int64
+	// columns has the columns of every table made so far
+	columns map[string]map[string]bool
+}
+
+func (s *SQLiteSink) Write(eid, table string, columns []string, rows [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+	runID, err := s.run(eid)
+	if err != nil {
+		return err
+	}
+
+	name := sqlTable(table)
+	cols := make([]string, len(columns))
+	for i, c := range columns {
+		cols[i] = sqlColumn(c)
+	}
+	if err := s.ensureTable(name, cols); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(cols)+1), ", ")
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = quote(c)
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (run_id, %s) VALUES (%s)",
+		quote(name), strings.Join(quoted, ", "), marks))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		args := make([]interface{}, len(cols)+1)
+		args[0] = runID
+		for i := range cols {
+			if i < len(row) {
+				args[i+1] = row[i]
+			}
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Table reads back the rows of a table written for experiment eid, numbers come back
+// in their shortest form
+func (s *SQLiteSink) Table(eid, table string) (Table, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return Table{}, false
+	}
+	runID, ok := s.runs[eid]
+	if !ok {
+		if err := s.db.QueryRow("SELECT id FROM runs WHERE eid = ?", eid).Scan(&runID); err != nil {
+			return Table{}, false
+		}
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf("SELECT * FROM %s WHERE run_id = ? ORDER BY rowid", quote(sqlTable(table))), runID)
+	if err != nil {
+		return Table{}, false
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return Table{}, false
+	}
+	result := Table{Columns: columns[1:]}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return Table{}, false
+		}
+		row := make([]string, len(columns)-1)
+		for i, v := range values[1:] {
+			row[i] = v.String
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, len(result.Rows) > 0
+}
+
+// Remove deletes the rows of experiment eid and of the experiments nested in it
+func (s *SQLiteSink) Remove(eid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+	prefix := eid + "/"
+	runs := "SELECT id FROM runs WHERE eid = ? OR substr(eid, 1, length(?)) = ?"
+	args := []interface{}{eid, prefix, prefix}
+
+	rows, err := s.db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name != 'runs'")
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, name := range tables {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE run_id IN (%s)", quote(name), runs), args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM runs WHERE id IN (%s)", runs), args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for id := range s.runs {
+		if id == eid || strings.HasPrefix(id, prefix) {
+			delete(s.runs, id)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+// open makes the database and the runs table the first time the sink is written to
+func (s *SQLiteSink) open() error {
+	if s.db != nil {
+		return nil
+	}
+
+	path, err := filepath.Abs(s.Path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS runs (
+		id INTEGER PRIMARY KEY,
+		eid TEXT NOT NULL UNIQUE,
+		experiment TEXT NOT NULL,
+		gen INTEGER,
+		ind INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS runs_experiment ON runs (experiment, gen, ind);`)
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	s.db = db
+	s.runs = map[string]int64{}
+	s.columns = map[string]map[string]bool{}
+	return nil
+}
+
+// run returns the id of the row of experiment id eid in the runs table, adding it if needed
+func (s *SQLiteSink) run(eid string) (int64, error) {
+	if id, ok := s.runs[eid]; ok {
+		return id, nil
+	}
+
+	experiment, gen, ind := splitEID(eid)
+	_, err := s.db.Exec("INSERT OR IGNORE INTO runs (eid, experiment, gen, ind) VALUES (?, ?, ?, ?)",
+		eid, experiment, gen, ind)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	if err := s.db.QueryRow("SELECT id FROM runs WHERE eid = ?", eid).Scan(&id); err != nil {
+		return 0, err
+	}
+	s.runs[eid] = id
+	return id, nil
+}
+
+// ensureTable makes a table with the given columns or adds the ones it is missing.
+// Columns have NUMERIC affinity so numbers are stored as numbers and text as text
+func (s *SQLiteSink) ensureTable(name string, cols []string) error {
+	known, ok := s.columns[name]
+	if !ok {
+		known = map[string]bool{}
+		rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", quote(name)))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var cid, notNull, pk int
+			var col, ctype string
+			var dflt sql.NullString
+			if err := rows.Scan(&cid, &col, &ctype, &notNull, &dflt, &pk); err != nil {
+				rows.Close()
+				return err
+			}
+			known[col] = true
+		}
+		rows.Close()
+
+		if len(known) == 0 {
+			_, err := s.db.Exec(fmt.Sprintf(`CREATE TABLE %s (run_id INTEGER NOT NULL REFERENCES runs (id));
+			CREATE INDEX %s ON %s (run_id);`, quote(name), quote(name+"_run"), quote(name)))
+			if err != nil {
+				return err
+			}
+			known["run_id"] = true
+		}
+		s.columns[name] = known
+	}
+
+	for _, col := range cols {
+		if known[col] {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s NUMERIC", quote(name), quote(col))); err != nil {
+			return err
+		}
+		known[col] = true
+	}
+	return nil
+}
+
+// splitEID finds the experiment, generation and individual of an experiment id, GA
+// markets have ids like <experiment>/GEN_<gen>/IND_<ind>. Other ids have no generation
+// or individual and are the experiment themselves
+func splitEID(eid string) (string, interface{}, interface{}) {
+	var gen, ind interface{}
+	experiment := []string{}
+	for _, part := range strings.Split(eid, "/") {
+		if strings.HasPrefix(part, "GEN_") {
+			if g, err := strconv.Atoi(strings.TrimPrefix(part, "GEN_")); err == nil {
+				gen = g
+				continue
+			}
+		}
+		if strings.HasPrefix(part, "IND_") {
+			if i, err := strconv.Atoi(strings.TrimPrefix(part, "IND_")); err == nil {
+				ind = i
+				continue
+			}
+		}
+		if gen == nil {
+			experiment = append(experiment, part)
+		}
+	}
+	return strings.Join(experiment, "/"), gen, ind
+}
+
+// quote makes a SQL identifier of a name so column names like Limit are not read as keywords
+func quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func sqlTable(table string) string {
+	if name, ok := sqlTables[table]; ok {
+		return name
+	}
+	return sqlColumn(table)
+}
+
+// sqlColumn turns a column name into a lower case SQL identifier, B:A becomes b_a
+func sqlColumn(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	id := b.String()
+	if id == "" || (id[0] >= '0' && id[0] <= '9') {
+		id = "c_" + id
+	}
+	return id
+}
@@ -0,0 +1,74 @@
+//go:build sqlite
+// +build sqlite
+
+package results
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSQLiteSinkReadsBackRows(t *testing.T) {
+	s := &SQLiteSink{Path: filepath.Join(t.TempDir(), "results.db")}
+	defer s.Close()
+	if err := s.Write("exp", "TRADES", testColumns, [][]string{{"1", "100.50", "CDA"}}); err != nil {
+		t.Fatal(err)
+	}
+	// a table written again with a new column gets the column added
+	if err := s.Write("exp", "TRADES", []string{"ID", "Price", "Event", "B:A"}, [][]string{{"2", "101", "CALL", "0.5"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	table, ok := s.Table("exp", "TRADES")
+	if !ok {
+		t.Fatal("table was not kept")
+	}
+	want := Table{
+		Columns: []string{"id", "price", "event", "b_a"},
+		Rows:    [][]string{{"1", "100.5", "CDA", ""}, {"2", "101", "CALL", "0.5"}},
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("table is %v, want %v", table, want)
+	}
+	if _, ok := s.Table("exp", "AGENTS"); ok {
+		t.Error("table that was never written was found")
+	}
+}
+
+func TestSQLiteSinkRemovesNestedExperiments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	s := &SQLiteSink{Path: path}
+	for _, eid := range []string{"exp", "exp/GEN_1", "exp/GEN_1/IND_0", "exp/GEN_10", "exp/GENX1"} {
+		if err := s.Write(eid, "TRADES", testColumns, [][]string{{"1", "100", "CDA"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Remove("exp/GEN_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove("missing"); err != nil {
+		t.Errorf("removing an experiment with no results failed: %s", err)
+	}
+	s.Close()
+
+	// the rows are gone from the database, not only from the runs the sink knows
+	s = &SQLiteSink{Path: path}
+	defer s.Close()
+	kept := map[string]bool{"exp": true, "exp/GEN_1": false, "exp/GEN_1/IND_0": false, "exp/GEN_10": true, "exp/GENX1": true}
+	for eid, want := range kept {
+		if _, ok := s.Table(eid, "TRADES"); ok != want {
+			t.Errorf("results of %s kept is %v, want %v", eid, ok, want)
+		}
+	}
+}
+
+func TestNewSinkHasSQLite(t *testing.T) {
+	sink, err := NewSink("sqlite", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sink.(Remover); !ok {
+		t.Error("the sqlite sink can not remove results")
+	}
+}
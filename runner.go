@@ -0,0 +1,81 @@
+package main
+
+import (
+	"mexs/exchange"
+	"mexs/results"
+	"sync"
+)
+
+// MarketJob is one market of an experiment: the auction it runs, its seed and where its
+// results go
+type MarketJob struct {
+	EID    string
+	Params exchange.AuctionParameters
+	Seed   int64
+	// LogAll makes the exchange write every table of the market
+	LogAll bool
+	// SkipLogs discards the results of the market, only its MarketResult is kept
+	SkipLogs bool
+}
+
+// MarketRunner runs the markets of an experiment, the results are in the order of the jobs
+type MarketRunner interface {
+	Run(config ExperimentConfig, jobs []MarketJob) ([]exchange.MarketResult, error)
+}
+
+// localRunner runs the markets in this process over Workers goroutines
+type localRunner struct {
+	Workers int
+	// Sink receives the results of the markets, results.Default when nil
+	Sink results.ResultSink
+}
+
+func (r *localRunner) Run(config ExperimentConfig, jobs []MarketJob) ([]exchange.MarketResult, error) {
+	markets := make([]exchange.MarketResult, len(jobs))
+	workers := r.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				markets[i] = runMarket(config, jobs[i], r.Sink)
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return markets, nil
+}
+
+// runMarket runs the market of a job with the traders and schedule of the experiment
+func runMarket(config ExperimentConfig, job MarketJob, sink results.ResultSink) exchange.MarketResult {
+	// the agents and the exchange draw from the seed of the job so the market can be replayed alone
+	config.Seed = job.Seed
+	ex := newExchange(config)
+	ex.LogAll = job.LogAll
+	ex.Sink = sink
+	if job.SkipLogs {
+		ex.Sink = results.Discard
+	}
+	ex.Init(job.Params, config.MarketInfo, config.SellersIDs, config.BuyersIDs)
+	ex.SetTraders(ReMakeAgents(config))
+	return ex.StartMarket(job.EID, config.Schedule, config.SandDs)
+}
+
+// runnerOf is the runner of the experiment, markets run here over workers goroutines
+// when it has none
+func runnerOf(config ExperimentConfig, workers int, sink results.ResultSink) MarketRunner {
+	if config.Runner != nil {
+		return config.Runner
+	}
+	return &localRunner{Workers: workers, Sink: sink}
+}
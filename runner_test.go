@@ -0,0 +1,72 @@
+package main
+
+import (
+	"mexs/results"
+	"reflect"
+	"testing"
+)
+
+func TestLocalRunnerKeepsTheOrderOfTheJobs(t *testing.T) {
+	config := testConfig(t)
+	jobs := testJobs(config, 6)
+
+	alone, err := (&localRunner{Workers: 1, Sink: results.Discard}).Run(config, jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := (&localRunner{Workers: 4, Sink: results.Discard}).Run(config, jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, market := range pool {
+		if market.EID != jobs[i].EID {
+			t.Errorf("result %d is of market %s, want %s", i, market.EID, jobs[i].EID)
+		}
+	}
+	if !reflect.DeepEqual(pool, alone) {
+		t.Error("markets run over 4 workers differ from the ones run over 1")
+	}
+}
+
+func TestGAResultsDoNotDependOnWorkers(t *testing.T) {
+	chromozones := map[int][]string{}
+	for _, workers := range []int{1, 3} {
+		configFile := testConfigFile(t)
+		configFile.Workers = workers
+		sink := &results.MemorySink{}
+		ga := newGA(buildConfig(configFile))
+		ga.Sink = sink
+		ga.Start()
+
+		table, ok := sink.Table("test", "chromozones")
+		if !ok || len(table.Rows) != configFile.Gens*configFile.Individuals {
+			t.Fatalf("%d workers: GA wrote %d chromozones", workers, len(table.Rows))
+		}
+		for _, row := range table.Rows {
+			chromozones[workers] = append(chromozones[workers], row...)
+		}
+	}
+	if !reflect.DeepEqual(chromozones[1], chromozones[3]) {
+		t.Error("GA run over 3 workers differs from the one run over 1")
+	}
+}
+
+func TestMarketsWriteToTheSinkOfTheExperiment(t *testing.T) {
+	config := testConfig(t)
+	jobs := testJobs(config, 2)
+	jobs[0].SkipLogs = false
+
+	sink := &results.MemorySink{}
+	if _, err := (&localRunner{Workers: 2, Sink: sink}).Run(config, jobs); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sink.Table(jobs[0].EID, "TRADES"); !ok {
+		t.Error("market did not write its trades to the sink")
+	}
+	for _, eid := range sink.Experiments() {
+		if eid == jobs[1].EID {
+			t.Error("market with SkipLogs wrote its results")
+		}
+	}
+}